@@ -0,0 +1,22 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"fmt"
+)
+
+// SetAccountDisabled disables or re-enables an account. Disabling also ends
+// its sessions, they are returned so their connections can be logged out.
+func SetAccountDisabled(account database.Account, disabled bool) ([]database.Session, error) {
+	if _, err := account.SetDisabled(disabled); err != nil {
+		return nil, fmt.Errorf("failed to update account: %v", err)
+	}
+	if !disabled {
+		return nil, nil
+	}
+	sessions, err := database.DeleteAccountSessions(account.Token)
+	if err != nil {
+		return nil, fmt.Errorf("account disabled but failed to end its sessions: %v", err)
+	}
+	return sessions, nil
+}
@@ -0,0 +1,172 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// API keys carry this prefix so they can't be mistaken for sessions or the
+// random tokens guests own their files with
+const apiKeyPrefix = "key_"
+
+// last_used is only written back this often, scripts can be chatty
+const apiKeyTouchInterval = time.Minute
+
+const maxAPIKeyNameLength = 64
+const maxAPIKeysPerAccount = 50
+
+const (
+	ScopeReadFiles         = "files:read"
+	ScopeUpload            = "files:upload"
+	ScopeManageCollections = "collections:manage"
+	ScopeDeleteFiles       = "files:delete"
+)
+
+var apiKeyScopes = []string{ScopeReadFiles, ScopeUpload, ScopeManageCollections, ScopeDeleteFiles}
+
+// APIKeyInfo is how keys are shown to their owner.
+type APIKeyInfo struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	Collections []string `json:"collections"`
+	CreatedAt   int64    `json:"created_at"`
+	LastUsed    int64    `json:"last_used"`
+	ExpiresAt   int64    `json:"expires_at"`
+}
+
+// NewAPIKey is returned once when a key is created, the key itself can't be
+// looked up again after that.
+type NewAPIKey struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+func apiKeyInfo(key database.APIKey) APIKeyInfo {
+	return APIKeyInfo{
+		ID:          key.ID,
+		Name:        key.Name,
+		Scopes:      key.ScopeList(),
+		Collections: key.CollectionList(),
+		CreatedAt:   key.CreatedAt,
+		LastUsed:    key.LastUsed,
+		ExpiresAt:   key.ExpiresAt,
+	}
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// CreateAPIKey makes a key for an account. Collections it's limited to must
+// be ones the account edits.
+func CreateAPIKey(accountToken string, name string, scopes []string, collections []string, expiresAt int64) (NewAPIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return NewAPIKey{}, fmt.Errorf("name must be between 1 and %d characters", maxAPIKeyNameLength)
+	}
+	if len(scopes) == 0 {
+		return NewAPIKey{}, fmt.Errorf("pick at least one scope")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			return NewAPIKey{}, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	for _, collectionID := range collections {
+		collection, err := database.GetCollection(collectionID)
+		if err != nil || !collection.IsEditor(accountToken) {
+			return NewAPIKey{}, fmt.Errorf("collection %s not found", collectionID)
+		}
+	}
+	now := time.Now().Unix()
+	if expiresAt != 0 && expiresAt <= now {
+		return NewAPIKey{}, fmt.Errorf("expiry must be in the future")
+	}
+	existing, err := database.GetAccountAPIKeys(accountToken)
+	if err != nil {
+		return NewAPIKey{}, fmt.Errorf("failed to get API keys: %v", err)
+	}
+	if len(existing) >= maxAPIKeysPerAccount {
+		return NewAPIKey{}, fmt.Errorf("accounts can have at most %d API keys", maxAPIKeysPerAccount)
+	}
+
+	token := apiKeyPrefix + randomString(32)
+	key := database.APIKey{
+		ID:           randomString(12),
+		Name:         name,
+		TokenHash:    hashSessionToken(token),
+		AccountToken: accountToken,
+		Scopes:       strings.Join(slices.Compact(slices.Sorted(slices.Values(scopes))), ","),
+		Collections:  strings.Join(slices.Compact(slices.Sorted(slices.Values(collections))), ","),
+		CreatedAt:    now,
+		ExpiresAt:    expiresAt,
+	}
+	if err := key.Insert(); err != nil {
+		return NewAPIKey{}, fmt.Errorf("failed to store API key: %v", err)
+	}
+	return NewAPIKey{APIKeyInfo: apiKeyInfo(key), Key: token}, nil
+}
+
+// FindAPIKey returns the live key token belongs to.
+func FindAPIKey(token string) (database.APIKey, error) {
+	key, err := database.FindAPIKeyByHash(hashSessionToken(token))
+	if err != nil {
+		return database.APIKey{}, fmt.Errorf("API key expired or revoked")
+	}
+	now := time.Now()
+	if key.ExpiresAt != 0 && now.Unix() > key.ExpiresAt {
+		return database.APIKey{}, fmt.Errorf("API key expired or revoked")
+	}
+	if owner, err := database.FindUserByToken(key.AccountToken); err == nil && owner.Disabled {
+		return database.APIKey{}, ErrAccountDisabled
+	} else if err == nil && owner.DeleteAt != 0 {
+		return database.APIKey{}, ErrPendingDeletion
+	}
+	if now.Sub(time.Unix(key.LastUsed, 0)) > apiKeyTouchInterval {
+		if touched, err := key.Touch(now.Unix()); err == nil {
+			key = touched
+		}
+	}
+	return key, nil
+}
+
+// AuthorizeAPIKey returns the key token belongs to if it has scope.
+func AuthorizeAPIKey(token string, scope string) (database.APIKey, error) {
+	key, err := FindAPIKey(token)
+	if err != nil {
+		return database.APIKey{}, err
+	}
+	if !key.HasScope(scope) {
+		return database.APIKey{}, fmt.Errorf("API key lacks the %s scope", scope)
+	}
+	return key, nil
+}
+
+func ListAPIKeys(accountToken string) ([]APIKeyInfo, error) {
+	keys, err := database.GetAccountAPIKeys(accountToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys: %v", err)
+	}
+	infos := []APIKeyInfo{}
+	for _, key := range keys {
+		infos = append(infos, apiKeyInfo(key))
+	}
+	return infos, nil
+}
+
+func RevokeAPIKey(accountToken string, keyID string) error {
+	keys, err := database.GetAccountAPIKeys(accountToken)
+	if err != nil {
+		return fmt.Errorf("failed to get API keys: %v", err)
+	}
+	for _, key := range keys {
+		if key.ID == keyID {
+			return key.Delete()
+		}
+	}
+	return fmt.Errorf("API key not found")
+}
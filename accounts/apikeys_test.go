@@ -0,0 +1,117 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"testing"
+	"time"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	setupAccounts(t)
+	owner := insertAccountWithPassword(t, "owner@example.com", "password")
+	other := insertAccountWithPassword(t, "other@example.com", "password")
+	collection := database.Collection{Name: "theirs", Editors: other.Token}
+	if err := collection.Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		keyName     string
+		scopes      []string
+		collections []string
+		expiresAt   int64
+		ok          bool
+	}{
+		{"read only", "backup", []string{ScopeReadFiles}, nil, 0, true},
+		{"every scope", "all", apiKeyScopes, nil, time.Now().Add(time.Hour).Unix(), true},
+		{"no name", " ", []string{ScopeReadFiles}, nil, 0, false},
+		{"no scopes", "none", nil, nil, 0, false},
+		{"unknown scope", "admin", []string{"accounts:admin"}, nil, 0, false},
+		{"someone else's collection", "sneaky", []string{ScopeReadFiles}, []string{collection.ID}, 0, false},
+		{"expiry in the past", "old", []string{ScopeReadFiles}, nil, time.Now().Add(-time.Hour).Unix(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := CreateAPIKey(owner.Token, tt.keyName, tt.scopes, tt.collections, tt.expiresAt)
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && !IsAPIKey(key.Key) {
+				t.Errorf("%q doesn't look like an API key", key.Key)
+			}
+		})
+	}
+}
+
+func TestAuthorizeAPIKey(t *testing.T) {
+	setupAccounts(t)
+	owner := insertAccountWithPassword(t, "scripts@example.com", "password")
+	reader, err := CreateAPIKey(owner.Token, "reader", []string{ScopeReadFiles}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploader, err := CreateAPIKey(owner.Token, "uploader", []string{ScopeUpload, ScopeReadFiles}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring, err := CreateAPIKey(owner.Token, "expiring", []string{ScopeReadFiles}, nil, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// expire it without waiting an hour
+	database.APIKeysByHashMutex.Lock()
+	stored := database.APIKeysByHash[hashSessionToken(expiring.Key)]
+	stored.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	database.APIKeysByHash[stored.TokenHash] = stored
+	database.APIKeysByHashMutex.Unlock()
+	revoked, err := CreateAPIKey(owner.Token, "revoked", []string{ScopeReadFiles}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeAPIKey(owner.Token, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		scope string
+		ok    bool
+	}{
+		{"has the scope", reader.Key, ScopeReadFiles, true},
+		{"lacks the scope", reader.Key, ScopeDeleteFiles, false},
+		{"one of several scopes", uploader.Key, ScopeUpload, true},
+		{"expired", expiring.Key, ScopeReadFiles, false},
+		{"revoked", revoked.Key, ScopeReadFiles, false},
+		{"made up", apiKeyPrefix + "made-up", ScopeReadFiles, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := AuthorizeAPIKey(tt.key, tt.scope)
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && key.AccountToken != owner.Token {
+				t.Error("key resolved to the wrong account")
+			}
+		})
+	}
+
+	// keys stop working with their owner
+	if _, err := owner.SetDisabled(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AuthorizeAPIKey(reader.Key, ScopeReadFiles); err != ErrAccountDisabled {
+		t.Errorf("got %v for a disabled owner, want ErrAccountDisabled", err)
+	}
+	if _, err := owner.SetDisabled(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := owner.SetDeleteAt(time.Now().Add(time.Hour).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AuthorizeAPIKey(reader.Key, ScopeReadFiles); err != ErrPendingDeletion {
+		t.Errorf("got %v for an owner pending deletion, want ErrPendingDeletion", err)
+	}
+}
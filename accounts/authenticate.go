@@ -2,9 +2,8 @@ package accounts
 
 import (
 	"angadrive/database"
+	"errors"
 	"sync"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -36,7 +35,61 @@ func getBcryptCache(key string) (bool, bool) {
 	return val, ok
 }
 
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+var ErrAccountDisabled = errors.New("this account has been disabled")
+
+// ErrPendingDeletion is returned after the credentials were checked, logging
+// in restores the account while everything else is refused.
+var ErrPendingDeletion = errors.New("this account is scheduled for deletion, log in to restore it")
+
+// AuthenticateFrom checks a login attempt coming from source (the client's
+// IP, or "" when it isn't known). Failures count towards lockouts of both
+// the account and the source, and a locked login fails with a LockoutError
+// without the password being checked at all.
+//
+// A password alone isn't enough for accounts with 2FA, they fail with
+// ErrTwoFactorRequired and have to use AuthenticateWithCode or a session.
+func AuthenticateFrom(email string, password string, source string) error {
+	return AuthenticateWithCode(email, password, "", source)
+}
+
+// AuthenticateWithCode is AuthenticateFrom with the TOTP or recovery code of
+// accounts that have 2FA, the code is used up when the login succeeds.
+func AuthenticateWithCode(email string, password string, code string, source string) error {
+	if err := checkLockout(email, source); err != nil {
+		return err
+	}
+	if !checkPassword(email, password) {
+		recordFailure(email, source)
+		return ErrInvalidCredentials
+	}
+	account, err := database.FindUserByEmail(email)
+	if err == nil && account.Disabled {
+		return ErrAccountDisabled
+	}
+	if err == nil && account.TOTPEnabled {
+		if code == "" {
+			return ErrTwoFactorRequired
+		}
+		if err := consumeSecondFactor(account, code); err != nil {
+			// the password was right, but guessing codes still has to lock the account
+			recordFailure(email, source)
+			return err
+		}
+	}
+	recordSuccess(email)
+	if err == nil && account.DeleteAt != 0 {
+		return ErrPendingDeletion
+	}
+	return nil
+}
+
 func Authenticate(email string, password string) bool {
+	return AuthenticateFrom(email, password, "") == nil
+}
+
+func checkPassword(email string, password string) bool {
 	user, err := database.FindUserByEmail(email)
 	if err != nil {
 		return false
@@ -47,8 +100,7 @@ func Authenticate(email string, password string) bool {
 		return result
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password))
-	result := err == nil
+	result := verifyPassword(user.HashedPassword, password)
 	cacheBcryptResult(cacheKey, result)
 	return result
 }
@@ -59,7 +111,7 @@ func AuthenticateHashed(email string, hashedPassword string) bool {
 		return false
 	}
 
-	if email == user.Email && hashedPassword == user.HashedPassword {
+	if email == user.Email && hashedPassword == user.HashedPassword && !user.Disabled && user.DeleteAt == 0 {
 		return true
 	}
 	return false
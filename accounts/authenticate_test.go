@@ -0,0 +1,120 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"angadrive/vars"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupAccounts starts every test on a fresh database with empty caches,
+// and makes Argon2id cheap enough to hash in every case.
+func setupAccounts(t *testing.T) {
+	t.Helper()
+	database.UserAccountsByEmail = make(map[string]database.Account)
+	database.UserAccountsByToken = make(map[string]database.Account)
+	database.SessionsByHash = make(map[string]database.Session)
+	database.APIKeysByHash = make(map[string]database.APIKey)
+	database.PendingDeletion = make(map[string]int64)
+	accountFailures = newFailureTracker(accountFailureAllowance)
+	sourceFailures = newFailureTracker(sourceFailureAllowance)
+
+	memory, iterations := vars.Argon2MemoryKB, vars.Argon2Iterations
+	vars.Argon2MemoryKB, vars.Argon2Iterations = 64, 1
+	t.Cleanup(func() { vars.Argon2MemoryKB, vars.Argon2Iterations = memory, iterations })
+
+	os.Setenv("SAVE_DRIVE_RAM", "true")
+	defer os.Unsetenv("SAVE_DRIVE_RAM")
+	if err := database.InitializeDatabase(t.TempDir()); err != nil {
+		t.Fatalf("InitializeDatabase failed: %v", err)
+	}
+}
+
+// insertTestAccount stores an account for email with hashedPassword as its hash.
+func insertTestAccount(t *testing.T, email string, hashedPassword string) database.Account {
+	t.Helper()
+	account := database.Account{Token: GenToken(), Email: email, DisplayName: "test", HashedPassword: hashedPassword}
+	if err := account.Insert(); err != nil {
+		t.Fatalf("insert account failed: %v", err)
+	}
+	return account
+}
+
+func insertAccountWithPassword(t *testing.T, email string, password string) database.Account {
+	t.Helper()
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return insertTestAccount(t, email, hash)
+}
+
+func TestAuthenticateLockout(t *testing.T) {
+	setupAccounts(t)
+	insertAccountWithPassword(t, "alice@example.com", "right-password")
+
+	for i := 0; i < accountFailureAllowance; i++ {
+		if err := AuthenticateFrom("alice@example.com", "wrong", "10.0.0.1"); err != ErrInvalidCredentials {
+			t.Fatalf("failure %d: got %v, want ErrInvalidCredentials", i, err)
+		}
+	}
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		source   string
+	}{
+		{"right password while locked", "alice@example.com", "right-password", "10.0.0.2"},
+		{"email in another case", "ALICE@example.com", "right-password", "10.0.0.2"},
+		{"wrong password while locked", "alice@example.com", "wrong", "10.0.0.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := AuthenticateFrom(tt.email, tt.password, tt.source).(LockoutError); !ok {
+				t.Error("expected a LockoutError")
+			}
+		})
+	}
+
+	// a source that only ever failed on other accounts locks everything tried from it
+	insertAccountWithPassword(t, "bob@example.com", "bobs-password")
+	for i := 0; i < sourceFailureAllowance; i++ {
+		AuthenticateFrom(strings.Repeat("x", i+1)+"@example.com", "wrong", "10.0.0.9")
+	}
+	if _, ok := AuthenticateFrom("bob@example.com", "bobs-password", "10.0.0.9").(LockoutError); !ok {
+		t.Error("expected the source to be locked")
+	}
+	if err := AuthenticateFrom("bob@example.com", "bobs-password", "10.0.0.10"); err != nil {
+		t.Errorf("bob couldn't log in from elsewhere: %v", err)
+	}
+}
+
+func TestLoginUpgradesLegacyHashes(t *testing.T) {
+	setupAccounts(t)
+	legacy, err := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertTestAccount(t, "legacy@example.com", string(legacy))
+
+	if _, err := LoginUser(LoginRequest{Email: "legacy@example.com", Password: "wrong"}); err == nil {
+		t.Fatal("logged in with the wrong password")
+	}
+	response, err := LoginUser(LoginRequest{Email: "legacy@example.com", Password: "old-password"})
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+	if !strings.HasPrefix(response.HashedPassword, "$argon2id$") {
+		t.Fatalf("hash wasn't upgraded: %s", response.HashedPassword)
+	}
+	var stored database.Account
+	if err := database.GetDB().Where("email = ?", "legacy@example.com").First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.HashedPassword != response.HashedPassword || !verifyPassword(stored.HashedPassword, "old-password") {
+		t.Error("the upgraded hash wasn't stored or doesn't match the password")
+	}
+}
@@ -2,19 +2,42 @@ package accounts
 
 import (
 	"angadrive/database"
+	"angadrive/vars"
 	"fmt"
+	"time"
 )
 
-func DeleteUser(RequestInfo DeleteUserRequest) ([]database.FileData, []database.Collection, error) {
-	if !Authenticate(RequestInfo.Email, RequestInfo.Password) {
-		return nil, nil, fmt.Errorf("invalid credentials")
+// DeleteUser schedules the account to be purged once the grace period is
+// over and logs it out everywhere. Its sessions are returned so their
+// connections can be told.
+func DeleteUser(RequestInfo DeleteUserRequest) (database.Account, []database.Session, error) {
+	err := AuthenticateWithCode(RequestInfo.Email, RequestInfo.Password, RequestInfo.TOTPCode, RequestInfo.Source)
+	if err != nil {
+		return database.Account{}, nil, err
+	}
+	user, err := database.FindUserByEmail(RequestInfo.Email)
+	if err != nil {
+		return database.Account{}, nil, fmt.Errorf("failed to find user: %v", err)
+	}
+	user, err = user.SetDeleteAt(time.Now().Add(vars.AccountDeletionGrace).Unix())
+	if err != nil {
+		return database.Account{}, nil, fmt.Errorf("failed to delete user: %v", err)
+	}
+	sessions, err := database.DeleteAccountSessions(user.Token)
+	if err != nil {
+		return user, nil, fmt.Errorf("account deleted but failed to end its sessions: %v", err)
+	}
+	return user, sessions, nil
+}
+
+// restoreAccount cancels the deletion of an account its owner just logged in to.
+func restoreAccount(account database.Account) (database.Account, bool, error) {
+	if account.DeleteAt == 0 {
+		return account, false, nil
 	}
-	user, _ := database.FindUserByEmail(RequestInfo.Email)
-	files, _ := database.GetUserFiles(user.Token)
-	collections, _ := user.GetCollections()
-	err := user.Delete()
+	account, err := account.SetDeleteAt(0)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to delete user: %v", err)
+		return account, false, fmt.Errorf("failed to restore account: %v", err)
 	}
-	return files, collections, nil
+	return account, true, nil
 }
@@ -0,0 +1,151 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// failed attempts allowed before back-off kicks in, an IP gets more since
+// several people can share one
+const accountFailureAllowance = 5
+const sourceFailureAllowance = 20
+
+// the first lockout lasts this long, every further failure doubles it
+const baseLockout = 30 * time.Second
+const maxLockout = time.Hour
+
+// failures are forgotten after this long without another one
+const failureWindow = 24 * time.Hour
+
+// a tracker holds at most this many keys, the one that failed longest ago
+// is dropped to make room. Flushing out someone's lockout takes that many
+// failures, which the source lockout slows down in turn.
+const maxTrackedFailures = 10000
+
+// OnLockout is called when an account gets locked, so its owner can be told.
+var OnLockout func(account database.Account, until time.Time)
+
+type LockoutError struct {
+	Until time.Time
+}
+
+func (e LockoutError) Error() string {
+	wait := time.Until(e.Until).Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return fmt.Sprintf("too many failed login attempts, try again in %s", wait)
+}
+
+type failureRecord struct {
+	key         string
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+type failureTracker struct {
+	mu        sync.Mutex
+	records   map[string]*list.Element // of *failureRecord
+	order     *list.List               // most recent failure first
+	allowance int
+}
+
+func newFailureTracker(allowance int) *failureTracker {
+	return &failureTracker{records: make(map[string]*list.Element), order: list.New(), allowance: allowance}
+}
+
+var accountFailures = newFailureTracker(accountFailureAllowance)
+var sourceFailures = newFailureTracker(sourceFailureAllowance)
+
+func (t *failureTracker) lockedUntil(key string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	element, ok := t.records[key]
+	if !ok {
+		return time.Time{}
+	}
+	return element.Value.(*failureRecord).lockedUntil
+}
+
+// fail records a failed attempt and returns the time key is locked until,
+// which is zero while it's still within its allowance.
+func (t *failureTracker) fail(key string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	var record *failureRecord
+	if element, ok := t.records[key]; ok {
+		record = element.Value.(*failureRecord)
+		t.order.MoveToFront(element)
+		if now.Sub(record.lastFailure) > failureWindow {
+			*record = failureRecord{key: key}
+		}
+	} else {
+		if t.order.Len() >= maxTrackedFailures {
+			oldest := t.order.Back()
+			t.order.Remove(oldest)
+			delete(t.records, oldest.Value.(*failureRecord).key)
+		}
+		record = &failureRecord{key: key}
+		t.records[key] = t.order.PushFront(record)
+	}
+	record.count++
+	record.lastFailure = now
+	if record.count < t.allowance {
+		return time.Time{}
+	}
+	lockout := maxLockout
+	if shift := record.count - t.allowance; shift < 8 {
+		lockout = min(baseLockout<<shift, maxLockout)
+	}
+	record.lockedUntil = now.Add(lockout)
+	return record.lockedUntil
+}
+
+func (t *failureTracker) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if element, ok := t.records[key]; ok {
+		t.order.Remove(element)
+		delete(t.records, key)
+	}
+}
+
+// checkLockout returns a LockoutError if the account or the source it's
+// being logged into from is locked.
+func checkLockout(email string, source string) error {
+	until := accountFailures.lockedUntil(strings.ToLower(email))
+	if source != "" {
+		if sourceUntil := sourceFailures.lockedUntil(source); sourceUntil.After(until) {
+			until = sourceUntil
+		}
+	}
+	if time.Now().Before(until) {
+		return LockoutError{Until: until}
+	}
+	return nil
+}
+
+func recordFailure(email string, source string) {
+	if source != "" {
+		sourceFailures.fail(source)
+	}
+	until := accountFailures.fail(strings.ToLower(email))
+	if until.IsZero() || OnLockout == nil {
+		return
+	}
+	if account, err := database.FindUserByEmail(email); err == nil {
+		go OnLockout(account, until)
+	}
+}
+
+// recordSuccess forgets the account's failures. The source keeps its count,
+// an attacker who owns one account shouldn't get to reset their budget with it.
+func recordSuccess(email string) {
+	accountFailures.reset(strings.ToLower(email))
+}
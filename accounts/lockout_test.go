@@ -0,0 +1,70 @@
+package accounts
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFailureTracker(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowance int
+		failures  int
+		locked    bool
+		lockout   time.Duration
+	}{
+		{"within allowance", 5, 4, false, 0},
+		{"first lockout", 5, 5, true, baseLockout},
+		{"doubles", 5, 7, true, 4 * baseLockout},
+		{"capped", 5, 30, true, maxLockout},
+		{"source allowance", sourceFailureAllowance, sourceFailureAllowance - 1, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newFailureTracker(tt.allowance)
+			var until time.Time
+			for i := 0; i < tt.failures; i++ {
+				until = tracker.fail("key")
+			}
+			if until.IsZero() == tt.locked {
+				t.Fatalf("locked = %v, want %v", !until.IsZero(), tt.locked)
+			}
+			if !tt.locked {
+				return
+			}
+			if got := time.Until(until).Round(time.Second); got != tt.lockout {
+				t.Errorf("locked for %s, want %s", got, tt.lockout)
+			}
+			if !tracker.lockedUntil("key").Equal(until) {
+				t.Error("lockedUntil doesn't match what fail returned")
+			}
+			tracker.reset("key")
+			if !tracker.lockedUntil("key").IsZero() {
+				t.Error("reset didn't forget the lockout")
+			}
+		})
+	}
+}
+
+func TestFailureTrackerIsBounded(t *testing.T) {
+	tracker := newFailureTracker(1)
+	tracker.fail("target")
+	for i := 0; i < maxTrackedFailures-1; i++ {
+		tracker.fail(fmt.Sprint("spray-", i))
+	}
+	// refreshed by a new failure, so it isn't the oldest anymore
+	tracker.fail("target")
+	for i := 0; i < 100; i++ {
+		tracker.fail(fmt.Sprint("more-", i))
+	}
+	if len(tracker.records) != maxTrackedFailures || tracker.order.Len() != maxTrackedFailures {
+		t.Errorf("tracker holds %d records (%d ordered), want %d", len(tracker.records), tracker.order.Len(), maxTrackedFailures)
+	}
+	if tracker.lockedUntil("target").IsZero() {
+		t.Error("the most recently failed key was evicted")
+	}
+	if _, ok := tracker.records["spray-0"]; ok {
+		t.Error("the oldest key wasn't evicted")
+	}
+}
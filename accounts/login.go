@@ -5,15 +5,43 @@ import (
 	"fmt"
 )
 
-func LoginUser(request LoginRequest) (database.Account, error) {
-
-	if Authenticate(request.Email, request.Password) {
-		user, err := database.FindUserByEmail(request.Email)
-		if err != nil {
-			return database.Account{}, err
-		}
-		return user, nil
+// LoginUser checks the credentials and starts a new session for the device.
+func LoginUser(request LoginRequest) (LoginResponse, error) {
+	err := AuthenticateWithCode(request.Email, request.Password, request.TOTPCode, request.Source)
+	if err != nil && err != ErrPendingDeletion {
+		return LoginResponse{}, err
+	}
+	user, err := database.FindUserByEmail(request.Email)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	user, restored, err := restoreAccount(user)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if needsRehash(user.HashedPassword) {
+		user = rehashPassword(user, request.Password)
 	}
+	sessionToken, err := NewSession(user, request.Device)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return LoginResponse{Account: user, SessionToken: sessionToken, Restored: restored}, nil
+}
 
-	return database.Account{}, fmt.Errorf("invalid credentials")
+// rehashPassword upgrades the stored hash of a password that was just
+// verified. The login goes ahead with the old hash if that fails.
+func rehashPassword(user database.Account, password string) database.Account {
+	hash, err := HashPassword(password)
+	if err != nil {
+		fmt.Printf("Warning: Failed to rehash password of %s: %v\n", user.Email, err)
+		return user
+	}
+	updated := user
+	updated.HashedPassword = hash
+	if err := user.Update(updated); err != nil {
+		fmt.Printf("Warning: Failed to store rehashed password of %s: %v\n", user.Email, err)
+		return user
+	}
+	return updated
 }
@@ -0,0 +1,198 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"angadrive/mailer"
+	"angadrive/vars"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const verifyEmailPurpose = "verify_email"
+const resetPasswordPurpose = "reset_password"
+
+const verifyEmailLifetime = 24 * time.Hour
+const resetPasswordLifetime = time.Hour
+
+// one mail of each kind per address per cooldown, so nobody gets mail bombed
+const mailCooldown = time.Minute
+
+var ErrInvalidMailToken = errors.New("this link is invalid or has expired")
+
+var lastMailSent = make(map[string]time.Time)
+var lastMailSentMutex sync.Mutex
+
+// mailTokenState is what a token of purpose is bound to. Once it changes,
+// like when the password it resets was reset, the token stops working, which
+// is what makes tokens single-use.
+func mailTokenState(purpose string, account database.Account) string {
+	if purpose == resetPasswordPurpose {
+		return account.HashedPassword
+	}
+	return strconv.FormatBool(account.EmailVerified)
+}
+
+func signMailToken(payload string, state string) []byte {
+	mac := hmac.New(sha256.New, vars.TokenSigningKey)
+	mac.Write([]byte(payload + "\n" + state))
+	return mac.Sum(nil)
+}
+
+func newMailToken(purpose string, account database.Account, lifetime time.Duration) string {
+	payload := purpose + "\n" + account.Email + "\n" + strconv.FormatInt(time.Now().Add(lifetime).Unix(), 10)
+	signature := signMailToken(payload, mailTokenState(purpose, account))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// parseMailToken returns the account a token of purpose was issued for.
+func parseMailToken(token string, purpose string) (database.Account, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return database.Account{}, ErrInvalidMailToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return database.Account{}, ErrInvalidMailToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return database.Account{}, ErrInvalidMailToken
+	}
+	parts := strings.Split(string(payload), "\n")
+	if len(parts) != 3 || parts[0] != purpose {
+		return database.Account{}, ErrInvalidMailToken
+	}
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return database.Account{}, ErrInvalidMailToken
+	}
+	account, err := database.FindUserByEmail(parts[1])
+	if err != nil {
+		return database.Account{}, ErrInvalidMailToken
+	}
+	if !hmac.Equal(signature, signMailToken(string(payload), mailTokenState(purpose, account))) {
+		return database.Account{}, ErrInvalidMailToken
+	}
+	return account, nil
+}
+
+// mailAllowed reports whether a mail of purpose may be sent to email now, and
+// if so counts it as sent.
+func mailAllowed(purpose string, email string) bool {
+	lastMailSentMutex.Lock()
+	defer lastMailSentMutex.Unlock()
+	now := time.Now()
+	if len(lastMailSent) >= maxTrackedFailures {
+		for key, sent := range lastMailSent {
+			if now.Sub(sent) > mailCooldown {
+				delete(lastMailSent, key)
+			}
+		}
+	}
+	key := purpose + "\n" + strings.ToLower(email)
+	if now.Sub(lastMailSent[key]) < mailCooldown {
+		return false
+	}
+	lastMailSent[key] = now
+	return true
+}
+
+// SendVerificationEmail mails account a link proving they own its address.
+func SendVerificationEmail(account database.Account) error {
+	if !mailer.Enabled() {
+		return mailer.ErrNotConfigured
+	}
+	if account.EmailVerified {
+		return fmt.Errorf("email is already verified")
+	}
+	if !mailAllowed(verifyEmailPurpose, account.Email) {
+		return fmt.Errorf("a verification mail was just sent, check your inbox")
+	}
+	link := vars.WebLink("/account?verify_email=" + url.QueryEscape(newMailToken(verifyEmailPurpose, account, verifyEmailLifetime)))
+	body := fmt.Sprintf("Hi %s,\n\nopen this link to verify the email address of your AngaDrive account:\n\n%s\n\nThe link works for 24 hours. If you didn't sign up, just ignore this mail.\n", account.DisplayName, link)
+	if err := mailer.Send(account.Email, "Verify your AngaDrive email", body); err != nil {
+		return fmt.Errorf("failed to send verification mail: %v", err)
+	}
+	return nil
+}
+
+// sendVerificationEmailInBackground is for flows that shouldn't fail or wait
+// because of the mail server.
+func sendVerificationEmailInBackground(account database.Account) {
+	if !mailer.Enabled() {
+		return
+	}
+	go func() {
+		if err := SendVerificationEmail(account); err != nil {
+			fmt.Printf("Warning: Failed to send verification mail to %s: %v\n", account.Email, err)
+		}
+	}()
+}
+
+func VerifyEmail(request VerifyEmailRequest) (string, error) {
+	account, err := parseMailToken(request.Token, verifyEmailPurpose)
+	if err != nil {
+		return "", err
+	}
+	if _, err := account.SetEmailVerified(true); err != nil {
+		return "", fmt.Errorf("failed to verify email: %v", err)
+	}
+	return "Email " + account.Email + " verified", nil
+}
+
+// RequestPasswordReset mails a reset link if an account uses the address.
+// The reply is the same either way, so it can't be used to find accounts.
+func RequestPasswordReset(request PasswordResetRequest) (string, error) {
+	if !mailer.Enabled() {
+		return "", mailer.ErrNotConfigured
+	}
+	reply := "If an account uses that email, a reset link is on its way"
+	account, err := database.FindUserByEmail(request.Email)
+	if err != nil || !mailAllowed(resetPasswordPurpose, account.Email) {
+		return reply, nil
+	}
+	link := vars.WebLink("/account?reset_password=" + url.QueryEscape(newMailToken(resetPasswordPurpose, account, resetPasswordLifetime)))
+	body := fmt.Sprintf("Hi %s,\n\nsomeone asked to reset the password of your AngaDrive account. Open this link to choose a new one:\n\n%s\n\nThe link works for an hour and only once. If it wasn't you, ignore this mail, your password stays as it is.\n", account.DisplayName, link)
+	// sent in the background, how long it takes would tell whether the account exists
+	go func() {
+		if err := mailer.Send(account.Email, "Reset your AngaDrive password", body); err != nil {
+			fmt.Printf("Warning: Failed to send password reset mail to %s: %v\n", account.Email, err)
+		}
+	}()
+	return reply, nil
+}
+
+// ResetPassword sets a new password with a token from a reset mail and ends
+// every session, like ChangeUserPassword. 2FA stays on.
+func ResetPassword(request ResetPasswordRequest) (string, error) {
+	if err := validatePassword(request.NewPassword); err != nil {
+		return "", err
+	}
+	account, err := parseMailToken(request.Token, resetPasswordPurpose)
+	if err != nil {
+		return "", err
+	}
+	hashedPassword, err := HashPassword(request.NewPassword)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	updated := account
+	updated.HashedPassword = hashedPassword
+	updated.EmailVerified = true // opening the mail proved the address is theirs
+	if err := account.Update(updated); err != nil {
+		return "", fmt.Errorf("failed to update password: %v", err)
+	}
+	recordSuccess(account.Email)
+	if _, err := database.DeleteAccountSessions(account.Token); err != nil {
+		return "", fmt.Errorf("password changed but failed to end sessions: %v", err)
+	}
+	return "Password reset, you can log in with the new one now", nil
+}
@@ -0,0 +1,88 @@
+package accounts
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMailToken(t *testing.T) {
+	setupAccounts(t)
+	account := insertAccountWithPassword(t, "mail@example.com", "password")
+	valid := newMailToken(resetPasswordPurpose, account, time.Hour)
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	// a token whose payload was edited to point at another account
+	insertAccountWithPassword(t, "victim@example.com", "password")
+	raw, _ := base64.RawURLEncoding.DecodeString(payload)
+	forged := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(raw), "mail@", "victim@", 1))) + "." + signature
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		ok      bool
+	}{
+		{"valid", valid, resetPasswordPurpose, true},
+		{"other purpose", valid, verifyEmailPurpose, false},
+		{"expired", newMailToken(resetPasswordPurpose, account, -time.Second), resetPasswordPurpose, false},
+		{"forged payload", forged, resetPasswordPurpose, false},
+		{"no signature", payload, resetPasswordPurpose, false},
+		{"bad base64", "!!!." + signature, resetPasswordPurpose, false},
+		{"empty", "", resetPasswordPurpose, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMailToken(tt.token, tt.purpose)
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && got.Token != account.Token {
+				t.Errorf("token was for %s", got.Email)
+			}
+		})
+	}
+}
+
+func TestMailTokensAreSingleUse(t *testing.T) {
+	setupAccounts(t)
+	account := insertAccountWithPassword(t, "reset@example.com", "password")
+
+	reset := newMailToken(resetPasswordPurpose, account, time.Hour)
+	if _, err := ResetPassword(ResetPasswordRequest{Token: reset, NewPassword: "new-password"}); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	// Update writes the caches in the background
+	time.Sleep(50 * time.Millisecond)
+	if _, err := ResetPassword(ResetPasswordRequest{Token: reset, NewPassword: "third-password"}); err != ErrInvalidMailToken {
+		t.Errorf("reset link worked twice: %v", err)
+	}
+	if err := AuthenticateFrom("reset@example.com", "new-password", ""); err != nil {
+		t.Errorf("new password doesn't work: %v", err)
+	}
+
+	// resetting already proved the address, so a fresh account
+	unverified := insertAccountWithPassword(t, "verify@example.com", "password")
+	verify := newMailToken(verifyEmailPurpose, unverified, time.Hour)
+	if _, err := VerifyEmail(VerifyEmailRequest{Token: verify}); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if _, err := VerifyEmail(VerifyEmailRequest{Token: verify}); err != ErrInvalidMailToken {
+		t.Errorf("verification link worked twice: %v", err)
+	}
+}
+
+func TestMailAllowed(t *testing.T) {
+	email := "cooldown-" + strconv.FormatInt(time.Now().UnixNano(), 10) + "@example.com"
+	if !mailAllowed(verifyEmailPurpose, email) {
+		t.Fatal("first mail was refused")
+	}
+	if mailAllowed(verifyEmailPurpose, strings.ToUpper(email)) {
+		t.Error("second mail within the cooldown was allowed")
+	}
+	if !mailAllowed(resetPasswordPurpose, email) {
+		t.Error("a mail of another kind was refused")
+	}
+}
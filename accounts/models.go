@@ -1,32 +1,86 @@
 package accounts
 
 type RegisterRequest struct {
-	DisplayName    string `json:"display_name" binding:"required"`
-	Email          string `json:"email" binding:"required,email"`
-	HashedPassword string `json:"hashed_password" binding:"required"`
+	DisplayName string `json:"display_name" binding:"required"`
+	Email       string `json:"email" binding:"required,email"`
+	Password    string `json:"password" binding:"required,min=3,max=64"`
+	Device      string `json:"device"`
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=3,max=64"`
+	Device   string `json:"device"`    // shown in the list of sessions
+	TOTPCode string `json:"totp_code"` // TOTP or recovery code, for accounts with 2FA
+	Source   string `json:"-"`         // client IP, filled in by the server
+}
+
+func (r *LoginRequest) SetSource(source string) {
+	r.Source = source
 }
 
 type DeleteUserRequest LoginRequest
 
+func (r *DeleteUserRequest) SetSource(source string) {
+	r.Source = source
+}
+
 type ChangePasswordRequest struct {
-	Email             string `json:"email" binding:"required,email"`
-	OldPassword       string `json:"old_password" binding:"required,min=3,max=64"`
-	NewPasswordHashed string `json:"new_password_hashed" binding:"required,min=3,max=64"`
+	Email       string `json:"email" binding:"required,email"`
+	OldPassword string `json:"old_password" binding:"required,min=3,max=64"`
+	NewPassword string `json:"new_password" binding:"required,min=3,max=64"`
+	TOTPCode    string `json:"totp_code"`
+	Source      string `json:"-"`
+}
+
+func (r *ChangePasswordRequest) SetSource(source string) {
+	r.Source = source
 }
 
 type ChangeEmailRequest struct {
 	OldEmail string `json:"old_email" binding:"required,email"`
 	NewEmail string `json:"new_email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=3,max=64"`
+	TOTPCode string `json:"totp_code"`
+	Source   string `json:"-"`
+}
+
+func (r *ChangeEmailRequest) SetSource(source string) {
+	r.Source = source
 }
 
 type ChangeDisplayNameRequest struct {
 	DisplayName string `json:"display_name" binding:"required"`
 	Email       string `json:"email" binding:"required,email"`
 	Password    string `json:"password" binding:"required,min=3,max=64"`
+	TOTPCode    string `json:"totp_code"`
+	Source      string `json:"-"`
+}
+
+func (r *ChangeDisplayNameRequest) SetSource(source string) {
+	r.Source = source
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=3,max=64"`
+}
+
+type OIDCLoginRequest struct {
+	Ticket   string `json:"ticket" binding:"required"`
+	Device   string `json:"device"`
+	TOTPCode string `json:"totp_code"`
+	Source   string `json:"-"`
+}
+
+func (r *OIDCLoginRequest) SetSource(source string) {
+	r.Source = source
 }
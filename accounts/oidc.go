@@ -0,0 +1,305 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"angadrive/vars"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// time someone gets at the identity provider before the login has to be restarted
+const oidcFlowLifetime = 10 * time.Minute
+
+// OIDCFlowLifetime is how long the browser has to keep the binding of a login.
+const OIDCFlowLifetime = oidcFlowLifetime
+
+// the callback hands the browser a ticket instead of a session token, so the
+// token never ends up in the URL bar or history. It's traded in over the
+// websocket right after.
+const oidcTicketLifetime = 2 * time.Minute
+
+const oidcDiscoveryTimeout = 10 * time.Second
+
+var ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+var ErrInvalidOIDCLogin = errors.New("this login attempt is invalid or has expired, please try again")
+
+type OIDCProviderInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type oidcClient struct {
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+type oidcFlow struct {
+	providerID string
+	verifier   string // PKCE code verifier
+	nonce      string
+	expires    time.Time
+}
+
+type oidcTicket struct {
+	accountToken string
+	expires      time.Time
+}
+
+var oidcClients = make(map[string]*oidcClient)
+var oidcClientsMutex sync.Mutex
+
+var oidcFlows = make(map[string]oidcFlow) // by state
+var oidcTickets = make(map[string]oidcTicket)
+var oidcMutex sync.Mutex
+
+func OIDCProviders() []OIDCProviderInfo {
+	providers := []OIDCProviderInfo{}
+	for _, provider := range vars.OIDCProviders {
+		providers = append(providers, OIDCProviderInfo{ID: provider.ID, Name: provider.Name})
+	}
+	return providers
+}
+
+func findOIDCProvider(id string) (vars.OIDCProvider, error) {
+	for _, provider := range vars.OIDCProviders {
+		if provider.ID == id {
+			return provider, nil
+		}
+	}
+	return vars.OIDCProvider{}, ErrUnknownOIDCProvider
+}
+
+// getOIDCClient discovers the provider's endpoints and keys the first time
+// it's used. Failures aren't cached, the provider may just be down for now.
+func getOIDCClient(provider vars.OIDCProvider) (*oidcClient, error) {
+	oidcClientsMutex.Lock()
+	defer oidcClientsMutex.Unlock()
+	if client, ok := oidcClients[provider.ID]; ok {
+		return client, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), oidcDiscoveryTimeout)
+	defer cancel()
+	discovered, err := oidc.NewProvider(ctx, provider.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %v", provider.Name, err)
+	}
+	client := &oidcClient{
+		config: oauth2.Config{
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			Endpoint:     discovered.Endpoint(),
+			RedirectURL:  vars.WebLink("/auth/oidc/" + provider.ID + "/callback"),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: discovered.Verifier(&oidc.Config{ClientID: provider.ClientID}),
+	}
+	oidcClients[provider.ID] = client
+	return client, nil
+}
+
+func pruneOIDCState(now time.Time) {
+	for state, flow := range oidcFlows {
+		if now.After(flow.expires) {
+			delete(oidcFlows, state)
+		}
+	}
+	for hash, ticket := range oidcTickets {
+		if now.After(ticket.expires) {
+			delete(oidcTickets, hash)
+		}
+	}
+}
+
+// BeginOIDCLogin returns the URL of the provider's login page, and the
+// binding the browser has to keep (in a cookie) and hand back to
+// CompleteOIDCLogin. Without it anyone could send a victim the callback link
+// of a login they started, logging the victim in to the attacker's account.
+func BeginOIDCLogin(providerID string) (string, string, error) {
+	provider, err := findOIDCProvider(providerID)
+	if err != nil {
+		return "", "", err
+	}
+	client, err := getOIDCClient(provider)
+	if err != nil {
+		return "", "", err
+	}
+	state := randomString(24)
+	flow := oidcFlow{
+		providerID: provider.ID,
+		verifier:   oauth2.GenerateVerifier(),
+		nonce:      randomString(24),
+		expires:    time.Now().Add(oidcFlowLifetime),
+	}
+	oidcMutex.Lock()
+	pruneOIDCState(time.Now())
+	oidcFlows[state] = flow
+	oidcMutex.Unlock()
+	authURL := client.config.AuthCodeURL(state, oidc.Nonce(flow.nonce), oauth2.S256ChallengeOption(flow.verifier))
+	return authURL, hashSessionToken(state), nil
+}
+
+// CompleteOIDCLogin handles the provider's redirect back, and returns a
+// ticket OIDCLogin takes to start the session. binding is what
+// BeginOIDCLogin returned to the browser that started the login.
+func CompleteOIDCLogin(ctx context.Context, providerID string, state string, binding string, code string) (string, error) {
+	if subtle.ConstantTimeCompare([]byte(hashSessionToken(state)), []byte(binding)) != 1 {
+		return "", ErrInvalidOIDCLogin
+	}
+	oidcMutex.Lock()
+	flow, ok := oidcFlows[state]
+	delete(oidcFlows, state)
+	oidcMutex.Unlock()
+	if !ok || flow.providerID != providerID || time.Now().After(flow.expires) {
+		return "", ErrInvalidOIDCLogin
+	}
+	provider, err := findOIDCProvider(providerID)
+	if err != nil {
+		return "", err
+	}
+	client, err := getOIDCClient(provider)
+	if err != nil {
+		return "", err
+	}
+	token, err := client.config.Exchange(ctx, code, oauth2.VerifierOption(flow.verifier))
+	if err != nil {
+		return "", fmt.Errorf("%s rejected the login: %v", provider.Name, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", fmt.Errorf("%s sent no ID token", provider.Name)
+	}
+	idToken, err := client.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return "", fmt.Errorf("invalid ID token from %s: %v", provider.Name, err)
+	}
+	if idToken.Nonce != flow.nonce {
+		return "", ErrInvalidOIDCLogin
+	}
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"` // some providers send "true" instead of true
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return "", fmt.Errorf("invalid ID token from %s: %v", provider.Name, err)
+	}
+	emailVerified := claims.EmailVerified == true || claims.EmailVerified == "true"
+	account, err := linkOIDCAccount(provider, idToken.Issuer, idToken.Subject, claims.Email, emailVerified, claims.Name)
+	if err != nil {
+		return "", err
+	}
+
+	ticket := randomString(32)
+	oidcMutex.Lock()
+	oidcTickets[hashSessionToken(ticket)] = oidcTicket{
+		accountToken: account.Token,
+		expires:      time.Now().Add(oidcTicketLifetime),
+	}
+	oidcMutex.Unlock()
+	return ticket, nil
+}
+
+// linkOIDCAccount finds the account of someone the provider vouched for. The
+// first login links by email, which both sides must have verified, otherwise
+// whoever registered an address first could take over its owner's logins.
+func linkOIDCAccount(provider vars.OIDCProvider, issuer string, subject string, email string, emailVerified bool, name string) (database.Account, error) {
+	if account, err := database.FindOIDCAccount(issuer, subject); err == nil {
+		return account, nil
+	}
+	if email == "" || !emailVerified {
+		return database.Account{}, fmt.Errorf("%s didn't confirm an email address for you", provider.Name)
+	}
+	identity := database.OIDCIdentity{
+		Issuer:    issuer,
+		Subject:   subject,
+		CreatedAt: time.Now().Unix(),
+	}
+	account, err := database.FindUserByEmail(email)
+	if err == nil {
+		if !account.EmailVerified {
+			return database.Account{}, fmt.Errorf("verify the email of your account before logging in with %s", provider.Name)
+		}
+		identity.AccountToken = account.Token
+		if err := identity.Insert(); err != nil {
+			return database.Account{}, fmt.Errorf("failed to link account: %v", err)
+		}
+		return account, nil
+	}
+	if !provider.AutoProvision {
+		return database.Account{}, fmt.Errorf("no account uses %s, register first", email)
+	}
+
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	// no password, one can be set through a password reset
+	account = database.Account{
+		Token:         GenToken(),
+		DisplayName:   name,
+		Email:         email,
+		EmailVerified: true,
+	}
+	if err := account.Insert(); err != nil {
+		return database.Account{}, fmt.Errorf("failed to create account: %v", err)
+	}
+	identity.AccountToken = account.Token
+	if err := identity.Insert(); err != nil {
+		return database.Account{}, fmt.Errorf("failed to link account: %v", err)
+	}
+	return account, nil
+}
+
+// OIDCLogin trades a ticket from CompleteOIDCLogin for a session. The
+// provider stands in for the password, accounts with 2FA still need a code.
+// The ticket survives a missing or wrong code, so the user can retry.
+func OIDCLogin(request OIDCLoginRequest) (LoginResponse, error) {
+	hash := hashSessionToken(request.Ticket)
+	oidcMutex.Lock()
+	ticket, ok := oidcTickets[hash]
+	oidcMutex.Unlock()
+	if !ok || time.Now().After(ticket.expires) {
+		return LoginResponse{}, ErrInvalidOIDCLogin
+	}
+	account, err := database.FindUserByToken(ticket.accountToken)
+	if err != nil {
+		return LoginResponse{}, ErrInvalidOIDCLogin
+	}
+	if err := checkLockout(account.Email, request.Source); err != nil {
+		return LoginResponse{}, err
+	}
+	if account.TOTPEnabled {
+		if request.TOTPCode == "" {
+			return LoginResponse{}, ErrTwoFactorRequired
+		}
+		if err := consumeSecondFactor(account, request.TOTPCode); err != nil {
+			recordFailure(account.Email, request.Source)
+			return LoginResponse{}, err
+		}
+	}
+
+	oidcMutex.Lock()
+	_, ok = oidcTickets[hash]
+	delete(oidcTickets, hash)
+	oidcMutex.Unlock()
+	if !ok {
+		return LoginResponse{}, ErrInvalidOIDCLogin
+	}
+	recordSuccess(account.Email)
+	account, restored, err := restoreAccount(account)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	sessionToken, err := NewSession(account, request.Device)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return LoginResponse{Account: account, SessionToken: sessionToken, Restored: restored}, nil
+}
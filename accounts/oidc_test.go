@@ -0,0 +1,45 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCompleteOIDCLoginChecksBinding(t *testing.T) {
+	state := "state-of-a-login"
+	startFlow := func() {
+		oidcMutex.Lock()
+		oidcFlows[state] = oidcFlow{providerID: "missing", expires: time.Now().Add(oidcFlowLifetime)}
+		oidcMutex.Unlock()
+	}
+
+	tests := []struct {
+		name    string
+		binding string
+		// the flow is only consumed once the binding matched, the unknown
+		// provider then fails the login further on
+		bound bool
+	}{
+		{"no cookie", "", false},
+		{"cookie of another login", hashSessionToken("state-of-another-login"), false},
+		{"the state itself", state, false},
+		{"matching cookie", hashSessionToken(state), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startFlow()
+			_, err := CompleteOIDCLogin(context.Background(), "missing", state, tt.binding, "code")
+			if bound := !errors.Is(err, ErrInvalidOIDCLogin); bound != tt.bound {
+				t.Errorf("got %v, want the binding to match: %v", err, tt.bound)
+			}
+			oidcMutex.Lock()
+			_, pending := oidcFlows[state]
+			oidcMutex.Unlock()
+			if pending == tt.bound {
+				t.Errorf("flow pending = %v after the attempt", pending)
+			}
+		})
+	}
+}
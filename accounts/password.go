@@ -0,0 +1,123 @@
+package accounts
+
+import (
+	"angadrive/vars"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const argon2SaltLength = 16
+const argon2KeyLength = 32
+
+const minPasswordLength = 3
+const maxPasswordLength = 64
+
+// at most this much memory goes to Argon2id at once, logins past that wait
+// for a slot instead of letting a burst of them exhaust the server's memory
+const argon2MemoryBudgetKB = 256 * 1024
+
+var argon2Limiter = make(chan struct{}, argon2Slots())
+
+// argon2Slots is how many derivations with the configured cost fit the
+// budget, always at least one.
+func argon2Slots() int {
+	return max(1, int(argon2MemoryBudgetKB/vars.Argon2MemoryKB))
+}
+
+// argon2Key is argon2.IDKey behind argon2Limiter.
+func argon2Key(password []byte, salt []byte, params argon2Params, keyLength uint32) []byte {
+	argon2Limiter <- struct{}{}
+	defer func() { <-argon2Limiter }()
+	return argon2.IDKey(password, salt, params.iterations, params.memory, params.parallelism, keyLength)
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func currentArgon2Params() argon2Params {
+	return argon2Params{
+		memory:      vars.Argon2MemoryKB,
+		iterations:  vars.Argon2Iterations,
+		parallelism: vars.Argon2Parallelism,
+	}
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Errorf("password must be between %d and %d characters", minPasswordLength, maxPasswordLength)
+	}
+	return nil
+}
+
+// HashPassword hashes a plaintext password with Argon2id, encoded in the
+// usual $argon2id$v=19$m=...,t=...,p=...$salt$hash form.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	params := currentArgon2Params()
+	key := argon2Key([]byte(password), salt, params, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.memory, params.iterations, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decodeArgon2Hash(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("not an argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters: %v", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+// verifyPassword checks password against an Argon2id hash, or a bcrypt hash
+// from when the browser did the hashing.
+func verifyPassword(hash string, password string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2Hash(hash)
+		if err != nil {
+			return false
+		}
+		candidate := argon2Key([]byte(password), salt, params, uint32(len(key)))
+		return subtle.ConstantTimeCompare(candidate, key) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// needsRehash reports whether hash is a legacy bcrypt hash or was made
+// with different Argon2id parameters than the configured ones.
+func needsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+	return params != currentArgon2Params()
+}
@@ -0,0 +1,47 @@
+package accounts
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	setupAccounts(t)
+	argon, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		valid    bool
+		rehash   bool
+	}{
+		{"argon2id", argon, "password", true, false},
+		{"argon2id wrong password", argon, "passwort", false, false},
+		{"legacy bcrypt", string(legacy), "password", true, true},
+		{"legacy bcrypt wrong password", string(legacy), "passwort", false, true},
+		{"other argon2 cost", "$argon2id$v=19$m=32,t=1,p=1$c2FsdHNhbHRzYWx0$aGFzaA", "password", false, true},
+		{"wrong argon2 version", "$argon2id$v=16$m=64,t=1,p=4$c2FsdA$aGFzaA", "password", false, true},
+		{"garbage parameters", "$argon2id$v=19$m=x,t=1,p=4$c2FsdA$aGFzaA", "password", false, true},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=4$!!!$aGFzaA", "password", false, true},
+		{"empty", "", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPassword(tt.hash, tt.password); got != tt.valid {
+				t.Errorf("verifyPassword = %v, want %v", got, tt.valid)
+			}
+			if got := needsRehash(tt.hash); got != tt.rehash {
+				t.Errorf("needsRehash = %v, want %v", got, tt.rehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"angadrive/vars"
+	"fmt"
+)
+
+// UnlimitedStorageQuota is the quota an admin sets for an account to lift its limit.
+const UnlimitedStorageQuota int64 = -1
+
+// StorageQuota returns how many bytes of files token can own, 0 for no
+// limit. Guests get the default quota.
+func StorageQuota(token string) int64 {
+	account, err := database.FindUserByToken(token)
+	if err != nil || account.StorageQuota == 0 {
+		return vars.DefaultStorageQuota
+	}
+	if account.StorageQuota < 0 {
+		return 0
+	}
+	return account.StorageQuota
+}
+
+// CheckStorageQuota fails if adding size bytes would take token over its quota.
+func CheckStorageQuota(token string, size int64) error {
+	quota := StorageQuota(token)
+	if quota == 0 {
+		return nil
+	}
+	_, used, err := database.GetStorageUsed(token)
+	if err != nil {
+		return fmt.Errorf("failed to check storage quota: %v", err)
+	}
+	if used+size > quota {
+		return fmt.Errorf("storage quota exceeded, %d of %d MB used", used/1024/1024, quota/1024/1024)
+	}
+	return nil
+}
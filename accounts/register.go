@@ -38,22 +38,34 @@ func GenToken() string { // Sample Output: "VcW90bRMW8.HLrITln50boVlu5Sw3eI.1747
 	return string(part1) + "." + string(part2) + "." + fmt.Sprintf("%d", timestamp)
 }
 
-func RegisterUser(RequestInfo RegisterRequest) (database.Account, error) {
+func RegisterUser(RequestInfo RegisterRequest) (LoginResponse, error) {
 	_, err := database.FindUserByEmail(RequestInfo.Email)
 	if err == nil {
-		return database.Account{}, fmt.Errorf("email already exists")
+		return LoginResponse{}, fmt.Errorf("email already exists")
+	}
+	if err := validatePassword(RequestInfo.Password); err != nil {
+		return LoginResponse{}, err
+	}
+	hashedPassword, err := HashPassword(RequestInfo.Password)
+	if err != nil {
+		return LoginResponse{}, fmt.Errorf("failed to hash password: %v", err)
 	}
 
 	NewUser := database.Account{
 		Token:          GenToken(),
 		DisplayName:    RequestInfo.DisplayName,
 		Email:          RequestInfo.Email,
-		HashedPassword: RequestInfo.HashedPassword,
+		HashedPassword: hashedPassword,
 	}
 	err = NewUser.Insert()
 	if err != nil {
-		return database.Account{}, fmt.Errorf("failed to insert new user: %v", err)
+		return LoginResponse{}, fmt.Errorf("failed to insert new user: %v", err)
+	}
+	sessionToken, err := NewSession(NewUser, RequestInfo.Device)
+	if err != nil {
+		return LoginResponse{}, err
 	}
+	sendVerificationEmailInBackground(NewUser)
 
-	return NewUser, nil
+	return LoginResponse{Account: NewUser, SessionToken: sessionToken}, nil
 }
@@ -0,0 +1,17 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"fmt"
+)
+
+// RotateToken gives the account a new token, for when the old one was shown
+// somewhere it shouldn't have been. The session keepSessionID stays logged
+// in, every other session is ended.
+func RotateToken(account database.Account, keepSessionID string) (database.Account, error) {
+	rotated, err := account.RotateToken(GenToken(), keepSessionID)
+	if err != nil {
+		return account, fmt.Errorf("failed to rotate token: %v", err)
+	}
+	return rotated, nil
+}
@@ -0,0 +1,127 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sessions expire after this long without being used
+const sessionLifetime = 30 * 24 * time.Hour
+
+// last_used is only written back this often, not on every message
+const sessionTouchInterval = time.Hour
+
+// session tokens carry this prefix so they can't be mistaken for the random
+// tokens guests own their files with
+const sessionTokenPrefix = "session_"
+
+const maxDeviceLength = 128
+
+type LoginResponse struct {
+	database.Account
+	SessionToken string `json:"session_token"`
+	Restored     bool   `json:"restored,omitempty"` // the login cancelled the account's deletion
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		fmt.Println("Error generating random bytes in accounts.sessions.randomString:", err)
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// NewSession logs account in on a new device and returns the session's bearer token.
+func NewSession(account database.Account, device string) (string, error) {
+	if account.Disabled {
+		return "", ErrAccountDisabled
+	}
+	if len(device) > maxDeviceLength {
+		device = device[:maxDeviceLength]
+	}
+	token := sessionTokenPrefix + randomString(32)
+	now := time.Now()
+	session := database.Session{
+		ID:           randomString(12),
+		TokenHash:    hashSessionToken(token),
+		AccountToken: account.Token,
+		Device:       device,
+		CreatedAt:    now.Unix(),
+		LastUsed:     now.Unix(),
+		ExpiresAt:    now.Add(sessionLifetime).Unix(),
+	}
+	if err := session.Insert(); err != nil {
+		return "", fmt.Errorf("failed to create session: %v", err)
+	}
+	return token, nil
+}
+
+func IsSessionToken(token string) bool {
+	return strings.HasPrefix(token, sessionTokenPrefix)
+}
+
+// FindSession returns the live session a bearer token belongs to, and keeps it alive.
+func FindSession(token string) (database.Session, error) {
+	session, err := database.FindSessionByHash(hashSessionToken(token))
+	if err != nil {
+		return database.Session{}, fmt.Errorf("session expired or revoked")
+	}
+	now := time.Now()
+	if now.Unix() > session.ExpiresAt {
+		session.Delete()
+		return database.Session{}, fmt.Errorf("session expired or revoked")
+	}
+	if now.Sub(time.Unix(session.LastUsed, 0)) > sessionTouchInterval {
+		if touched, err := session.Touch(now.Unix(), now.Add(sessionLifetime).Unix()); err == nil {
+			session = touched
+		}
+	}
+	return session, nil
+}
+
+// ResolveToken turns the token a client authenticated with into the token
+// that owns its files. Session tokens resolve to their account, API keys are
+// refused (they go through AuthorizeAPIKey), anything else is a guest's own token. Account tokens are not credentials, they are
+// shown to anyone who can see the account's files.
+func ResolveToken(token string) (string, error) {
+	if IsSessionToken(token) {
+		session, err := FindSession(token)
+		if err != nil {
+			return "", err
+		}
+		return session.AccountToken, nil
+	}
+	if IsAPIKey(token) {
+		return "", fmt.Errorf("API keys can't be used for this")
+	}
+	if _, err := database.FindUserByToken(token); err == nil {
+		return "", fmt.Errorf("account tokens can't be used to authenticate, log in instead")
+	}
+	return token, nil
+}
+
+// RevokeSession logs out a single session of the account.
+func RevokeSession(accountToken string, sessionID string) (database.Session, error) {
+	sessions, err := database.GetAccountSessions(accountToken)
+	if err != nil {
+		return database.Session{}, err
+	}
+	for _, session := range sessions {
+		if session.ID == sessionID {
+			return session, session.Delete()
+		}
+	}
+	return database.Session{}, fmt.Errorf("session not found")
+}
@@ -0,0 +1,93 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"testing"
+	"time"
+)
+
+func TestResolveToken(t *testing.T) {
+	setupAccounts(t)
+	account := insertAccountWithPassword(t, "sessions@example.com", "password")
+	session, err := NewSession(account, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := NewSession(account, "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, _ := database.GetAccountSessions(account.Token)
+	for _, s := range sessions {
+		if s.Device == "phone" {
+			RevokeSession(account.Token, s.ID)
+		}
+	}
+	expired := sessionTokenPrefix + "expired"
+	database.Session{
+		ID:           "expired",
+		TokenHash:    hashSessionToken(expired),
+		AccountToken: account.Token,
+		ExpiresAt:    time.Now().Add(-time.Minute).Unix(),
+	}.Insert()
+	key, err := CreateAPIKey(account.Token, "script", []string{ScopeReadFiles}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+		ok    bool
+	}{
+		{"session", session, account.Token, true},
+		{"revoked session", revoked, "", false},
+		{"expired session", expired, "", false},
+		{"made up session", sessionTokenPrefix + "made-up", "", false},
+		// anyone who can see the account's files knows its token
+		{"account token", account.Token, "", false},
+		{"API key", key.Key, "", false},
+		{"guest token", "guest.token.1", "guest.token.1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveToken(tt.token)
+			if (err == nil) != tt.ok || got != tt.want {
+				t.Errorf("got %q, %v; want %q, ok %v", got, err, tt.want, tt.ok)
+			}
+		})
+	}
+
+	if _, err := database.FindSessionByHash(hashSessionToken(expired)); err == nil {
+		t.Error("expired session wasn't deleted when it was used")
+	}
+}
+
+func TestNewSession(t *testing.T) {
+	setupAccounts(t)
+	account := insertAccountWithPassword(t, "device@example.com", "password")
+	long := make([]byte, maxDeviceLength*2)
+	for i := range long {
+		long[i] = 'a'
+	}
+	token, err := NewSession(account, string(long))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSessionToken(token) || IsAPIKey(token) {
+		t.Errorf("%q doesn't look like a session token", token)
+	}
+	session, err := FindSession(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Device) != maxDeviceLength || session.TokenHash == token {
+		t.Errorf("device %d long, hash %q", len(session.Device), session.TokenHash)
+	}
+
+	account.Disabled = true
+	if _, err := NewSession(account, "laptop"); err != ErrAccountDisabled {
+		t.Errorf("got %v for a disabled account, want ErrAccountDisabled", err)
+	}
+}
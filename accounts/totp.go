@@ -0,0 +1,233 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// RFC 6238 defaults, the only ones every authenticator app supports
+const totpPeriod = 30
+const totpDigits = 6
+
+// codes from one step before or after the current one are accepted, for clock drift
+const totpSkew = 1
+
+const totpIssuer = "AngaDrive"
+const recoveryCodeCount = 10
+
+var ErrTwoFactorRequired = errors.New("two-factor code required")
+var ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+var secondFactorMutex sync.Mutex
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`     // otpauth:// provisioning URI
+	QRCode string `json:"qr_code"` // the URI as a PNG data URL
+}
+
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchTOTP returns the time step code is valid for, or 0 if it isn't valid
+// for any step after lastStep.
+func matchTOTP(secret string, code string, lastStep int64) int64 {
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0
+	}
+	now := time.Now().Unix() / totpPeriod
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return 0
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRecoveryCodes returns fresh codes to show the user once, and the hashes to store.
+func newRecoveryCodes() ([]string, string) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			fmt.Println("Error generating random bytes in accounts.totp.newRecoveryCodes:", err)
+			panic(err)
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, strings.Join(hashes, ",")
+}
+
+// consumeSecondFactor checks a TOTP or recovery code of account and uses it
+// up, so the same code can't be replayed.
+func consumeSecondFactor(account database.Account, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrTwoFactorRequired
+	}
+	// two requests racing with the same code must not both get in
+	secondFactorMutex.Lock()
+	defer secondFactorMutex.Unlock()
+	account, err := database.FindUserByToken(account.Token)
+	if err != nil {
+		return err
+	}
+	if step := matchTOTP(account.TOTPSecret, code, account.TOTPLastStep); step != 0 {
+		_, err := account.SetTOTP(account.TOTPSecret, true, step, account.RecoveryCodes)
+		return err
+	}
+	hash := hashRecoveryCode(code)
+	remaining := []string{}
+	found := false
+	for _, stored := range strings.Split(account.RecoveryCodes, ",") {
+		if !found && stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			found = true
+			continue
+		}
+		if stored != "" {
+			remaining = append(remaining, stored)
+		}
+	}
+	if !found {
+		return ErrInvalidTwoFactorCode
+	}
+	_, err = account.SetTOTP(account.TOTPSecret, true, account.TOTPLastStep, strings.Join(remaining, ","))
+	return err
+}
+
+// BeginTOTPEnrollment generates a new secret for account. It only takes
+// effect once ConfirmTOTPEnrollment sees a code generated from it.
+func BeginTOTPEnrollment(account database.Account) (TOTPEnrollment, error) {
+	if account.TOTPEnabled {
+		return TOTPEnrollment{}, fmt.Errorf("two-factor authentication is already enabled")
+	}
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return TOTPEnrollment{}, err
+	}
+	secret := base32NoPadding.EncodeToString(key)
+	if _, err := account.SetTOTP(secret, false, 0, ""); err != nil {
+		return TOTPEnrollment{}, fmt.Errorf("failed to store secret: %v", err)
+	}
+
+	label := url.PathEscape(totpIssuer + ":" + account.Email)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("period", fmt.Sprint(totpPeriod))
+	params.Set("digits", fmt.Sprint(totpDigits))
+	uri := "otpauth://totp/" + label + "?" + params.Encode()
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return TOTPEnrollment{}, fmt.Errorf("failed to generate QR code: %v", err)
+	}
+	return TOTPEnrollment{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment turns on 2FA once the user proves their app has the
+// secret, and returns the recovery codes.
+func ConfirmTOTPEnrollment(account database.Account, code string) ([]string, error) {
+	if account.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+	if account.TOTPSecret == "" {
+		return nil, fmt.Errorf("two-factor enrollment was not started")
+	}
+	step := matchTOTP(account.TOTPSecret, strings.TrimSpace(code), 0)
+	if step == 0 {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	codes, hashes := newRecoveryCodes()
+	if _, err := account.SetTOTP(account.TOTPSecret, true, step, hashes); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+	}
+	return codes, nil
+}
+
+// guardedSecondFactor is consumeSecondFactor for requests made from a
+// session, whose codes count towards the lockout like those at login.
+func guardedSecondFactor(account database.Account, code string, source string) error {
+	if err := checkLockout(account.Email, source); err != nil {
+		return err
+	}
+	if err := consumeSecondFactor(account, code); err != nil {
+		recordFailure(account.Email, source)
+		return err
+	}
+	return nil
+}
+
+// DisableTOTP turns off 2FA, source is the client IP of the request.
+func DisableTOTP(account database.Account, code string, source string) error {
+	if !account.TOTPEnabled {
+		return fmt.Errorf("two-factor authentication is not enabled")
+	}
+	if err := guardedSecondFactor(account, code, source); err != nil {
+		return err
+	}
+	_, err := account.SetTOTP("", false, 0, "")
+	return err
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of account.
+func RegenerateRecoveryCodes(account database.Account, code string, source string) ([]string, error) {
+	if !account.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is not enabled")
+	}
+	if err := guardedSecondFactor(account, code, source); err != nil {
+		return nil, err
+	}
+	// consuming the code changed the account
+	account, err := database.FindUserByToken(account.Token)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes := newRecoveryCodes()
+	if _, err := account.SetTOTP(account.TOTPSecret, true, account.TOTPLastStep, hashes); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %v", err)
+	}
+	return codes, nil
+}
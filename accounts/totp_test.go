@@ -0,0 +1,183 @@
+package accounts
+
+import (
+	"angadrive/database"
+	"strings"
+	"testing"
+	"time"
+)
+
+// enableTestTOTP turns on 2FA for account and returns its secret and recovery codes.
+func enableTestTOTP(t *testing.T, account database.Account) (string, []string) {
+	t.Helper()
+	enrollment, err := BeginTOTPEnrollment(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, _ = database.FindUserByToken(account.Token)
+	// the confirmation code is used up, the tests start a step earlier so
+	// the current code is still good
+	key, _ := base32NoPadding.DecodeString(enrollment.Secret)
+	codes, err := ConfirmTOTPEnrollment(account, totpCode(key, time.Now().Unix()/totpPeriod-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enrollment.Secret, codes
+}
+
+func codeAt(secret string, offset int64) string {
+	key, _ := base32NoPadding.DecodeString(secret)
+	return totpCode(key, time.Now().Unix()/totpPeriod+offset)
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(secret, tt.unix/totpPeriod); got != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret := base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Now().Unix() / totpPeriod
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		step     int64
+	}{
+		{"current", codeAt(secret, 0), 0, now},
+		{"previous step", codeAt(secret, -1), 0, now - 1},
+		{"next step", codeAt(secret, 1), 0, now + 1},
+		{"too old", codeAt(secret, -2), 0, 0},
+		{"already used", codeAt(secret, 0), now, 0},
+		{"earlier than the last used", codeAt(secret, -1), now, 0},
+		{"wrong length", codeAt(secret, 0)[:5], 0, 0},
+		{"not digits", "abcdef", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchTOTP(secret, tt.code, tt.lastStep); got != tt.step {
+				t.Errorf("matchTOTP = %d, want %d", got, tt.step)
+			}
+		})
+	}
+	if got := matchTOTP("not base32!", codeAt(secret, 0), 0); got != 0 {
+		t.Error("matched a code against a broken secret")
+	}
+}
+
+func TestConsumeSecondFactor(t *testing.T) {
+	setupAccounts(t)
+	account := insertAccountWithPassword(t, "totp@example.com", "password")
+	secret, recoveryCodes := enableTestTOTP(t, account)
+
+	tests := []struct {
+		name string
+		code string
+		err  error
+	}{
+		{"empty", " ", ErrTwoFactorRequired},
+		{"current code", codeAt(secret, 0), nil},
+		{"replayed code", codeAt(secret, 0), ErrInvalidTwoFactorCode},
+		{"code older than the last one", codeAt(secret, -1), ErrInvalidTwoFactorCode},
+		{"next code", codeAt(secret, 1), nil},
+		{"recovery code", recoveryCodes[0], nil},
+		{"recovery code again", recoveryCodes[0], ErrInvalidTwoFactorCode},
+		{"recovery code without dash, in upper case", strings.ToUpper(strings.ReplaceAll(recoveryCodes[1], "-", "")), nil},
+		{"recovery code with spaces", "  " + recoveryCodes[2] + "  ", nil},
+		{"unknown recovery code", "aaaa-aaaa", ErrInvalidTwoFactorCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := consumeSecondFactor(account, tt.code); err != tt.err {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	stored, err := database.FindUserByToken(account.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := len(strings.Split(stored.RecoveryCodes, ",")); left != recoveryCodeCount-3 {
+		t.Errorf("%d recovery codes left, want %d", left, recoveryCodeCount-3)
+	}
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	setupAccounts(t)
+	account := insertAccountWithPassword(t, "login@example.com", "password")
+	secret, _ := enableTestTOTP(t, account)
+
+	tests := []struct {
+		name string
+		code string
+		err  error
+	}{
+		{"password alone", "", ErrTwoFactorRequired},
+		{"wrong code", "000000", ErrInvalidTwoFactorCode},
+		{"right code", codeAt(secret, 0), nil},
+		{"replayed code", codeAt(secret, 0), ErrInvalidTwoFactorCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoginUser(LoginRequest{Email: "login@example.com", Password: "password", TOTPCode: tt.code})
+			if err != tt.err {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+	// guessing codes counts towards the lockout like guessing passwords
+	if accountFailures.records["login@example.com"] == nil {
+		t.Error("wrong codes weren't counted as failures")
+	}
+}
+
+func TestSessionCodeChecksLockOut(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(account database.Account, code string) error
+	}{
+		{"disable", func(account database.Account, code string) error {
+			return DisableTOTP(account, code, "10.0.0.1")
+		}},
+		{"regenerate recovery codes", func(account database.Account, code string) error {
+			_, err := RegenerateRecoveryCodes(account, code, "10.0.0.1")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupAccounts(t)
+			account := insertAccountWithPassword(t, "guess@example.com", "password")
+			secret, _ := enableTestTOTP(t, account)
+			account, _ = database.FindUserByToken(account.Token)
+
+			for i := 0; i < accountFailureAllowance; i++ {
+				if err := tt.check(account, "000000"); err != ErrInvalidTwoFactorCode {
+					t.Fatalf("guess %d: got %v, want ErrInvalidTwoFactorCode", i, err)
+				}
+			}
+			if _, ok := tt.check(account, codeAt(secret, 0)).(LockoutError); !ok {
+				t.Error("expected a LockoutError for the right code once locked")
+			}
+			stored, _ := database.FindUserByToken(account.Token)
+			if !stored.TOTPEnabled {
+				t.Error("2FA was turned off while locked")
+			}
+		})
+	}
+}
@@ -5,16 +5,18 @@ import (
 	"fmt"
 )
 
-func updateUserWithAuth(email, password string, updateFunc func(*database.Account)) (database.Account, error) {
-	if !Authenticate(email, password) {
-		return database.Account{}, fmt.Errorf("invalid credentials")
+func updateUserWithAuth(email, password, code, source string, updateFunc func(*database.Account) error) (database.Account, error) {
+	if err := AuthenticateWithCode(email, password, code, source); err != nil {
+		return database.Account{}, err
 	}
 	oldUserInfo, err := database.FindUserByEmail(email)
 	if err != nil {
 		return database.Account{}, err
 	}
 	newUserInfo := oldUserInfo
-	updateFunc(&newUserInfo)
+	if err := updateFunc(&newUserInfo); err != nil {
+		return database.Account{}, err
+	}
 	err = oldUserInfo.Update(newUserInfo)
 	if err != nil {
 		return database.Account{}, err
@@ -22,20 +24,55 @@ func updateUserWithAuth(email, password string, updateFunc func(*database.Accoun
 	return newUserInfo, nil
 }
 
+// ChangeUserEmail also marks the account unverified until the new address is.
 func ChangeUserEmail(request ChangeEmailRequest) (database.Account, error) {
-	return updateUserWithAuth(request.OldEmail, request.Password, func(user *database.Account) {
+	account, err := updateUserWithAuth(request.OldEmail, request.Password, request.TOTPCode, request.Source, func(user *database.Account) error {
+		if _, err := database.FindUserByEmail(request.NewEmail); err == nil && request.NewEmail != user.Email {
+			return fmt.Errorf("email already exists")
+		}
 		user.Email = request.NewEmail
+		user.EmailVerified = false
+		return nil
 	})
+	if err != nil || account.Email == request.OldEmail {
+		return account, err
+	}
+	// Update skips the false, it only reached the caches
+	account, err = account.SetEmailVerified(false)
+	if err != nil {
+		return account, fmt.Errorf("email changed but failed to mark it unverified: %v", err)
+	}
+	sendVerificationEmailInBackground(account)
+	return account, nil
 }
 
+// ChangeUserPassword also ends every session of the account, a new password
+// is usually set because the old one leaked.
 func ChangeUserPassword(request ChangePasswordRequest) (database.Account, error) {
-	return updateUserWithAuth(request.Email, request.OldPassword, func(user *database.Account) {
-		user.HashedPassword = request.NewPasswordHashed
+	if err := validatePassword(request.NewPassword); err != nil {
+		return database.Account{}, err
+	}
+	// hashed only once the old password checked out, so bad guesses don't cost an Argon2 run
+	account, err := updateUserWithAuth(request.Email, request.OldPassword, request.TOTPCode, request.Source, func(user *database.Account) error {
+		hashedPassword, err := HashPassword(request.NewPassword)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %v", err)
+		}
+		user.HashedPassword = hashedPassword
+		return nil
 	})
+	if err != nil {
+		return account, err
+	}
+	if _, err := database.DeleteAccountSessions(account.Token); err != nil {
+		return account, fmt.Errorf("password changed but failed to end sessions: %v", err)
+	}
+	return account, nil
 }
 
 func ChangeUserDisplayName(request ChangeDisplayNameRequest) (database.Account, error) {
-	return updateUserWithAuth(request.Email, request.Password, func(user *database.Account) {
+	return updateUserWithAuth(request.Email, request.Password, request.TOTPCode, request.Source, func(user *database.Account) error {
 		user.DisplayName = request.DisplayName
+		return nil
 	})
 }
@@ -0,0 +1,105 @@
+package database
+
+import "strings"
+
+// PromoteAdmins makes the accounts with these emails admins, and every
+// other admin a regular account again. Only verified addresses count,
+// otherwise whoever registers a listed address first gets its rights. It
+// runs before the caches are loaded, so only the database is updated.
+func PromoteAdmins(emails []string) error {
+	lowered := []string{}
+	for _, email := range emails {
+		lowered = append(lowered, strings.ToLower(email))
+	}
+	db := GetDB()
+	demote := db.Model(&Account{}).Where("admin = ?", true)
+	if len(lowered) > 0 {
+		demote = demote.Where("LOWER(email) NOT IN ? OR email_verified = ?", lowered, false)
+	}
+	if err := demote.Update("admin", false).Error; err != nil {
+		return err
+	}
+	if len(lowered) == 0 {
+		return nil
+	}
+	return db.Model(&Account{}).Where("LOWER(email) IN ? AND email_verified = ?", lowered, true).Update("admin", true).Error
+}
+
+// SearchAccounts returns a page of the accounts whose email or display name
+// contains query, and how many match in total.
+func SearchAccounts(query string, offset int, limit int) ([]Account, int64, error) {
+	db := GetDB().Model(&Account{})
+	if query != "" {
+		db = db.Where("email LIKE ? OR display_name LIKE ?", "%"+query+"%", "%"+query+"%")
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var accounts []Account
+	err := db.Order("email").Offset(offset).Limit(limit).Find(&accounts).Error
+	return accounts, total, err
+}
+
+// GetStorageUsed returns how many files token owns and their total size.
+func GetStorageUsed(token string) (int64, int64, error) {
+	var usage struct {
+		Count int64
+		Size  int64
+	}
+	err := GetDB().Model(&FileData{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS size").
+		Where("account_token = ?", token).
+		Scan(&usage).Error
+	return usage.Count, usage.Size, err
+}
+
+type SystemStats struct {
+	Accounts         int64 `json:"accounts"`
+	DisabledAccounts int64 `json:"disabled_accounts"`
+	PendingDeletion  int64 `json:"pending_deletion"` // deleted by their owners, not purged yet
+	Admins           int64 `json:"admins"`
+	Owners           int64 `json:"owners"` // accounts and guests, like the homepage counts them
+	Files            int64 `json:"files"`
+	StorageUsed      int64 `json:"storage_used"`
+	Collections      int64 `json:"collections"`
+	Sessions         int64 `json:"sessions"`
+	APIKeys          int64 `json:"api_keys"`
+}
+
+func GetSystemStats() (SystemStats, error) {
+	db := GetDB()
+	var stats SystemStats
+	counts := []struct {
+		into  *int64
+		model any
+		where string
+	}{
+		{&stats.Accounts, &Account{}, ""},
+		{&stats.DisabledAccounts, &Account{}, "disabled = true"},
+		{&stats.PendingDeletion, &Account{}, "delete_at > 0"},
+		{&stats.Admins, &Account{}, "admin = true"},
+		{&stats.Files, &FileData{}, ""},
+		{&stats.Collections, &Collection{}, ""},
+		{&stats.Sessions, &Session{}, ""},
+		{&stats.APIKeys, &APIKey{}, ""},
+	}
+	for _, count := range counts {
+		query := db.Model(count.model)
+		if count.where != "" {
+			query = query.Where(count.where)
+		}
+		if err := query.Count(count.into).Error; err != nil {
+			return stats, err
+		}
+	}
+	if err := db.Model(&FileData{}).Select("COALESCE(SUM(file_size), 0)").Scan(&stats.StorageUsed).Error; err != nil {
+		return stats, err
+	}
+	owners, err := GetCumulativeUserCount()
+	if err != nil {
+		return stats, err
+	}
+	stats.Owners = owners
+	return stats, nil
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestPromoteAdmins(t *testing.T) {
+	tests := []struct {
+		name    string
+		account Account
+		emails  []string
+		admin   bool
+	}{
+		{"listed and verified", Account{Email: "root@example.com", EmailVerified: true}, []string{"root@example.com"}, true},
+		{"listed in another case", Account{Email: "Root@Example.com", EmailVerified: true}, []string{"root@example.COM"}, true},
+		{"listed but unverified", Account{Email: "root@example.com"}, []string{"root@example.com"}, false},
+		{"not listed", Account{Email: "user@example.com", EmailVerified: true}, []string{"root@example.com"}, false},
+		{"taken off the list", Account{Email: "old@example.com", EmailVerified: true, Admin: true}, []string{"root@example.com"}, false},
+		{"list emptied", Account{Email: "old@example.com", EmailVerified: true, Admin: true}, nil, false},
+		{"lost verification", Account{Email: "root@example.com", Admin: true}, []string{"root@example.com"}, false},
+		{"still listed", Account{Email: "root@example.com", EmailVerified: true, Admin: true}, []string{"root@example.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetState(t)
+			tt.account.Token = "token-" + tt.name
+			if err := GetDB().Create(&tt.account).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := PromoteAdmins(tt.emails); err != nil {
+				t.Fatalf("PromoteAdmins: %v", err)
+			}
+			var stored Account
+			if err := GetDB().Where("token = ?", tt.account.Token).First(&stored).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.Admin != tt.admin {
+				t.Errorf("admin = %v, want %v", stored.Admin, tt.admin)
+			}
+		})
+	}
+}
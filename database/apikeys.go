@@ -0,0 +1,129 @@
+package database
+
+import (
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+func (key APIKey) Insert() error {
+	if err := GetDB().Create(&key).Error; err != nil {
+		return err
+	}
+	APIKeysByHashMutex.Lock()
+	APIKeysByHash[key.TokenHash] = key
+	APIKeysByHashMutex.Unlock()
+	return nil
+}
+
+func FindAPIKeyByHash(tokenHash string) (APIKey, error) {
+	APIKeysByHashMutex.RLock()
+	key, found := APIKeysByHash[tokenHash]
+	APIKeysByHashMutex.RUnlock()
+	if found {
+		return key, nil
+	}
+
+	db := GetDB()
+	var dbKey APIKey
+	db = db.Session(&gorm.Session{Logger: db.Logger.LogMode(0)})
+	err := db.Where("token_hash = ?", tokenHash).First(&dbKey).Error
+	if err == nil {
+		APIKeysByHashMutex.Lock()
+		APIKeysByHash[tokenHash] = dbKey
+		APIKeysByHashMutex.Unlock()
+	}
+	return dbKey, err
+}
+
+func GetAccountAPIKeys(accountToken string) ([]APIKey, error) {
+	var keys []APIKey
+	err := GetDB().Where("account_token = ?", accountToken).Order("created_at desc").Find(&keys).Error
+	return keys, err
+}
+
+// Touch records that the key was just used.
+func (key APIKey) Touch(lastUsed int64) (APIKey, error) {
+	if err := GetDB().Model(&APIKey{}).Where("id = ?", key.ID).Update("last_used", lastUsed).Error; err != nil {
+		return key, err
+	}
+	key.LastUsed = lastUsed
+	APIKeysByHashMutex.Lock()
+	if _, ok := APIKeysByHash[key.TokenHash]; ok {
+		APIKeysByHash[key.TokenHash] = key
+	}
+	APIKeysByHashMutex.Unlock()
+	return key, nil
+}
+
+func (key APIKey) Delete() error {
+	APIKeysByHashMutex.Lock()
+	defer APIKeysByHashMutex.Unlock()
+	if err := GetDB().Where("id = ?", key.ID).Delete(&APIKey{}).Error; err != nil {
+		return err
+	}
+	delete(APIKeysByHash, key.TokenHash)
+	return nil
+}
+
+// DeleteAccountAPIKeys revokes every key of an account and returns the removed keys.
+func DeleteAccountAPIKeys(accountToken string) ([]APIKey, error) {
+	APIKeysByHashMutex.Lock()
+	defer APIKeysByHashMutex.Unlock()
+	db := GetDB()
+	var keys []APIKey
+	if err := db.Where("account_token = ?", accountToken).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("account_token = ?", accountToken).Delete(&APIKey{}).Error; err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		delete(APIKeysByHash, key.TokenHash)
+	}
+	return keys, nil
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+	return strings.Split(list, ",")
+}
+
+func (key APIKey) ScopeList() []string {
+	return splitList(key.Scopes)
+}
+
+func (key APIKey) CollectionList() []string {
+	return splitList(key.Collections)
+}
+
+func (key APIKey) HasScope(scope string) bool {
+	return slices.Contains(key.ScopeList(), scope)
+}
+
+// Restricted reports whether the key is limited to some collections.
+func (key APIKey) Restricted() bool {
+	return key.Collections != ""
+}
+
+func (key APIKey) AllowsCollection(collectionID string) bool {
+	return !key.Restricted() || slices.Contains(key.CollectionList(), collectionID)
+}
+
+// AllowsFile reports whether the key may touch a file, for restricted keys
+// that's files in one of their collections.
+func (key APIKey) AllowsFile(fileDirectory string) bool {
+	if !key.Restricted() {
+		return true
+	}
+	for _, collectionID := range key.CollectionList() {
+		collection, err := GetCollection(collectionID)
+		if err == nil && slices.Contains(collection.GetFiles(), fileDirectory) {
+			return true
+		}
+	}
+	return false
+}
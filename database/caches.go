@@ -158,6 +158,17 @@ var (
 	UserAccountsByToken      = make(map[string]Account)
 	UserAccountsByTokenMutex sync.RWMutex
 
+	SessionsByHash      = make(map[string]Session)
+	SessionsByHashMutex sync.RWMutex
+
+	APIKeysByHash      = make(map[string]APIKey)
+	APIKeysByHashMutex sync.RWMutex
+
+	// PendingDeletion is the DeleteAt of every account waiting to be purged,
+	// it's always loaded since their content has to be hidden
+	PendingDeletion      = make(map[string]int64)
+	PendingDeletionMutex sync.RWMutex
+
 	FileCache     = make(map[string]FileData)
 	FileCacheLock = sync.RWMutex{}
 
@@ -157,6 +157,10 @@ func unsafeDeleteFile(file FileData, collectionPulser func(collection Collection
 	return nil
 }
 
+// AfterFileDelete, when set, is called in the background with every file that
+// was successfully deleted. endpoints uses it to drop the file's previews.
+var AfterFileDelete func(FileData)
+
 func DeleteFile(file FileData, collectionPulser func(collection Collection)) error {
 	UserFilesMutex.RLock()
 	defer UserFilesMutex.RUnlock()
@@ -168,7 +172,13 @@ func DeleteFile(file FileData, collectionPulser func(collection Collection)) err
 	defer FileCacheLock.Unlock()
 	CollectionCacheLock.Lock()
 	defer CollectionCacheLock.Unlock()
-	return unsafeDeleteFile(file, collectionPulser)
+	if err := unsafeDeleteFile(file, collectionPulser); err != nil {
+		return err
+	}
+	if AfterFileDelete != nil {
+		go AfterFileDelete(file)
+	}
+	return nil
 }
 
 func (account Account) Delete() error {
@@ -189,5 +199,17 @@ func (account Account) Delete() error {
 	delete(UserCollections, account.Token)
 	delete(UserAccountsByEmail, account.Email)
 	delete(UserAccountsByToken, account.Token)
+	PendingDeletionMutex.Lock()
+	delete(PendingDeletion, account.Token)
+	PendingDeletionMutex.Unlock()
+	if _, err := DeleteAccountSessions(account.Token); err != nil {
+		return err
+	}
+	if err := db.Where("account_token = ?", account.Token).Delete(&OIDCIdentity{}).Error; err != nil {
+		return err
+	}
+	if _, err := DeleteAccountAPIKeys(account.Token); err != nil {
+		return err
+	}
 	return nil
 }
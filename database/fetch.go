@@ -26,7 +26,10 @@ func FindUserByEmail(email string) (Account, error) {
 	if err == nil {
 		go func() {
 			UserAccountsByEmailMutex.Lock()
-			UserAccountsByEmail[email] = dbUser
+			// a setter may have cached a newer copy since the read
+			if _, ok := UserAccountsByEmail[email]; !ok {
+				UserAccountsByEmail[email] = dbUser
+			}
 			UserAccountsByEmailMutex.Unlock()
 		}()
 	}
@@ -53,7 +56,10 @@ func FindUserByToken(token string) (Account, error) {
 	if err == nil {
 		go func() {
 			UserAccountsByTokenMutex.Lock()
-			UserAccountsByToken[token] = dbUser
+			// a setter may have cached a newer copy since the read
+			if _, ok := UserAccountsByToken[token]; !ok {
+				UserAccountsByToken[token] = dbUser
+			}
 			UserAccountsByTokenMutex.Unlock()
 		}()
 	}
@@ -68,6 +74,10 @@ func GetUserFiles(token string) ([]FileData, error) {
 		return files.Array(), nil
 	}
 	UserFilesMutex.RUnlock()
+	// the cached path hides these through GetFile
+	if isPendingDeletion(token) {
+		return []FileData{}, nil
+	}
 	db := GetDB()
 	var dbFiles []FileData
 	err := db.Where("account_token = ?", token).Find(&dbFiles).Error
@@ -105,6 +115,9 @@ func GetFile(file_directory string) (FileData, error) {
 	if err != nil {
 		return FileData{}, err
 	}
+	if isPendingDeletion(fileData.AccountToken) {
+		return FileData{}, gorm.ErrRecordNotFound
+	}
 	if !inCache {
 		go func() {
 			FileCacheLock.Lock()
@@ -119,6 +132,15 @@ func GetFile(file_directory string) (FileData, error) {
 	return fileData, nil
 }
 
+// FileExists reports whether a file is stored, including the files GetFile
+// hides while their owner's account is pending deletion.
+func FileExists(file_directory string) bool {
+	FileCacheLock.RLock()
+	defer FileCacheLock.RUnlock()
+	_, _, err := unsafeGetFile(file_directory)
+	return err == nil
+}
+
 func unsafeGetCollection(collectionID string) (Collection, bool, error) {
 	if collection, ok := CollectionCache[collectionID]; ok {
 		return collection, true, nil
@@ -140,6 +162,9 @@ func GetCollection(collectionID string) (Collection, error) {
 	if err != nil {
 		return Collection{}, err
 	}
+	if collectionHidden(data) {
+		return Collection{}, gorm.ErrRecordNotFound
+	}
 	if !inCache {
 		go func() {
 			CollectionCacheLock.Lock()
@@ -274,5 +299,12 @@ func (user Account) GetCollections() ([]Collection, error) {
 		}
 		UserCollections[user.Token].Set(dbCollections)
 	}()
-	return dbCollections, nil
+	// the cached path hides these through GetCollection
+	visible := []Collection{}
+	for _, collection := range dbCollections {
+		if !collectionHidden(collection) {
+			visible = append(visible, collection)
+		}
+	}
+	return visible, nil
 }
@@ -1,8 +1,10 @@
 package database
 
 import (
+	"angadrive/vars"
 	"fmt"
 	"os"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -53,12 +55,19 @@ func InitializeDatabase(uploadedFilesDir string) error {
 		return fmt.Errorf("InitializeDatabase: %w", err)
 	}
 
-	err = dbInstance.AutoMigrate(&Account{}, &Activity{}, &Collection{}, &FileData{}, &CollectionFile{}, &CollectionChild{})
+	err = dbInstance.AutoMigrate(&Account{}, &Activity{}, &Collection{}, &FileData{}, &CollectionFile{}, &CollectionChild{}, &Session{}, &OIDCIdentity{}, &APIKey{})
 	if err != nil {
 		return fmt.Errorf("InitializeDatabase: %w", err)
 	}
+	if err := DeleteExpiredSessions(time.Now().Unix()); err != nil {
+		fmt.Printf("Warning: Failed to clean up expired sessions: %v\n", err)
+	}
+	if err := PromoteAdmins(vars.AdminEmails); err != nil {
+		fmt.Printf("Warning: Failed to promote admins: %v\n", err)
+	}
 	fmt.Println("[GIN-debug] Database initialized successfully")
 	loadTimeStamps()
+	loadPendingDeletions()
 	dontCache := os.Getenv("SAVE_DRIVE_RAM")
 	if dontCache == "" || dontCache != "true" {
 		fmt.Println("[GIN-debug] Loading entire database into RAM (set env variable SAVE_DRIVE_RAM=true to disable this)")
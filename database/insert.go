@@ -105,6 +105,10 @@ func generateFileName(filename string) string {
 	return generated_name
 }
 
+// AfterFileInsert, when set, is called in the background with every file that
+// was successfully inserted. endpoints uses it to queue preview generation.
+var AfterFileInsert func(FileData)
+
 func (file FileData) Insert() error {
 	db := GetDB()
 	if err := db.Create(&file).Error; err != nil {
@@ -122,6 +126,9 @@ func (file FileData) Insert() error {
 	FileCache[file.FileDirectory] = file
 	FileCacheLock.Unlock()
 
+	if AfterFileInsert != nil {
+		go AfterFileInsert(file)
+	}
 	return nil
 }
 
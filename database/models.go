@@ -4,7 +4,60 @@ type Account struct {
 	Token          string `gorm:"primaryKey" json:"token"`
 	DisplayName    string `json:"display_name"`
 	Email          string `json:"email"`
+	EmailVerified  bool   `json:"email_verified"`
 	HashedPassword string `json:"-"`
+	StripMetadata  bool   `json:"strip_metadata"`              // serve every image of this account without EXIF/GPS
+	TOTPSecret     string `gorm:"column:totp_secret" json:"-"` // base32, set but unused until TOTPEnabled
+	TOTPEnabled    bool   `gorm:"column:totp_enabled" json:"totp_enabled"`
+	TOTPLastStep   int64  `gorm:"column:totp_last_step" json:"-"` // codes of this time step or earlier can't be used again
+	RecoveryCodes  string `json:"-"`                              // comma separated SHA-256s of the unused recovery codes
+	Admin          bool   `json:"admin"`
+	Disabled       bool   `json:"disabled"`      // set by an admin, nobody can log in while it is
+	StorageQuota   int64  `json:"storage_quota"` // bytes, 0 for the default quota and -1 for none
+	DeleteAt       int64  `json:"delete_at"`     // unix time the account is purged at, 0 unless its owner deleted it
+}
+
+// Session is a login of an account. Only the SHA-256 of the bearer token is
+// stored, the token itself is handed to the client once when it's issued.
+type Session struct {
+	ID           string `gorm:"primaryKey" json:"id"`
+	TokenHash    string `gorm:"uniqueIndex" json:"-"`
+	AccountToken string `gorm:"index" json:"-"`
+	Device       string `json:"device"` // whatever the client called itself when logging in
+	CreatedAt    int64  `json:"created_at"`
+	LastUsed     int64  `json:"last_used"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// APIKey lets scripts act for an account with limited rights. Like sessions,
+// only the SHA-256 of the key is stored.
+type APIKey struct {
+	ID           string `gorm:"primaryKey" json:"id"`
+	Name         string `json:"name"`
+	TokenHash    string `gorm:"uniqueIndex" json:"-"`
+	AccountToken string `gorm:"index" json:"-"`
+	Scopes       string `json:"-"` // comma separated
+	Collections  string `json:"-"` // comma separated IDs the key is limited to, empty for all
+	CreatedAt    int64  `json:"created_at"`
+	LastUsed     int64  `json:"last_used"`
+	ExpiresAt    int64  `json:"expires_at"` // 0 for keys that don't expire
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// OIDCIdentity links the subject an identity provider knows someone by to
+// their account, so renaming their email at the provider doesn't lock them out.
+type OIDCIdentity struct {
+	Issuer       string `gorm:"primaryKey"`
+	Subject      string `gorm:"primaryKey"`
+	AccountToken string `gorm:"index"`
+	CreatedAt    int64
+}
+
+func (OIDCIdentity) TableName() string {
+	return "oidc_identities"
 }
 
 type Activity struct {
@@ -60,10 +113,20 @@ func (CollectionChild) TableName() string {
 }
 
 type FileData struct {
-	OriginalFileName string `json:"original_file_name"`
-	FileDirectory    string `gorm:"primaryKey" json:"file_directory"`
-	AccountToken     string `json:"account_token"`
-	FileSize         int64  `json:"file_size"`
-	Timestamp        int64  `json:"timestamp"`
-	Md5sum           string `json:"-"`
+	OriginalFileName string  `json:"original_file_name"`
+	FileDirectory    string  `gorm:"primaryKey" json:"file_directory"`
+	AccountToken     string  `json:"account_token"`
+	FileSize         int64   `json:"file_size"`
+	Timestamp        int64   `json:"timestamp"`
+	Md5sum           string  `json:"-"`
+	Sha256           string  `gorm:"column:sha256" json:"-"`   // hex, empty until computed for files from before it was stored
+	StripMetadata    bool    `json:"strip_metadata"`           // serve this image without EXIF/GPS
+	BlurHash         string  `json:"blur_hash,omitempty"`      // placeholder painted while the preview loads
+	DominantColor    string  `json:"dominant_color,omitempty"` // "#rrggbb"
+	Title            string  `json:"title,omitempty"`          // audio tags
+	Artist           string  `json:"artist,omitempty"`
+	Album            string  `json:"album,omitempty"`
+	Duration         float64 `json:"duration,omitempty"`  // seconds, audio only
+	HasCover         bool    `json:"has_cover,omitempty"` // audio file with embedded cover art
+	PerceptualHash   string  `json:"-"`                   // hex dHash of the image preview, for finding look-alikes
 }
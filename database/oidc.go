@@ -0,0 +1,20 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+func (identity OIDCIdentity) Insert() error {
+	return GetDB().Create(&identity).Error
+}
+
+// FindOIDCAccount returns the account linked to subject at issuer.
+func FindOIDCAccount(issuer string, subject string) (Account, error) {
+	db := GetDB()
+	db = db.Session(&gorm.Session{Logger: db.Logger.LogMode(0)})
+	var identity OIDCIdentity
+	if err := db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error; err != nil {
+		return Account{}, err
+	}
+	return FindUserByToken(identity.AccountToken)
+}
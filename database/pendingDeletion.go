@@ -0,0 +1,65 @@
+package database
+
+import "fmt"
+
+func loadPendingDeletions() {
+	var accounts []Account
+	if err := GetDB().Where("delete_at > 0").Find(&accounts).Error; err != nil {
+		fmt.Printf("Warning: Failed to load accounts pending deletion: %v\n", err)
+		return
+	}
+	PendingDeletionMutex.Lock()
+	defer PendingDeletionMutex.Unlock()
+	for _, account := range accounts {
+		PendingDeletion[account.Token] = account.DeleteAt
+	}
+}
+
+func isPendingDeletion(token string) bool {
+	PendingDeletionMutex.RLock()
+	defer PendingDeletionMutex.RUnlock()
+	_, pending := PendingDeletion[token]
+	return pending
+}
+
+// collectionHidden reports whether every editor of the collection deleted
+// their account, a collection someone still edits stays visible.
+func collectionHidden(collection Collection) bool {
+	editors := collection.GetEditors()
+	for _, editor := range editors {
+		if !isPendingDeletion(editor) {
+			return false
+		}
+	}
+	return len(editors) > 0
+}
+
+// GetAccountsDueForDeletion returns the accounts whose grace period ended before now.
+func GetAccountsDueForDeletion(now int64) ([]Account, error) {
+	var accounts []Account
+	err := GetDB().Where("delete_at > 0 AND delete_at <= ?", now).Find(&accounts).Error
+	return accounts, err
+}
+
+// GetPurgeContent returns the files an account owns and the collections it
+// edits straight from the database. GetUserFiles and GetCollections go
+// through GetFile and GetCollection, which hide exactly this content.
+func GetPurgeContent(token string) ([]FileData, []Collection, error) {
+	db := GetDB()
+	var files []FileData
+	if err := db.Where("account_token = ?", token).Find(&files).Error; err != nil {
+		return nil, nil, err
+	}
+	var candidates []Collection
+	if err := db.Where("editors LIKE ?", "%"+token+"%").Find(&candidates).Error; err != nil {
+		return nil, nil, err
+	}
+	// LIKE also matches tokens that merely contain this one
+	collections := []Collection{}
+	for _, collection := range candidates {
+		if collection.IsEditor(token) {
+			collections = append(collections, collection)
+		}
+	}
+	return files, collections, nil
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// RotateToken replaces the account's token with newToken everywhere it's
+// stored, so a leaked token stops pointing at anything. The session with ID
+// keepSessionID moves to the new token, every other session is deleted. API
+// keys and OIDC links move along, they never contained the token.
+//
+// Every cache that holds the token stays locked until both the database and
+// the caches are rewritten, nobody sees the account half rotated.
+func (account Account) RotateToken(newToken string, keepSessionID string) (Account, error) {
+	oldToken := account.Token
+	UserFilesMutex.Lock()
+	defer UserFilesMutex.Unlock()
+	UserCollectionsMutex.Lock()
+	defer UserCollectionsMutex.Unlock()
+	UserAccountsByEmailMutex.Lock()
+	defer UserAccountsByEmailMutex.Unlock()
+	UserAccountsByTokenMutex.Lock()
+	defer UserAccountsByTokenMutex.Unlock()
+	FileCacheLock.Lock()
+	defer FileCacheLock.Unlock()
+	CollectionCacheLock.Lock()
+	defer CollectionCacheLock.Unlock()
+	SessionsByHashMutex.Lock()
+	defer SessionsByHashMutex.Unlock()
+	APIKeysByHashMutex.Lock()
+	defer APIKeysByHashMutex.Unlock()
+
+	var collections []Collection
+	err := GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Account{}).Where("token = ?", oldToken).Update("token", newToken).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&FileData{}).Where("account_token = ?", oldToken).Update("account_token", newToken).Error; err != nil {
+			return err
+		}
+		// editors is a list, LIKE only narrows it down
+		if err := tx.Where("editors LIKE ?", "%"+oldToken+"%").Find(&collections).Error; err != nil {
+			return err
+		}
+		for i, collection := range collections {
+			if !collection.IsEditor(oldToken) {
+				continue
+			}
+			editors := collection.GetEditors()
+			for j := range editors {
+				if editors[j] == oldToken {
+					editors[j] = newToken
+				}
+			}
+			collections[i].Editors = strings.Join(editors, ",")
+			if err := tx.Model(&Collection{}).Where("id = ?", collection.ID).Update("editors", collections[i].Editors).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("account_token = ? AND id <> ?", oldToken, keepSessionID).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Session{}).Where("account_token = ?", oldToken).Update("account_token", newToken).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&APIKey{}).Where("account_token = ?", oldToken).Update("account_token", newToken).Error; err != nil {
+			return err
+		}
+		return tx.Model(&OIDCIdentity{}).Where("account_token = ?", oldToken).Update("account_token", newToken).Error
+	})
+	if err != nil {
+		return account, err
+	}
+
+	account.Token = newToken
+	if files, ok := UserFiles[oldToken]; ok {
+		UserFiles[newToken] = files
+		delete(UserFiles, oldToken)
+	}
+	if userCollections, ok := UserCollections[oldToken]; ok {
+		UserCollections[newToken] = userCollections
+		delete(UserCollections, oldToken)
+	}
+	delete(UserAccountsByToken, oldToken)
+	UserAccountsByToken[newToken] = account
+	UserAccountsByEmail[account.Email] = account
+	for fileDirectory, file := range FileCache {
+		if file.AccountToken == oldToken {
+			file.AccountToken = newToken
+			FileCache[fileDirectory] = file
+		}
+	}
+	for _, collection := range collections {
+		if cached, ok := CollectionCache[collection.ID]; ok {
+			cached.Editors = collection.Editors
+			CollectionCache[collection.ID] = cached
+		}
+	}
+	for hash, session := range SessionsByHash {
+		if session.AccountToken != oldToken {
+			continue
+		}
+		if session.ID == keepSessionID {
+			session.AccountToken = newToken
+			SessionsByHash[hash] = session
+		} else {
+			delete(SessionsByHash, hash)
+		}
+	}
+	for hash, key := range APIKeysByHash {
+		if key.AccountToken == oldToken {
+			key.AccountToken = newToken
+			APIKeysByHash[hash] = key
+		}
+	}
+	return account, nil
+}
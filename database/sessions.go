@@ -0,0 +1,103 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+func (session Session) Insert() error {
+	db := GetDB()
+	if err := db.Create(&session).Error; err != nil {
+		return err
+	}
+	SessionsByHashMutex.Lock()
+	SessionsByHash[session.TokenHash] = session
+	SessionsByHashMutex.Unlock()
+	return nil
+}
+
+func FindSessionByHash(tokenHash string) (Session, error) {
+	SessionsByHashMutex.RLock()
+	session, found := SessionsByHash[tokenHash]
+	SessionsByHashMutex.RUnlock()
+	if found {
+		return session, nil
+	}
+
+	db := GetDB()
+	var dbSession Session
+	db = db.Session(&gorm.Session{Logger: db.Logger.LogMode(0)})
+	err := db.Where("token_hash = ?", tokenHash).First(&dbSession).Error
+	if err == nil {
+		SessionsByHashMutex.Lock()
+		SessionsByHash[tokenHash] = dbSession
+		SessionsByHashMutex.Unlock()
+	}
+	return dbSession, err
+}
+
+func GetAccountSessions(accountToken string) ([]Session, error) {
+	var sessions []Session
+	err := GetDB().Where("account_token = ?", accountToken).Order("last_used desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// Touch pushes back the expiry of a session that was just used.
+func (session Session) Touch(lastUsed int64, expiresAt int64) (Session, error) {
+	db := GetDB()
+	err := db.Model(&Session{}).Where("id = ?", session.ID).
+		Updates(map[string]interface{}{"last_used": lastUsed, "expires_at": expiresAt}).Error
+	if err != nil {
+		return session, err
+	}
+	session.LastUsed = lastUsed
+	session.ExpiresAt = expiresAt
+	SessionsByHashMutex.Lock()
+	if _, ok := SessionsByHash[session.TokenHash]; ok {
+		SessionsByHash[session.TokenHash] = session
+	}
+	SessionsByHashMutex.Unlock()
+	return session, nil
+}
+
+func (session Session) Delete() error {
+	SessionsByHashMutex.Lock()
+	defer SessionsByHashMutex.Unlock()
+	if err := GetDB().Where("id = ?", session.ID).Delete(&Session{}).Error; err != nil {
+		return err
+	}
+	delete(SessionsByHash, session.TokenHash)
+	return nil
+}
+
+// DeleteAccountSessions logs an account out everywhere and returns the sessions that were removed.
+func DeleteAccountSessions(accountToken string) ([]Session, error) {
+	SessionsByHashMutex.Lock()
+	defer SessionsByHashMutex.Unlock()
+	db := GetDB()
+	var sessions []Session
+	if err := db.Where("account_token = ?", accountToken).Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("account_token = ?", accountToken).Delete(&Session{}).Error; err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		delete(SessionsByHash, session.TokenHash)
+	}
+	return sessions, nil
+}
+
+// DeleteExpiredSessions removes every session that expired before now.
+func DeleteExpiredSessions(now int64) error {
+	SessionsByHashMutex.Lock()
+	defer SessionsByHashMutex.Unlock()
+	if err := GetDB().Where("expires_at < ?", now).Delete(&Session{}).Error; err != nil {
+		return err
+	}
+	for hash, session := range SessionsByHash {
+		if session.ExpiresAt < now {
+			delete(SessionsByHash, hash)
+		}
+	}
+	return nil
+}
@@ -29,6 +29,242 @@ func (oldInfo Account) Update(newInfo Account) error { // this assumes token can
 	return nil
 }
 
+// updateCachedAccount applies update to the cached copies of an account,
+// leaving everything else in them alone. The account a setter was called on
+// may be stale, writing it back whole would undo changes made since it was read.
+func updateCachedAccount(token string, update func(cached *Account)) {
+	UserAccountsByEmailMutex.Lock()
+	defer UserAccountsByEmailMutex.Unlock()
+	UserAccountsByTokenMutex.Lock()
+	defer UserAccountsByTokenMutex.Unlock()
+	if cached, ok := UserAccountsByToken[token]; ok {
+		update(&cached)
+		UserAccountsByToken[token] = cached
+		if byEmail, ok := UserAccountsByEmail[cached.Email]; ok && byEmail.Token == token {
+			update(&byEmail)
+			UserAccountsByEmail[cached.Email] = byEmail
+		}
+		return
+	}
+	// the caches fill independently, without the token entry the email one
+	// has to be searched
+	for email, cached := range UserAccountsByEmail {
+		if cached.Token == token {
+			update(&cached)
+			UserAccountsByEmail[email] = cached
+			return
+		}
+	}
+}
+
+// SetStripMetadata changes whether the account's images are served without
+// identifying metadata. It is separate from Update because gorm skips false
+// values when updating from a struct.
+func (account Account) SetStripMetadata(strip bool) (Account, error) {
+	db := GetDB()
+	err := db.Model(&Account{}).Where("token = ?", account.Token).Update("strip_metadata", strip).Error
+	if err != nil {
+		return account, err
+	}
+	account.StripMetadata = strip
+	updateCachedAccount(account.Token, func(cached *Account) {
+		cached.StripMetadata = strip
+	})
+	return account, nil
+}
+
+// SetEmailVerified records whether the owner proved they can read mail sent
+// to the account's address, it is separate from Update for the same reason.
+func (account Account) SetEmailVerified(verified bool) (Account, error) {
+	db := GetDB()
+	err := db.Model(&Account{}).Where("token = ?", account.Token).Update("email_verified", verified).Error
+	if err != nil {
+		return account, err
+	}
+	account.EmailVerified = verified
+	updateCachedAccount(account.Token, func(cached *Account) {
+		cached.EmailVerified = verified
+	})
+	return account, nil
+}
+
+// SetTOTP stores the two-factor state of the account, it is separate from
+// Update because turning 2FA off means writing zero values.
+func (account Account) SetTOTP(secret string, enabled bool, lastStep int64, recoveryCodes string) (Account, error) {
+	db := GetDB()
+	err := db.Model(&Account{}).Where("token = ?", account.Token).
+		Updates(map[string]interface{}{
+			"totp_secret":    secret,
+			"totp_enabled":   enabled,
+			"totp_last_step": lastStep,
+			"recovery_codes": recoveryCodes,
+		}).Error
+	if err != nil {
+		return account, err
+	}
+	account.TOTPSecret = secret
+	account.TOTPEnabled = enabled
+	account.TOTPLastStep = lastStep
+	account.RecoveryCodes = recoveryCodes
+	updateCachedAccount(account.Token, func(cached *Account) {
+		cached.TOTPSecret = secret
+		cached.TOTPEnabled = enabled
+		cached.TOTPLastStep = lastStep
+		cached.RecoveryCodes = recoveryCodes
+	})
+	return account, nil
+}
+
+// SetDisabled blocks or unblocks logging in to the account, it is separate
+// from Update because enabling it again means writing false.
+func (account Account) SetDisabled(disabled bool) (Account, error) {
+	db := GetDB()
+	err := db.Model(&Account{}).Where("token = ?", account.Token).Update("disabled", disabled).Error
+	if err != nil {
+		return account, err
+	}
+	account.Disabled = disabled
+	updateCachedAccount(account.Token, func(cached *Account) {
+		cached.Disabled = disabled
+	})
+	return account, nil
+}
+
+// SetStorageQuota changes how many bytes of files the account can own, 0
+// goes back to the default so it can't go through Update either.
+func (account Account) SetStorageQuota(quota int64) (Account, error) {
+	db := GetDB()
+	err := db.Model(&Account{}).Where("token = ?", account.Token).Update("storage_quota", quota).Error
+	if err != nil {
+		return account, err
+	}
+	account.StorageQuota = quota
+	updateCachedAccount(account.Token, func(cached *Account) {
+		cached.StorageQuota = quota
+	})
+	return account, nil
+}
+
+// SetDeleteAt schedules the account to be purged at, 0 cancels that. Its
+// files and collections are hidden in the meantime.
+func (account Account) SetDeleteAt(at int64) (Account, error) {
+	db := GetDB()
+	err := db.Model(&Account{}).Where("token = ?", account.Token).Update("delete_at", at).Error
+	if err != nil {
+		return account, err
+	}
+	account.DeleteAt = at
+	updateCachedAccount(account.Token, func(cached *Account) {
+		cached.DeleteAt = at
+	})
+	PendingDeletionMutex.Lock()
+	if at == 0 {
+		delete(PendingDeletion, account.Token)
+	} else {
+		PendingDeletion[account.Token] = at
+	}
+	PendingDeletionMutex.Unlock()
+	return account, nil
+}
+
+// updateCachedFile applies update to the cached copy of a file, leaving
+// everything else in it alone. file may be stale by the time a setter gets
+// here and a file deleted meanwhile must not come back into the cache.
+func updateCachedFile(fileDirectory string, update func(cached *FileData)) {
+	FileCacheLock.Lock()
+	defer FileCacheLock.Unlock()
+	cached, ok := FileCache[fileDirectory]
+	if !ok {
+		return
+	}
+	update(&cached)
+	FileCache[fileDirectory] = cached
+}
+
+// SetStripMetadata changes whether this file is served without identifying metadata.
+func (file FileData) SetStripMetadata(strip bool) (FileData, error) {
+	db := GetDB()
+	err := db.Model(&FileData{}).Where("file_directory = ?", file.FileDirectory).Update("strip_metadata", strip).Error
+	if err != nil {
+		return file, err
+	}
+	file.StripMetadata = strip
+	updateCachedFile(file.FileDirectory, func(cached *FileData) {
+		cached.StripMetadata = strip
+	})
+	return file, nil
+}
+
+// SetPlaceholder stores the BlurHash and dominant colour computed from the file's preview.
+func (file FileData) SetPlaceholder(blurHash string, dominantColor string) (FileData, error) {
+	db := GetDB()
+	err := db.Model(&FileData{}).Where("file_directory = ?", file.FileDirectory).
+		Updates(map[string]interface{}{"blur_hash": blurHash, "dominant_color": dominantColor}).Error
+	if err != nil {
+		return file, err
+	}
+	file.BlurHash = blurHash
+	file.DominantColor = dominantColor
+	updateCachedFile(file.FileDirectory, func(cached *FileData) {
+		cached.BlurHash = blurHash
+		cached.DominantColor = dominantColor
+	})
+	return file, nil
+}
+
+// SetSha256 stores the SHA-256 of the file's blob.
+func (file FileData) SetSha256(sha256 string) (FileData, error) {
+	db := GetDB()
+	err := db.Model(&FileData{}).Where("file_directory = ?", file.FileDirectory).Update("sha256", sha256).Error
+	if err != nil {
+		return file, err
+	}
+	file.Sha256 = sha256
+	updateCachedFile(file.FileDirectory, func(cached *FileData) {
+		cached.Sha256 = sha256
+	})
+	return file, nil
+}
+
+// SetAudioInfo stores the tags, duration and cover art flag read from an audio file.
+func (file FileData) SetAudioInfo(title, artist, album string, duration float64, hasCover bool) (FileData, error) {
+	db := GetDB()
+	err := db.Model(&FileData{}).Where("file_directory = ?", file.FileDirectory).
+		Updates(map[string]interface{}{
+			"title":     title,
+			"artist":    artist,
+			"album":     album,
+			"duration":  duration,
+			"has_cover": hasCover,
+		}).Error
+	if err != nil {
+		return file, err
+	}
+	file.Title, file.Artist, file.Album = title, artist, album
+	file.Duration = duration
+	file.HasCover = hasCover
+	updateCachedFile(file.FileDirectory, func(cached *FileData) {
+		cached.Title, cached.Artist, cached.Album = title, artist, album
+		cached.Duration = duration
+		cached.HasCover = hasCover
+	})
+	return file, nil
+}
+
+// SetPerceptualHash stores the perceptual hash of an image.
+func (file FileData) SetPerceptualHash(hash string) (FileData, error) {
+	db := GetDB()
+	err := db.Model(&FileData{}).Where("file_directory = ?", file.FileDirectory).Update("perceptual_hash", hash).Error
+	if err != nil {
+		return file, err
+	}
+	file.PerceptualHash = hash
+	updateCachedFile(file.FileDirectory, func(cached *FileData) {
+		cached.PerceptualHash = hash
+	})
+	return file, nil
+}
+
 func (collection *Collection) unsafeAddFolder(folder string) error {
 	var err error
 	if CollectionFilesMutex.TryLock() {
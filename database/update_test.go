@@ -0,0 +1,123 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestFileSettersKeepCacheCurrent(t *testing.T) {
+	tests := []struct {
+		name  string
+		set   func(stale FileData) error
+		check func(cached FileData) bool
+	}{
+		{"strip metadata", func(stale FileData) error {
+			_, err := stale.SetStripMetadata(true)
+			return err
+		}, func(cached FileData) bool { return cached.StripMetadata }},
+		{"placeholder", func(stale FileData) error {
+			_, err := stale.SetPlaceholder("LEHV6nWB", "#102030")
+			return err
+		}, func(cached FileData) bool { return cached.BlurHash == "LEHV6nWB" && cached.DominantColor == "#102030" }},
+		{"sha256", func(stale FileData) error {
+			_, err := stale.SetSha256("abc")
+			return err
+		}, func(cached FileData) bool { return cached.Sha256 == "abc" }},
+		{"audio info", func(stale FileData) error {
+			_, err := stale.SetAudioInfo("title", "artist", "album", 3, true)
+			return err
+		}, func(cached FileData) bool { return cached.Title == "title" && cached.HasCover }},
+		{"perceptual hash", func(stale FileData) error {
+			_, err := stale.SetPerceptualHash("ffff")
+			return err
+		}, func(cached FileData) bool { return cached.PerceptualHash == "ffff" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetState(t)
+			stale := insertTestFile(t, "file-a")
+
+			// a rename lands between the caller reading the file and the setter
+			renamed := stale
+			renamed.OriginalFileName = "renamed.txt"
+			FileCache[renamed.FileDirectory] = renamed
+
+			if err := tt.set(stale); err != nil {
+				t.Fatalf("setter failed: %v", err)
+			}
+			cached := FileCache[stale.FileDirectory]
+			if !tt.check(cached) {
+				t.Errorf("cache was not updated: %+v", cached)
+			}
+			if cached.OriginalFileName != "renamed.txt" {
+				t.Errorf("setter overwrote the rename with %q", cached.OriginalFileName)
+			}
+
+			// a file deleted meanwhile must not come back
+			delete(FileCache, stale.FileDirectory)
+			if err := tt.set(stale); err != nil {
+				t.Fatalf("setter failed: %v", err)
+			}
+			if _, ok := FileCache[stale.FileDirectory]; ok {
+				t.Error("setter put a deleted file back into the cache")
+			}
+		})
+	}
+}
+
+func TestAccountSettersKeepCacheCurrent(t *testing.T) {
+	tests := []struct {
+		name  string
+		set   func(stale Account) error
+		check func(cached Account) bool
+	}{
+		{"strip metadata", func(stale Account) error {
+			_, err := stale.SetStripMetadata(true)
+			return err
+		}, func(cached Account) bool { return cached.StripMetadata }},
+		{"email verified", func(stale Account) error {
+			_, err := stale.SetEmailVerified(true)
+			return err
+		}, func(cached Account) bool { return cached.EmailVerified }},
+		{"disabled", func(stale Account) error {
+			_, err := stale.SetDisabled(true)
+			return err
+		}, func(cached Account) bool { return cached.Disabled }},
+		{"storage quota", func(stale Account) error {
+			_, err := stale.SetStorageQuota(1024)
+			return err
+		}, func(cached Account) bool { return cached.StorageQuota == 1024 }},
+		{"delete at", func(stale Account) error {
+			_, err := stale.SetDeleteAt(5)
+			return err
+		}, func(cached Account) bool { return cached.DeleteAt == 5 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetState(t)
+			t.Cleanup(func() { PendingDeletion = make(map[string]int64) })
+			stale := Account{Token: "token-a", Email: "a@example.com", DisplayName: "a"}
+			if err := stale.Insert(); err != nil {
+				t.Fatalf("insert account failed: %v", err)
+			}
+
+			// 2FA gets turned on between the caller reading the account and the setter
+			if _, err := stale.SetTOTP("SECRET", true, 1, "codes"); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.set(stale); err != nil {
+				t.Fatalf("setter failed: %v", err)
+			}
+			for name, cached := range map[string]Account{
+				"by token": UserAccountsByToken[stale.Token],
+				"by email": UserAccountsByEmail[stale.Email],
+			} {
+				if !tt.check(cached) {
+					t.Errorf("%s: cache was not updated: %+v", name, cached)
+				}
+				if !cached.TOTPEnabled || cached.TOTPSecret != "SECRET" {
+					t.Errorf("%s: setter turned 2FA back off", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package endpoints
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"os"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/webp"
+)
+
+const (
+	maxAnimatedFrames       = 300
+	maxAnimatedSourcePixels = 200_000_000 // width * height * frames of the original
+	maxAnimatedPreviewBytes = 8 * 1024 * 1024
+	// the canvas every frame is composited on, checked before it is allocated
+	maxAnimatedCanvasPixels = 16_000_000
+)
+
+// animatedGIFPreview resizes every frame of an animated GIF, keeping the
+// delays, disposal methods and loop count. It returns false when the file
+// should get a still preview instead (a single frame, or over the budget).
+func animatedGIFPreview(file *os.File, buf *bytes.Buffer) bool {
+	// DecodeAll keeps every frame in memory, so the header and the number of
+	// frames are checked before anything is decoded
+	if _, err := file.Seek(0, 0); err != nil {
+		return false
+	}
+	config, err := gif.DecodeConfig(file)
+	if err != nil || config.Width*config.Height > maxAnimatedCanvasPixels {
+		return false
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return false
+	}
+	frames, err := countGIFFrames(bufio.NewReader(file))
+	if err != nil || frames < 2 || frames > maxAnimatedFrames || config.Width*config.Height*frames > maxAnimatedSourcePixels {
+		return false
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return false
+	}
+	anim, err := gif.DecodeAll(file)
+	if err != nil || len(anim.Image) < 2 || len(anim.Image) > maxAnimatedFrames {
+		return false
+	}
+	width, height := anim.Config.Width, anim.Config.Height
+	if width == 0 || height == 0 {
+		width, height = anim.Image[0].Bounds().Dx(), anim.Image[0].Bounds().Dy()
+	}
+	if width*height*len(anim.Image) > maxAnimatedSourcePixels {
+		return false
+	}
+
+	newWidth, newHeight := previewDimensions(width, height)
+	scaleX := float64(newWidth) / float64(width)
+	scaleY := float64(newHeight) / float64(height)
+	canvas := image.Rect(0, 0, newWidth, newHeight)
+
+	out := &gif.GIF{
+		Delay:           anim.Delay,
+		Disposal:        anim.Disposal,
+		LoopCount:       anim.LoopCount,
+		BackgroundIndex: anim.BackgroundIndex,
+		Config: image.Config{
+			ColorModel: anim.Config.ColorModel,
+			Width:      newWidth,
+			Height:     newHeight,
+		},
+	}
+	for _, frame := range anim.Image {
+		// frames only cover the area that changed, so their offsets get scaled too
+		bounds := frame.Bounds()
+		rect := image.Rect(
+			int(float64(bounds.Min.X)*scaleX),
+			int(float64(bounds.Min.Y)*scaleY),
+			int(math.Ceil(float64(bounds.Max.X)*scaleX)),
+			int(math.Ceil(float64(bounds.Max.Y)*scaleY)),
+		).Intersect(canvas)
+		if rect.Empty() {
+			rect = image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+1, rect.Min.Y+1).Intersect(canvas)
+		}
+		resized := imaging.Resize(frame, rect.Dx(), rect.Dy(), imaging.Lanczos)
+		paletted := image.NewPaletted(rect, frame.Palette)
+		draw.Draw(paletted, rect, resized, image.Point{}, draw.Src)
+		out.Image = append(out.Image, paletted)
+	}
+
+	if err := gif.EncodeAll(buf, out); err != nil || buf.Len() > maxAnimatedPreviewBytes {
+		return false
+	}
+	return true
+}
+
+// countGIFFrames walks the blocks of a GIF without decoding any of them.
+func countGIFFrames(r *bufio.Reader) (int, error) {
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+	if string(header[:3]) != "GIF" {
+		return 0, fmt.Errorf("not a GIF file")
+	}
+	if header[10]&0x80 != 0 { // global color table
+		if _, err := r.Discard(3 << (header[10]&0x07 + 1)); err != nil {
+			return 0, err
+		}
+	}
+	frames := 0
+	for {
+		introducer, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch introducer {
+		case 0x3B: // trailer
+			return frames, nil
+		case 0x21: // extension: label, then sub-blocks
+			if _, err := r.ReadByte(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // image descriptor, optional local color table, LZW code size, then sub-blocks
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(r, descriptor); err != nil {
+				return 0, err
+			}
+			if descriptor[8]&0x80 != 0 {
+				if _, err := r.Discard(3 << (descriptor[8]&0x07 + 1)); err != nil {
+					return 0, err
+				}
+			}
+			if _, err := r.ReadByte(); err != nil {
+				return 0, err
+			}
+			frames++
+			if frames > maxAnimatedFrames {
+				return frames, nil
+			}
+		default:
+			return 0, fmt.Errorf("unknown GIF block 0x%02x", introducer)
+		}
+		for {
+			size, err := r.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			if size == 0 {
+				break
+			}
+			if _, err := r.Discard(int(size)); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+type webpFrame struct {
+	rect     image.Rectangle
+	duration int // milliseconds
+	blend    bool
+	dispose  bool
+	data     []byte // ALPH/VP8/VP8L chunks of the frame
+}
+
+type webpAnimation struct {
+	width, height int
+	loopCount     int
+	frames        []webpFrame
+}
+
+// animatedWebPPreview turns an animated WebP into an animated GIF preview,
+// since there's no WebP encoder to write one back with. x/image/webp can't
+// read animations at all, so when there are too many frames the first one
+// gets encoded as a PNG here instead of by the still preview path.
+// It returns false for still WebP files.
+func animatedWebPPreview(file *os.File, buf *bytes.Buffer) (bool, error) {
+	if _, err := file.Seek(0, 0); err != nil {
+		return false, err
+	}
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		return false, err
+	}
+	anim, ok, err := parseAnimatedWebP(raw)
+	if !ok || err != nil {
+		return false, err
+	}
+	if len(anim.frames) == 0 {
+		return true, fmt.Errorf("animation has no frames")
+	}
+
+	// the canvas size comes straight from the header, up to 16M x 16M
+	if anim.width*anim.height > maxAnimatedCanvasPixels {
+		return true, fmt.Errorf("animation canvas of %dx%d is too large", anim.width, anim.height)
+	}
+	newWidth, newHeight := previewDimensions(anim.width, anim.height)
+	frameCount := len(anim.frames)
+	overBudget := frameCount > maxAnimatedFrames || anim.width*anim.height*frameCount > maxAnimatedSourcePixels
+	if overBudget {
+		frameCount = 1
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, anim.width, anim.height))
+	out := &gif.GIF{LoopCount: gifLoopCount(anim.loopCount)}
+	var first image.Image
+	for i, frame := range anim.frames[:frameCount] {
+		if i > 0 && anim.frames[i-1].dispose {
+			draw.Draw(canvas, anim.frames[i-1].rect, image.Transparent, image.Point{}, draw.Src)
+		}
+		if !frame.rect.In(canvas.Bounds()) {
+			return true, fmt.Errorf("frame %d lies outside the canvas", i)
+		}
+		img, err := decodeWebPFrame(frame)
+		if err != nil {
+			return true, fmt.Errorf("frame %d: %w", i, err)
+		}
+		op := draw.Src
+		if frame.blend {
+			op = draw.Over
+		}
+		draw.Draw(canvas, frame.rect, img, img.Bounds().Min, op)
+
+		resized := imaging.Resize(canvas, newWidth, newHeight, imaging.Lanczos)
+		if i == 0 {
+			first = imaging.Clone(resized)
+		}
+		out.Image = append(out.Image, quantizeFrame(resized))
+		out.Delay = append(out.Delay, frame.duration/10)
+		// every GIF frame is a full composited canvas, so clear it before the next one
+		out.Disposal = append(out.Disposal, gif.DisposalBackground)
+	}
+
+	if !overBudget {
+		if err := gif.EncodeAll(buf, out); err == nil && buf.Len() <= maxAnimatedPreviewBytes {
+			return true, nil
+		}
+		buf.Reset()
+	}
+	if err := png.Encode(buf, first); err != nil {
+		return true, fmt.Errorf("failed to encode first frame: %w", err)
+	}
+	return true, nil
+}
+
+// parseAnimatedWebP walks the RIFF chunks of a WebP file and collects its
+// animation frames. ok is false if the file isn't animated.
+func parseAnimatedWebP(raw []byte) (anim webpAnimation, ok bool, err error) {
+	if len(raw) < 12 || string(raw[0:4]) != "RIFF" || string(raw[8:12]) != "WEBP" {
+		return anim, false, fmt.Errorf("not a WebP file")
+	}
+	for _, chunk := range webpChunks(raw[12:]) {
+		switch chunk.fourCC {
+		case "VP8X":
+			if len(chunk.data) < 10 {
+				return anim, false, fmt.Errorf("corrupt VP8X chunk")
+			}
+			if chunk.data[0]&0x02 == 0 {
+				return anim, false, nil
+			}
+			ok = true
+			anim.width = readUint24(chunk.data[4:]) + 1
+			anim.height = readUint24(chunk.data[7:]) + 1
+		case "ANIM":
+			if len(chunk.data) >= 6 {
+				anim.loopCount = int(binary.LittleEndian.Uint16(chunk.data[4:6]))
+			}
+		case "ANMF":
+			if len(chunk.data) < 16 {
+				return anim, ok, fmt.Errorf("corrupt ANMF chunk")
+			}
+			x := readUint24(chunk.data[0:]) * 2
+			y := readUint24(chunk.data[3:]) * 2
+			width := readUint24(chunk.data[6:]) + 1
+			height := readUint24(chunk.data[9:]) + 1
+			anim.frames = append(anim.frames, webpFrame{
+				rect:     image.Rect(x, y, x+width, y+height),
+				duration: readUint24(chunk.data[12:]),
+				blend:    chunk.data[15]&0x02 == 0,
+				dispose:  chunk.data[15]&0x01 != 0,
+				data:     chunk.data[16:],
+			})
+		}
+	}
+	return anim, ok, nil
+}
+
+type webpChunk struct {
+	fourCC string
+	data   []byte
+}
+
+func webpChunks(raw []byte) []webpChunk {
+	var chunks []webpChunk
+	pos := 0
+	for pos+8 <= len(raw) {
+		size := int(binary.LittleEndian.Uint32(raw[pos+4 : pos+8]))
+		end := pos + 8 + size
+		if size < 0 || end > len(raw) {
+			end = len(raw)
+		}
+		chunks = append(chunks, webpChunk{fourCC: string(raw[pos : pos+4]), data: raw[pos+8 : end]})
+		pos = end + size%2 // chunks are padded to even sizes
+	}
+	return chunks
+}
+
+// decodeWebPFrame wraps the bitstream of one animation frame into a still
+// WebP file so x/image/webp can decode it.
+func decodeWebPFrame(frame webpFrame) (image.Image, error) {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	if bytes.HasPrefix(frame.data, []byte("ALPH")) {
+		vp8x := make([]byte, 18)
+		copy(vp8x, "VP8X")
+		binary.LittleEndian.PutUint32(vp8x[4:], 10)
+		vp8x[8] = 0x10 // alpha flag
+		putUint24(vp8x[12:], frame.rect.Dx()-1)
+		putUint24(vp8x[15:], frame.rect.Dy()-1)
+		body.Write(vp8x)
+	}
+	body.Write(frame.data)
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(body.Len()))
+	file.Write(body.Bytes())
+	// the bitstream has its own size, which doesn't have to match the frame's
+	config, err := webp.DecodeConfig(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width > frame.rect.Dx() || config.Height > frame.rect.Dy() {
+		return nil, fmt.Errorf("frame bitstream is larger than the frame")
+	}
+	return webp.Decode(&file)
+}
+
+// quantizeFrame maps a frame onto the web-safe palette plus a transparent
+// entry, GIF only does 1-bit transparency so alpha is thresholded first.
+func quantizeFrame(img *image.NRGBA) *image.Paletted {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] < 128 {
+			img.Pix[i-3], img.Pix[i-2], img.Pix[i-1], img.Pix[i] = 0, 0, 0, 0
+		} else {
+			img.Pix[i] = 255
+		}
+	}
+	colors := append(color.Palette{color.Transparent}, palette.WebSafe...)
+	paletted := image.NewPaletted(img.Bounds(), colors)
+	draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, img.Bounds().Min)
+	// dithering can spill error into transparent pixels, put them back
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] == 0 {
+			paletted.Pix[i/4] = 0
+		}
+	}
+	return paletted
+}
+
+// gifLoopCount converts a WebP loop count (0 = forever, n = play n times)
+// to image/gif's (0 = forever, -1 = play once, n = repeat n more times).
+func gifLoopCount(webpLoops int) int {
+	switch webpLoops {
+	case 0:
+		return 0
+	case 1:
+		return -1
+	default:
+		return webpLoops - 1
+	}
+}
+
+func readUint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
@@ -0,0 +1,159 @@
+package endpoints
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// webpWithCanvas is an animated WebP header claiming a canvas of width x height.
+func webpWithCanvas(width, height int, frames int) []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x02 // animation
+	putUint24(vp8x[4:], width-1)
+	putUint24(vp8x[7:], height-1)
+	body.WriteString("VP8X")
+	binary.Write(&body, binary.LittleEndian, uint32(len(vp8x)))
+	body.Write(vp8x)
+	for i := 0; i < frames; i++ {
+		anmf := make([]byte, 16)
+		putUint24(anmf[6:], width-1)
+		putUint24(anmf[9:], height-1)
+		body.WriteString("ANMF")
+		binary.Write(&body, binary.LittleEndian, uint32(len(anmf)))
+		body.Write(anmf)
+	}
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+// animatedGIF encodes a frames long animation of width x height.
+func animatedGIF(width, height, frames int) []byte {
+	anim := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9)
+		frame.SetColorIndex(i%width, 0, uint8(i))
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	gif.EncodeAll(&buf, anim)
+	return buf.Bytes()
+}
+
+func tempFile(t *testing.T, data []byte) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "upload")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func TestAnimatedWebPRejectsHostileHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		// would be a 16M x 16M NRGBA canvas, a petabyte
+		{"maximum canvas", webpWithCanvas(1<<24, 1<<24, 1)},
+		{"canvas just over the cap", webpWithCanvas(4001, 4001, 1)},
+		{"no frames", webpWithCanvas(10, 10, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			animated, err := animatedWebPPreview(tempFile(t, tt.raw), &buf)
+			if !animated || err == nil {
+				t.Errorf("got animated=%v err=%v, want an error", animated, err)
+			}
+		})
+	}
+
+	// a frame that claims to be larger than the canvas it is drawn on
+	raw := webpWithCanvas(10, 10, 1)
+	putUint24(raw[len(raw)-16+6:], 1<<20)
+	var buf bytes.Buffer
+	if _, err := animatedWebPPreview(tempFile(t, raw), &buf); err == nil {
+		t.Error("expected an error for a frame outside the canvas")
+	}
+}
+
+func TestAnimatedGIFBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      []byte
+		animated bool
+	}{
+		{"small animation", animatedGIF(16, 16, 3), true},
+		{"single frame", animatedGIF(16, 16, 1), false},
+		{"too many frames", animatedGIF(2, 2, maxAnimatedFrames+1), false},
+		{"canvas over the cap", animatedGIF(4001, 4001, 2), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if got := animatedGIFPreview(tempFile(t, tt.raw), &buf); got != tt.animated {
+				t.Errorf("animated = %v, want %v", got, tt.animated)
+			}
+		})
+	}
+}
+
+func TestCountGIFFrames(t *testing.T) {
+	for _, frames := range []int{1, 2, 17} {
+		got, err := countGIFFrames(bufio.NewReader(bytes.NewReader(animatedGIF(8, 8, frames))))
+		if err != nil || got != frames {
+			t.Errorf("counted %d frames (err %v), want %d", got, err, frames)
+		}
+	}
+
+	raw := animatedGIF(8, 8, 3)
+	hostile := []struct {
+		name string
+		raw  []byte
+	}{
+		{"not a GIF", []byte("PNG1234567890123")},
+		{"truncated", raw[:len(raw)/2]},
+		{"unknown block", append(bytes.Clone(raw[:len(raw)-1]), 0x99)},
+	}
+	for _, tt := range hostile {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := countGIFFrames(bufio.NewReader(bytes.NewReader(tt.raw))); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestStillPreviewRejectsHugeHeaders(t *testing.T) {
+	// a valid PNG header claiming 100000 x 100000 pixels, with no image data
+	var small bytes.Buffer
+	png.Encode(&small, image.NewGray(image.Rect(0, 0, 1, 1)))
+	raw := small.Bytes()
+	binary.BigEndian.PutUint32(raw[16:], 100000)
+	binary.BigEndian.PutUint32(raw[20:], 100000)
+
+	var buf bytes.Buffer
+	if err := encodeStillPreview(tempFile(t, raw), ".png", &buf); err == nil {
+		t.Error("expected the header size to be refused")
+	}
+
+}
@@ -0,0 +1,335 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"angadrive/socketHandler"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ulikunitz/xz"
+)
+
+const maxArchiveEntries = 10000
+
+// entries nested deeper than this many directories are left out of listings.
+// Archives inside the archive are listed as plain files, never opened.
+const maxArchiveDepth = 32
+
+// maxArchiveScanBytes caps how much of a tarball is decompressed while
+// looking through its headers, a few MB of gzip can expand to terabytes.
+// It is a var so tests don't have to decompress a gigabyte.
+var maxArchiveScanBytes int64 = 1 << 30
+
+type ArchiveEntry struct {
+	Path           string `json:"path"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size,omitempty"` // only zips store this per entry
+	Modified       int64  `json:"modified"`
+	IsDir          bool   `json:"is_dir"`
+}
+
+type ArchiveListing struct {
+	Format    string         `json:"format"`
+	Entries   []ArchiveEntry `json:"entries"`
+	Truncated bool           `json:"truncated"` // more than maxArchiveEntries entries or maxArchiveScanBytes
+	TooDeep   int            `json:"too_deep"`  // entries skipped for being too many directories deep
+}
+
+var errNotArchive = errors.New("file is not a supported archive")
+var errEntryNotFound = errors.New("entry not found in archive")
+var errArchiveTooLarge = errors.New("archive is too large to look through")
+
+// archiveFormat works off the original name, the stored blob only keeps the last extension.
+func archiveFormat(originalFileName string) string {
+	name := strings.ToLower(originalFileName)
+	switch {
+	case strings.HasSuffix(name, ".zip"), strings.HasSuffix(name, ".jar"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"):
+		return "tar.bz2"
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return "tar.xz"
+	}
+	return ""
+}
+
+// cleanArchivePath normalizes an entry name the way it is shown in listings,
+// it returns "" for names that can't be represented (e.g. only "../").
+func cleanArchivePath(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Clean("/" + name)
+	return strings.TrimPrefix(name, "/")
+}
+
+func archiveDepth(entryPath string) int {
+	return strings.Count(entryPath, "/") + 1
+}
+
+func returnArchiveListing(c *gin.Context) {
+	go socketHandler.SiteActivityPulse()
+
+	fileDirectory := c.Param("file_directory")
+
+	// this creates: /uploaded_files/archive_listings/<file_directory>.json
+	listingFile := filepath.Join(UPLOAD_DIR, "archive_listings", fileDirectory+".json")
+	fileInfo, err := database.GetFile(fileDirectory)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if _, err := os.Stat(listingFile); err == nil {
+		servePreview(c, listingFile)
+		return
+	}
+
+	listing, err := listArchive(fileInfo)
+	if err == errNotArchive {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to read archive: " + err.Error()})
+		return
+	}
+
+	raw, err := json.Marshal(listing)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to encode listing: "+err.Error())
+		return
+	}
+	writePreviewFile(listingFile, bytes.NewReader(raw))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", raw)
+}
+
+func listArchive(fileInfo database.FileData) (ArchiveListing, error) {
+	listing := ArchiveListing{Format: archiveFormat(fileInfo.OriginalFileName), Entries: []ArchiveEntry{}}
+	if listing.Format == "" {
+		return listing, errNotArchive
+	}
+	archivePath := filepath.Join(UPLOAD_DIR, "i", fileInfo.Md5sum)
+
+	// every header read counts, skipped ones included, or an archive of
+	// nothing but deeply nested entries is walked to its very end
+	seen := 0
+	add := func(entry ArchiveEntry) bool {
+		if seen >= maxArchiveEntries {
+			listing.Truncated = true
+			return false
+		}
+		seen++
+		if entry.Path == "" {
+			return true
+		}
+		if archiveDepth(entry.Path) > maxArchiveDepth {
+			listing.TooDeep++
+			return true
+		}
+		listing.Entries = append(listing.Entries, entry)
+		return true
+	}
+
+	if listing.Format == "zip" {
+		reader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return listing, err
+		}
+		defer reader.Close()
+		for _, f := range reader.File {
+			if !add(ArchiveEntry{
+				Path:           cleanArchivePath(f.Name),
+				Size:           int64(f.UncompressedSize64),
+				CompressedSize: int64(f.CompressedSize64),
+				Modified:       f.Modified.Unix(),
+				IsDir:          f.FileInfo().IsDir(),
+			}) {
+				break
+			}
+		}
+		return listing, nil
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return listing, err
+	}
+	defer file.Close()
+	tarReader, budget, err := openTar(file, listing.Format)
+	if err != nil {
+		return listing, err
+	}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF && budget.N > 0 {
+			break
+		}
+		if err != nil && budget.N <= 0 {
+			// what was read so far is still worth showing
+			listing.Truncated = true
+			break
+		}
+		if err != nil {
+			return listing, err
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if !add(ArchiveEntry{
+			Path:     cleanArchivePath(header.Name),
+			Size:     header.Size,
+			Modified: header.ModTime.Unix(),
+			IsDir:    header.Typeflag == tar.TypeDir,
+		}) {
+			break
+		}
+	}
+	return listing, nil
+}
+
+// openTar decompresses r as format, reading at most maxArchiveScanBytes of
+// decompressed data. The budget runs out when its N reaches 0, the tar reader
+// then fails as if the archive was cut off.
+func openTar(r io.Reader, format string) (*tar.Reader, *io.LimitedReader, error) {
+	switch format {
+	case "tar.gz":
+		gzReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		r = gzReader
+	case "tar.bz2":
+		r = bzip2.NewReader(r)
+	case "tar.xz":
+		xzReader, err := xz.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		r = xzReader
+	}
+	budget := &io.LimitedReader{R: r, N: maxArchiveScanBytes}
+	return tar.NewReader(budget), budget, nil
+}
+
+// returnArchiveEntry streams a single file out of an archive, the entry is
+// picked by its path as shown in the listing (?path=...). ?download=true
+// serves it as an attachment.
+func returnArchiveEntry(c *gin.Context) {
+	go socketHandler.SiteActivityPulse()
+
+	fileInfo, err := database.GetFile(c.Param("file_directory"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	format := archiveFormat(fileInfo.OriginalFileName)
+	if format == "" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": errNotArchive.Error()})
+		return
+	}
+	entryPath := cleanArchivePath(c.Query("path"))
+	if entryPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return
+	}
+	archivePath := filepath.Join(UPLOAD_DIR, "i", fileInfo.Md5sum)
+
+	// the archive never changes, so neither does any entry in it
+	entryHash := md5.Sum([]byte(entryPath))
+	if notModified(c, blobETag(fileInfo, "entry-"+hex.EncodeToString(entryHash[:8])), immutableCacheControl) {
+		return
+	}
+	if format == "zip" {
+		err = streamZipEntry(c, archivePath, entryPath)
+	} else {
+		err = streamTarEntry(c, archivePath, format, entryPath)
+	}
+	if err == errEntryNotFound {
+		clearCacheHeaders(c)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil && !c.Writer.Written() {
+		clearCacheHeaders(c)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to read archive: " + err.Error()})
+	}
+}
+
+func streamZipEntry(c *gin.Context, archivePath string, entryPath string) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for i, f := range reader.File {
+		// entries past the cap aren't listed, so they can't be asked for
+		if i >= maxArchiveEntries {
+			break
+		}
+		if cleanArchivePath(f.Name) != entryPath || f.FileInfo().IsDir() {
+			continue
+		}
+		entry, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer entry.Close()
+		serveArchiveEntry(c, entryPath, int64(f.UncompressedSize64), entry)
+		return nil
+	}
+	return errEntryNotFound
+}
+
+func streamTarEntry(c *gin.Context, archivePath string, format string, entryPath string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	tarReader, budget, err := openTar(file, format)
+	if err != nil {
+		return err
+	}
+	for seen := 0; seen < maxArchiveEntries; seen++ {
+		header, err := tarReader.Next()
+		if err == io.EOF && budget.N > 0 {
+			return errEntryNotFound
+		}
+		if err != nil && budget.N <= 0 {
+			return errArchiveTooLarge
+		}
+		if err != nil {
+			return err
+		}
+		// links and devices have no data of their own
+		if header.Typeflag != tar.TypeReg || cleanArchivePath(header.Name) != entryPath {
+			continue
+		}
+		// the budget is for finding the entry, not for the entry itself
+		budget.N += header.Size
+		serveArchiveEntry(c, entryPath, header.Size, tarReader)
+		return nil
+	}
+	return errEntryNotFound
+}
+
+func serveArchiveEntry(c *gin.Context, entryPath string, size int64, r io.Reader) {
+	contentType := setServingHeaders(c, entryPath, c.Query("download") == "true")
+	c.DataFromReader(http.StatusOK, size, contentType, r, nil)
+}
@@ -0,0 +1,174 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type archiveTestEntry struct {
+	name string
+	body string
+}
+
+func buildZip(entries []archiveTestEntry) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		f, _ := w.Create(entry.name)
+		f.Write([]byte(entry.body))
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func buildTar(entries []archiveTestEntry) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		w.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.body)), Typeflag: tar.TypeReg})
+		w.Write([]byte(entry.body))
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func gzipped(raw []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(raw)
+	w.Close()
+	return buf.Bytes()
+}
+
+// nested returns count entries each nested depth directories deep.
+func nested(count int, depth int) []archiveTestEntry {
+	entries := make([]archiveTestEntry, count)
+	for i := range entries {
+		entries[i] = archiveTestEntry{name: strings.Repeat("d/", depth-1) + "f" + string(rune('a'+i%26))}
+	}
+	return entries
+}
+
+func TestListArchive(t *testing.T) {
+	UPLOAD_DIR = t.TempDir()
+	os.MkdirAll(filepath.Join(UPLOAD_DIR, "i"), os.ModePerm)
+
+	tests := []struct {
+		name      string
+		fileName  string
+		raw       []byte
+		entries   int
+		tooDeep   int
+		truncated bool
+	}{
+		{"zip", "a.zip", buildZip([]archiveTestEntry{{"a.txt", "a"}, {"dir/b.txt", "b"}}), 2, 0, false},
+		{"tar", "a.tar", buildTar([]archiveTestEntry{{"a.txt", "a"}}), 1, 0, false},
+		{"traversal is cleaned", "a.zip", buildZip([]archiveTestEntry{{"../../etc/passwd", ""}}), 1, 0, false},
+		{"too deep", "a.zip", buildZip(nested(3, maxArchiveDepth+1)), 0, 3, false},
+		{"too many entries", "a.tar", buildTar(nested(maxArchiveEntries+1, 1)), maxArchiveEntries, 0, true},
+		// skipped entries still count, the walk must stop after maxArchiveEntries headers
+		{"too many deep entries", "a.zip", buildZip(nested(maxArchiveEntries+5, maxArchiveDepth+1)), 0, maxArchiveEntries, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := database.FileData{OriginalFileName: tt.fileName, Md5sum: "archive"}
+			if err := os.WriteFile(filepath.Join(UPLOAD_DIR, "i", file.Md5sum), tt.raw, 0644); err != nil {
+				t.Fatal(err)
+			}
+			listing, err := listArchive(file)
+			if err != nil {
+				t.Fatalf("listArchive: %v", err)
+			}
+			if len(listing.Entries) != tt.entries || listing.TooDeep != tt.tooDeep || listing.Truncated != tt.truncated {
+				t.Errorf("got %d entries, %d too deep, truncated %v; want %d, %d, %v",
+					len(listing.Entries), listing.TooDeep, listing.Truncated, tt.entries, tt.tooDeep, tt.truncated)
+			}
+		})
+	}
+
+	if _, err := listArchive(database.FileData{OriginalFileName: "a.txt"}); err != errNotArchive {
+		t.Errorf("got %v for a text file, want errNotArchive", err)
+	}
+}
+
+func TestArchiveScanBudget(t *testing.T) {
+	setupUploads(t)
+	scanBytes := maxArchiveScanBytes
+	maxArchiveScanBytes = 64 * 1024
+	t.Cleanup(func() { maxArchiveScanBytes = scanBytes })
+
+	// a first entry larger than the budget hides everything after it
+	padding := strings.Repeat("\x00", int(maxArchiveScanBytes))
+	raw := gzipped(buildTar([]archiveTestEntry{{"big.bin", padding}, {"after.txt", "after"}}))
+	file := storeTestFile(t, "bomb.tar.gz", raw, "owner-token")
+
+	listing, err := listArchive(file)
+	if err != nil {
+		t.Fatalf("listArchive: %v", err)
+	}
+	if !listing.Truncated || len(listing.Entries) != 1 {
+		t.Errorf("got %d entries, truncated %v; want 1, true", len(listing.Entries), listing.Truncated)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/archive/:file_directory/entry", returnArchiveEntry)
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+	}{
+		{"entry within the budget", "big.bin", http.StatusOK, padding},
+		{"entry past the budget", "after.txt", http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/archive/bomb.tar.gz/entry?path="+tt.path, nil))
+			if response.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", response.Code, tt.status, response.Body.String())
+			}
+			if tt.body != "" && response.Body.String() != tt.body {
+				t.Errorf("got %d bytes, want %d", response.Body.Len(), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestStreamEntriesPastTheCap(t *testing.T) {
+	setupUploads(t)
+	entries := nested(maxArchiveEntries, 1)
+	entries = append(entries, archiveTestEntry{"last.txt", "last"})
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"zip", buildZip(entries)},
+		{"tar", buildTar(entries)},
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/archive/:file_directory/entry", returnArchiveEntry)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storeTestFile(t, "capped."+tt.name, tt.raw, "owner-token")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/archive/capped."+tt.name+"/entry?path=last.txt", nil))
+			if response.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d for an entry the listing doesn't show", response.Code, http.StatusNotFound)
+			}
+		})
+	}
+}
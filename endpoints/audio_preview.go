@@ -0,0 +1,270 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"angadrive/socketHandler"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+)
+
+// the waveform is decoded at this rate, plenty for drawing peaks
+const waveformSampleRate = 8000
+const waveformBuckets = 1000
+
+var audioExtensions = map[string]bool{
+	".mp3":  true,
+	".m4a":  true,
+	".aac":  true,
+	".flac": true,
+	".ogg":  true,
+	".opus": true,
+	".wav":  true,
+	".wma":  true,
+}
+
+type AudioPreview struct {
+	Title    string    `json:"title,omitempty"`
+	Artist   string    `json:"artist,omitempty"`
+	Album    string    `json:"album,omitempty"`
+	Duration float64   `json:"duration"`
+	HasCover bool      `json:"has_cover"`
+	Waveform []float64 `json:"waveform"` // peak amplitude per bucket, 0 to 1
+}
+
+func audioPreviewFile(fileDirectory string) string {
+	// this creates: /uploaded_files/audio_previews/<file_directory>.json
+	return filepath.Join(UPLOAD_DIR, "audio_previews", fileDirectory+".json")
+}
+
+func audioCoverFile(fileDirectory string) string {
+	return filepath.Join(UPLOAD_DIR, "image_previews", fileDirectory)
+}
+
+func returnAudioPreview(c *gin.Context) {
+	go socketHandler.SiteActivityPulse()
+
+	fileDirectory := c.Param("file_directory")
+	if !audioExtensions[strings.ToLower(filepath.Ext(fileDirectory))] {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "file is not a supported audio file"})
+		return
+	}
+	// generateOnce serves a cached preview without looking at the file again
+	if _, err := database.GetFile(fileDirectory); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	previewFile := audioPreviewFile(fileDirectory)
+	generate := func() error { return generateAudioPreview(fileDirectory) }
+	if err := generateOnce(fileDirectory, previewFile, generate); err != nil {
+		c.String(http.StatusInternalServerError, "Failed to generate preview: "+err.Error())
+		return
+	}
+	servePreview(c, previewFile)
+}
+
+// returnAudioCover serves the embedded cover art of an audio file on the image preview route.
+func returnAudioCover(c *gin.Context, fileDirectory string) {
+	if _, err := database.GetFile(fileDirectory); err != nil {
+		c.String(http.StatusNotFound, "File not found")
+		return
+	}
+	generate := func() error { return generateAudioPreview(fileDirectory) }
+	if err := generateOnce(fileDirectory, audioPreviewFile(fileDirectory), generate); err != nil {
+		c.String(http.StatusInternalServerError, "Failed to generate preview: "+err.Error())
+		return
+	}
+	coverFile := audioCoverFile(fileDirectory)
+	if _, err := os.Stat(coverFile); err != nil {
+		// the cover can be evicted from the preview cache on its own, the
+		// JSON staying behind means generateAudioPreview won't run again
+		fileInfo, err := database.GetFile(fileDirectory)
+		if err != nil || !fileInfo.HasCover {
+			c.String(http.StatusNotFound, "Audio file has no cover art")
+			return
+		}
+		generate := func() error { return generateAudioCover(fileInfo) }
+		if err := generateOnce("cover/"+fileDirectory, coverFile, generate); err != nil {
+			c.String(http.StatusInternalServerError, "Failed to generate preview: "+err.Error())
+			return
+		}
+	}
+	servePreview(c, coverFile)
+}
+
+// generateAudioCover extracts the cover art of an audio file again, without
+// redoing the rest of its preview.
+func generateAudioCover(fileInfo database.FileData) error {
+	file, err := os.Open(filepath.Join(UPLOAD_DIR, "i", fileInfo.Md5sum))
+	if err != nil {
+		return fmt.Errorf("failed to open original file: %w", err)
+	}
+	defer file.Close()
+	metadata, err := tag.ReadFrom(file)
+	if err != nil {
+		return fmt.Errorf("failed to read tags: %w", err)
+	}
+	picture := metadata.Picture()
+	if picture == nil {
+		return fmt.Errorf("audio file has no cover art")
+	}
+	return writeAudioCover(fileInfo.FileDirectory, picture.Data)
+}
+
+// generateAudioPreview reads the tags and cover art of an audio file, stores
+// them on the file record and writes the waveform JSON.
+func generateAudioPreview(fileDirectory string) error {
+	fileInfo, err := database.GetFile(fileDirectory)
+	if err != nil {
+		return fmt.Errorf("file not found: %w", err)
+	}
+	audioPath := filepath.Join(UPLOAD_DIR, "i", fileInfo.Md5sum)
+	file, err := os.Open(audioPath)
+	if err != nil {
+		return fmt.Errorf("failed to open original file: %w", err)
+	}
+	defer file.Close()
+
+	var preview AudioPreview
+	// untagged files are common, they just get no title/cover
+	if metadata, err := tag.ReadFrom(file); err == nil {
+		preview.Title = strings.TrimSpace(metadata.Title())
+		preview.Artist = strings.TrimSpace(metadata.Artist())
+		preview.Album = strings.TrimSpace(metadata.Album())
+		if picture := metadata.Picture(); picture != nil {
+			if err := writeAudioCover(fileDirectory, picture.Data); err != nil {
+				fmt.Printf("Warning: Failed to extract cover art of %s: %v\n", fileDirectory, err)
+			} else {
+				preview.HasCover = true
+			}
+		}
+	}
+
+	preview.Duration, preview.Waveform, err = audioWaveform(audioPath)
+	if err != nil {
+		// the tags are still worth keeping without ffmpeg, and writing the
+		// JSON anyway keeps every request from running ffmpeg again
+		fmt.Printf("Warning: Failed to draw the waveform of %s: %v\n", fileDirectory, err)
+		preview.Duration, preview.Waveform = 0, []float64{}
+	}
+
+	if _, err := fileInfo.SetAudioInfo(preview.Title, preview.Artist, preview.Album, preview.Duration, preview.HasCover); err != nil {
+		return fmt.Errorf("failed to store audio info: %w", err)
+	}
+	raw, err := json.Marshal(preview)
+	if err != nil {
+		return err
+	}
+	return writePreviewFile(audioPreviewFile(fileDirectory), bytes.NewReader(raw))
+}
+
+func writeAudioCover(fileDirectory string, data []byte) error {
+	if err := checkStillSourceSize(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	newWidth, newHeight := previewDimensions(img.Bounds().Dx(), img.Bounds().Dy())
+	if img.Bounds().Dx() > newWidth {
+		img = imaging.Resize(img, newWidth, newHeight, imaging.Lanczos)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		return err
+	}
+	coverFile := audioCoverFile(fileDirectory)
+	if err := writePreviewFile(coverFile, &buf); err != nil {
+		return err
+	}
+	storePlaceholder(fileDirectory, coverFile)
+	return nil
+}
+
+// audioWaveform decodes the audio to mono PCM with ffmpeg and returns its
+// duration and the peak amplitude of waveformBuckets equal slices of it.
+func audioWaveform(audioPath string) (float64, []float64, error) {
+	cmd := exec.Command("ffmpeg",
+		"-i", audioPath,
+		"-vn",
+		"-ac", "1",
+		"-ar", fmt.Sprint(waveformSampleRate),
+		"-f", "s16le",
+		"-",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return 0, nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	// peaks of 10ms windows first, since the total length isn't known until the end
+	const window = waveformSampleRate / 100
+	var peaks []float64
+	var samples int
+	peak := 0.0
+	chunk := make([]byte, 64*1024)
+	for {
+		n, err := io.ReadFull(stdout, chunk)
+		for i := 0; i+1 < n; i += 2 {
+			sample := int16(binary.LittleEndian.Uint16(chunk[i:]))
+			peak = math.Max(peak, math.Abs(float64(sample))/32768)
+			samples++
+			if samples%window == 0 {
+				peaks = append(peaks, peak)
+				peak = 0
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			cmd.Wait()
+			return 0, nil, err
+		}
+	}
+	if samples%window != 0 {
+		peaks = append(peaks, peak)
+	}
+	if err := cmd.Wait(); err != nil {
+		return 0, nil, fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	waveform := make([]float64, 0, waveformBuckets)
+	if len(peaks) <= waveformBuckets {
+		waveform = append(waveform, peaks...)
+	} else {
+		for i := 0; i < waveformBuckets; i++ {
+			start := i * len(peaks) / waveformBuckets
+			end := (i + 1) * len(peaks) / waveformBuckets
+			bucket := 0.0
+			for _, p := range peaks[start:end] {
+				bucket = math.Max(bucket, p)
+			}
+			waveform = append(waveform, bucket)
+		}
+	}
+	for i := range waveform {
+		waveform[i] = math.Round(waveform[i]*1000) / 1000 // keeps the JSON small
+	}
+	return float64(samples) / waveformSampleRate, waveform, nil
+}
@@ -0,0 +1,96 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mp3WithCover is an ID3v2.3 tag holding cover as its picture, followed by
+// bytes ffmpeg can't decode.
+func mp3WithCover(cover []byte) []byte {
+	var apic bytes.Buffer
+	apic.WriteByte(0) // ISO-8859-1
+	apic.WriteString("image/jpeg\x00")
+	apic.WriteByte(3) // front cover
+	apic.WriteString("\x00")
+	apic.Write(cover)
+
+	var frame bytes.Buffer
+	frame.WriteString("APIC")
+	binary.Write(&frame, binary.BigEndian, uint32(apic.Len()))
+	frame.Write([]byte{0, 0})
+	frame.Write(apic.Bytes())
+
+	size := frame.Len()
+	var tag bytes.Buffer
+	tag.WriteString("ID3\x03\x00\x00")
+	tag.Write([]byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)})
+	tag.Write(frame.Bytes())
+	tag.WriteString("not really audio")
+	return tag.Bytes()
+}
+
+func TestAudioCover(t *testing.T) {
+	setupUploads(t)
+	var cover bytes.Buffer
+	jpeg.Encode(&cover, tinyImage(), nil)
+	storeTestFile(t, "song.mp3", mp3WithCover(cover.Bytes()), "owner-token")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/cover/:file_directory", func(c *gin.Context) { returnAudioCover(c, c.Param("file_directory")) })
+	request := func() *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/cover/song.mp3", nil))
+		return response
+	}
+
+	// the waveform can't be drawn, the preview is still stored so it isn't retried
+	if response := request(); response.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", response.Code, response.Body.String())
+	}
+	if _, err := os.Stat(audioPreviewFile("song.mp3")); err != nil {
+		t.Fatalf("preview JSON wasn't written after the waveform failed: %v", err)
+	}
+	if fileInfo, _ := database.GetFile("song.mp3"); !fileInfo.HasCover {
+		t.Error("HasCover wasn't stored")
+	}
+
+	// the cover is evicted on its own
+	if err := os.Remove(audioCoverFile("song.mp3")); err != nil {
+		t.Fatal(err)
+	}
+	if response := request(); response.Code != http.StatusOK {
+		t.Fatalf("status after eviction = %d: %s", response.Code, response.Body.String())
+	}
+	if _, err := os.Stat(audioCoverFile("song.mp3")); err != nil {
+		t.Errorf("cover wasn't regenerated: %v", err)
+	}
+}
+
+func TestAudioCoverChecksSize(t *testing.T) {
+	setupUploads(t)
+	storeTestFile(t, "bomb.mp3", mp3WithCover(pngWithSize(60000, 60000)), "owner-token")
+
+	if err := writeAudioCover("bomb.mp3", pngWithSize(60000, 60000)); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("got %v, want a size error", err)
+	}
+	if err := generateAudioPreview("bomb.mp3"); err != nil {
+		t.Fatalf("preview failed: %v", err)
+	}
+	if _, err := os.Stat(audioCoverFile("bomb.mp3")); err == nil {
+		t.Error("oversized cover was written")
+	}
+	if fileInfo, _ := database.GetFile("bomb.mp3"); fileInfo.HasCover {
+		t.Error("HasCover was stored for a cover that was refused")
+	}
+}
@@ -0,0 +1,112 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// blobs are content-addressed, a URL can only ever point at the same bytes
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// images whose metadata may be stripped can change when the owner flips the
+// setting, so caches have to check back (cheap thanks to the ETag)
+const revalidateCacheControl = "public, no-cache"
+
+// previews can be evicted and regenerated, but rarely change
+const previewCacheControl = "public, max-age=86400"
+
+// blobETag is a strong ETag derived from the blob's MD5. variant tells
+// apart other representations of the same blob, like stripped images.
+func blobETag(file database.FileData, variant string) string {
+	hash := strings.TrimSuffix(file.Md5sum, filepath.Ext(file.Md5sum))
+	if variant != "" {
+		hash += "-" + variant
+	}
+	return `"` + hash + `"`
+}
+
+func blobCacheControl(file database.FileData) string {
+	if canStripMetadata(file) {
+		return revalidateCacheControl
+	}
+	return immutableCacheControl
+}
+
+// notModified sets the validators of a response and answers 304 when the
+// client's If-None-Match already covers etag.
+func notModified(c *gin.Context, etag string, cacheControl string) bool {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", cacheControl)
+	ifNoneMatch := c.GetHeader("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/") // If-None-Match uses weak comparison
+		if candidate == "*" || candidate == etag {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// clearCacheHeaders drops the validators set by notModified when the
+// response turns out to be an error after all.
+func clearCacheHeaders(c *gin.Context) {
+	c.Writer.Header().Del("ETag")
+	c.Writer.Header().Del("Cache-Control")
+}
+
+// setDigestHeaders adds the legacy Digest header (MD5, always known) and
+// Repr-Digest (SHA-256) once the blob's SHA-256 has been computed.
+func setDigestHeaders(c *gin.Context, file database.FileData) {
+	md5sum, err := hex.DecodeString(strings.TrimSuffix(file.Md5sum, filepath.Ext(file.Md5sum)))
+	if err == nil {
+		c.Header("Digest", "md5="+base64.StdEncoding.EncodeToString(md5sum))
+	}
+	if file.Sha256 == "" {
+		backfillSha256(file)
+		return
+	}
+	if sha, err := hex.DecodeString(file.Sha256); err == nil {
+		c.Header("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sha)+":")
+	}
+}
+
+// fileDirectory -> true while its SHA-256 is being computed
+var sha256Backfills sync.Map
+
+// backfillSha256 hashes the blob of a file uploaded before SHA-256s were
+// stored, in the background so big files don't hold up the response.
+func backfillSha256(file database.FileData) {
+	if _, running := sha256Backfills.LoadOrStore(file.FileDirectory, true); running {
+		return
+	}
+	go func() {
+		defer sha256Backfills.Delete(file.FileDirectory)
+		blob, err := os.Open(filepath.Join(UPLOAD_DIR, "i", file.Md5sum))
+		if err != nil {
+			return
+		}
+		defer blob.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, blob); err != nil {
+			return
+		}
+		if _, err := file.SetSha256(hex.EncodeToString(hash.Sum(nil))); err != nil {
+			fmt.Printf("Warning: Failed to store SHA-256 for %s: %v\n", file.FileDirectory, err)
+		}
+	}()
+}
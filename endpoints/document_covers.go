@@ -0,0 +1,507 @@
+package endpoints
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// extractCover pulls the embedded cover image out of formats that declare one
+// (EPUB, FB2 and MOBI). Formats without a declared cover return an error and
+// the caller falls back to rendering the first page.
+func extractCover(raw []byte, ext string) (image.Image, error) {
+	var coverBytes []byte
+	var err error
+	switch ext {
+	case ".epub":
+		coverBytes, err = epubCover(raw)
+	case ".fb2":
+		coverBytes, err = fb2Cover(raw)
+	case ".mobi":
+		coverBytes, err = mobiCover(raw)
+	default:
+		return nil, fmt.Errorf("no embedded cover for %s", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the cover is as untrusted as any upload, its header can claim any size
+	if err := checkStillSourceSize(bytes.NewReader(coverBytes)); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(coverBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover: %w", err)
+	}
+	return img, nil
+}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Metas []struct {
+		Name    string `xml:"name,attr"`
+		Content string `xml:"content,attr"`
+	} `xml:"metadata>meta"`
+	Items []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+}
+
+func readZipEntry(archive *zip.Reader, name string) ([]byte, error) {
+	entry, err := archive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Close()
+	return io.ReadAll(io.LimitReader(entry, 50*1024*1024))
+}
+
+// epubCover follows META-INF/container.xml to the OPF package and picks the
+// manifest item marked as the cover (EPUB 3 properties, then the EPUB 2
+// <meta name="cover"> convention, then anything image-like named "cover").
+func epubCover(raw []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open EPUB: %w", err)
+	}
+	containerXML, err := readZipEntry(archive, "META-INF/container.xml")
+	if err != nil {
+		return nil, fmt.Errorf("EPUB has no container.xml: %w", err)
+	}
+	var container epubContainer
+	if err := xml.Unmarshal(containerXML, &container); err != nil || len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("EPUB container.xml has no rootfile")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	opfXML, err := readZipEntry(archive, opfPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EPUB package: %w", err)
+	}
+	var pkg epubPackage
+	if err := xml.Unmarshal(opfXML, &pkg); err != nil {
+		return nil, fmt.Errorf("failed to parse EPUB package: %w", err)
+	}
+
+	coverHref := ""
+	for _, item := range pkg.Items {
+		if strings.Contains(" "+item.Properties+" ", " cover-image ") {
+			coverHref = item.Href
+			break
+		}
+	}
+	if coverHref == "" {
+		coverID := ""
+		for _, meta := range pkg.Metas {
+			if meta.Name == "cover" {
+				coverID = meta.Content
+				break
+			}
+		}
+		for _, item := range pkg.Items {
+			if coverID != "" && item.ID == coverID {
+				coverHref = item.Href
+				break
+			}
+		}
+	}
+	if coverHref == "" {
+		for _, item := range pkg.Items {
+			if strings.HasPrefix(item.MediaType, "image/") && strings.Contains(strings.ToLower(item.ID+item.Href), "cover") {
+				coverHref = item.Href
+				break
+			}
+		}
+	}
+	if coverHref == "" {
+		return nil, fmt.Errorf("EPUB declares no cover image")
+	}
+	return readZipEntry(archive, path.Join(path.Dir(opfPath), coverHref))
+}
+
+type fb2Document struct {
+	CoverImages []struct {
+		Attrs []xml.Attr `xml:",any,attr"`
+	} `xml:"description>title-info>coverpage>image"`
+	Binaries []struct {
+		ID   string `xml:"id,attr"`
+		Data string `xml:",chardata"`
+	} `xml:"binary"`
+}
+
+// fb2Cover resolves <coverpage><image l:href="#id"/> to its base64 <binary>.
+func fb2Cover(raw []byte) ([]byte, error) {
+	var doc fb2Document
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	// FB2 files are frequently windows-1251; the cover lives in ASCII-only
+	// attributes and base64 so the text can be passed through unconverted.
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse FB2: %w", err)
+	}
+	coverID := ""
+	for _, img := range doc.CoverImages {
+		for _, attr := range img.Attrs {
+			if attr.Name.Local == "href" {
+				coverID = strings.TrimPrefix(attr.Value, "#")
+			}
+		}
+		if coverID != "" {
+			break
+		}
+	}
+	if coverID == "" {
+		return nil, fmt.Errorf("FB2 declares no cover image")
+	}
+	for _, binary := range doc.Binaries {
+		if binary.ID == coverID {
+			return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(binary.Data), ""))
+		}
+	}
+	return nil, fmt.Errorf("FB2 cover %q not found", coverID)
+}
+
+// mobiBook is the subset of a MOBI (PalmDB) file needed for previews.
+type mobiBook struct {
+	raw             []byte
+	recordOffsets   []uint32
+	firstImageIndex uint32
+	title           string
+	author          string
+	coverOffset     int64 // -1 when the book declares no cover
+
+	compression     uint16 // 1 = none, 2 = PalmDOC, 17480 = HUFF/CDIC
+	encrypted       bool
+	textLength      uint32
+	textRecordCount int
+	encoding        uint32 // 65001 = UTF-8, otherwise CP1252
+	extraDataFlags  uint16 // trailing entries to strip from each text record
+}
+
+// parseMobi reads the PalmDB record table, the MOBI header in record 0 and
+// its EXTH block (100 = author, 201 = cover offset, 503 = updated title).
+func parseMobi(raw []byte) (mobiBook, error) {
+	book := mobiBook{raw: raw, coverOffset: -1}
+	if len(raw) < 78 || string(raw[60:68]) != "BOOKMOBI" {
+		return book, fmt.Errorf("not a MOBI file")
+	}
+	numRecords := int(binary.BigEndian.Uint16(raw[76:78]))
+	if len(raw) < 78+numRecords*8 || numRecords == 0 {
+		return book, fmt.Errorf("truncated MOBI record table")
+	}
+	for i := 0; i < numRecords; i++ {
+		book.recordOffsets = append(book.recordOffsets, binary.BigEndian.Uint32(raw[78+i*8:]))
+	}
+
+	record0, err := book.record(0)
+	if err != nil {
+		return book, err
+	}
+	if len(record0) < 132 || string(record0[16:20]) != "MOBI" {
+		return book, fmt.Errorf("missing MOBI header")
+	}
+	book.compression = binary.BigEndian.Uint16(record0[0:2])
+	book.textLength = binary.BigEndian.Uint32(record0[4:8])
+	book.textRecordCount = int(binary.BigEndian.Uint16(record0[8:10]))
+	book.encrypted = binary.BigEndian.Uint16(record0[12:14]) != 0
+	book.encoding = binary.BigEndian.Uint32(record0[28:32])
+	headerLength := binary.BigEndian.Uint32(record0[20:24])
+	if headerLength >= 0xE4 && len(record0) >= 244 {
+		book.extraDataFlags = binary.BigEndian.Uint16(record0[242:244])
+	}
+	fullNameOffset := binary.BigEndian.Uint32(record0[84:88])
+	fullNameLength := binary.BigEndian.Uint32(record0[88:92])
+	book.firstImageIndex = binary.BigEndian.Uint32(record0[108:112])
+	if end := uint64(fullNameOffset) + uint64(fullNameLength); end <= uint64(len(record0)) {
+		book.title = string(record0[fullNameOffset:end])
+	}
+
+	exthFlags := binary.BigEndian.Uint32(record0[128:132])
+	exthStart := 16 + uint64(headerLength)
+	if exthFlags&0x40 == 0 || exthStart+12 > uint64(len(record0)) || string(record0[exthStart:exthStart+4]) != "EXTH" {
+		return book, nil
+	}
+	count := binary.BigEndian.Uint32(record0[exthStart+8:])
+	pos := exthStart + 12
+	for i := uint32(0); i < count && pos+8 <= uint64(len(record0)); i++ {
+		recordType := binary.BigEndian.Uint32(record0[pos:])
+		recordLength := uint64(binary.BigEndian.Uint32(record0[pos+4:]))
+		if recordLength < 8 || pos+recordLength > uint64(len(record0)) {
+			break
+		}
+		data := record0[pos+8 : pos+recordLength]
+		switch recordType {
+		case 100:
+			book.author = string(data)
+		case 201:
+			if len(data) >= 4 {
+				book.coverOffset = int64(binary.BigEndian.Uint32(data))
+			}
+		case 503:
+			book.title = string(data)
+		}
+		pos += recordLength
+	}
+	return book, nil
+}
+
+func (book mobiBook) record(index int) ([]byte, error) {
+	if index < 0 || index >= len(book.recordOffsets) {
+		return nil, fmt.Errorf("MOBI record %d out of range", index)
+	}
+	start := uint64(book.recordOffsets[index])
+	end := uint64(len(book.raw))
+	if index+1 < len(book.recordOffsets) {
+		end = uint64(book.recordOffsets[index+1])
+	}
+	if start > end || end > uint64(len(book.raw)) {
+		return nil, fmt.Errorf("MOBI record %d is corrupt", index)
+	}
+	return book.raw[start:end], nil
+}
+
+func mobiCover(raw []byte) ([]byte, error) {
+	book, err := parseMobi(raw)
+	if err != nil {
+		return nil, err
+	}
+	if book.coverOffset < 0 {
+		return nil, fmt.Errorf("MOBI declares no cover image")
+	}
+	return book.record(int(int64(book.firstImageIndex) + book.coverOffset))
+}
+
+// maxMobiTextSize caps the decompressed text of a MOBI, PalmDOC compresses
+// about 2:1 so anything near this is either huge or lying about its size.
+const maxMobiTextSize = 64 * 1024 * 1024
+
+// text decompresses the book's HTML from its text records.
+func (book mobiBook) text() ([]byte, error) {
+	if book.encrypted {
+		return nil, fmt.Errorf("MOBI is DRM protected")
+	}
+	if book.compression != 1 && book.compression != 2 {
+		return nil, fmt.Errorf("unsupported MOBI compression %d", book.compression)
+	}
+	if book.textLength > maxMobiTextSize {
+		return nil, fmt.Errorf("MOBI text is too large")
+	}
+	text := make([]byte, 0, book.textLength)
+	for i := 1; i <= book.textRecordCount; i++ {
+		record, err := book.record(i)
+		if err != nil {
+			return nil, err
+		}
+		record = trimTrailingEntries(record, book.extraDataFlags)
+		if book.compression == 2 {
+			text, err = palmDocDecompress(text, record, maxMobiTextSize)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			text = append(text, record...)
+		}
+		if len(text) > maxMobiTextSize {
+			return nil, fmt.Errorf("MOBI text is too large")
+		}
+	}
+	if book.encoding == 65001 {
+		return text, nil
+	}
+	return charmap.Windows1252.NewDecoder().Bytes(text)
+}
+
+// trimTrailingEntries strips the extra data a MOBI appends to text records.
+// Every flag above bit 0 is an entry ending in its own backward encoded size,
+// bit 0 is a multibyte overlap whose length is in its last byte.
+func trimTrailingEntries(record []byte, flags uint16) []byte {
+	for bit := 1; bit < 16; bit++ {
+		if flags&(1<<bit) == 0 {
+			continue
+		}
+		size := 0
+		tail := record
+		if len(tail) > 4 {
+			tail = tail[len(tail)-4:]
+		}
+		for _, b := range tail {
+			if b&0x80 != 0 {
+				size = 0
+			}
+			size = size<<7 | int(b&0x7f)
+		}
+		if size > len(record) {
+			return nil
+		}
+		record = record[:len(record)-size]
+	}
+	if flags&1 != 0 && len(record) > 0 {
+		size := int(record[len(record)-1]&3) + 1
+		if size > len(record) {
+			return nil
+		}
+		record = record[:len(record)-size]
+	}
+	return record
+}
+
+// palmDocDecompress appends the decompressed record to out. PalmDOC is LZ77
+// with byte codes: 1-8 copy that many literals, 0x09-0x7f is a literal,
+// 0x80-0xbf starts a two byte back reference and 0xc0-0xff is a space plus
+// a character.
+func palmDocDecompress(out []byte, record []byte, limit int) ([]byte, error) {
+	for i := 0; i < len(record); i++ {
+		if len(out) > limit {
+			return nil, fmt.Errorf("MOBI text is too large")
+		}
+		c := record[i]
+		switch {
+		case c >= 1 && c <= 8:
+			if i+int(c) >= len(record) {
+				return nil, fmt.Errorf("truncated PalmDOC literal")
+			}
+			out = append(out, record[i+1:i+1+int(c)]...)
+			i += int(c)
+		case c < 0x80:
+			out = append(out, c)
+		case c >= 0xc0:
+			out = append(out, ' ', c^0x80)
+		default:
+			if i+1 >= len(record) {
+				return nil, fmt.Errorf("truncated PalmDOC back reference")
+			}
+			pair := int(c)<<8 | int(record[i+1])
+			i++
+			distance := (pair >> 3) & 0x7ff
+			length := pair&7 + 3
+			if distance == 0 || distance > len(out) {
+				return nil, fmt.Errorf("corrupt PalmDOC back reference")
+			}
+			// byte by byte, a reference may overlap what it produces
+			for j := 0; j < length; j++ {
+				out = append(out, out[len(out)-distance])
+			}
+		}
+	}
+	return out, nil
+}
+
+var mobiImageReference = regexp.MustCompile(`(?i)recindex=["']?0*(\d+)["']?`)
+
+// mobiToEPUB repackages a MOBI as a single chapter EPUB so MuPDF can lay it
+// out and render its pages. Images referenced by recindex are carried along.
+func mobiToEPUB(raw []byte) ([]byte, error) {
+	book, err := parseMobi(raw)
+	if err != nil {
+		return nil, err
+	}
+	text, err := book.text()
+	if err != nil {
+		return nil, err
+	}
+	chapter, err := mobiChapter(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	// the mimetype entry goes first and uncompressed, it is how readers
+	// (and go-fitz) recognize an EPUB
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	io.WriteString(writer, "application/epub+zip")
+
+	manifest := `<item id="text" href="text.xhtml" media-type="application/xhtml+xml"/>`
+	written := make(map[string]bool)
+	for _, match := range mobiImageReference.FindAllSubmatch(chapter, -1) {
+		index, err := strconv.Atoi(string(match[1]))
+		if err != nil || index < 1 || written[string(match[1])] {
+			continue
+		}
+		imageRecord, err := book.record(int(book.firstImageIndex) + index - 1)
+		if err != nil {
+			continue
+		}
+		written[string(match[1])] = true
+		name := "images/" + string(match[1])
+		if writer, err = archive.Create(name); err != nil {
+			return nil, err
+		}
+		writer.Write(imageRecord)
+		manifest += fmt.Sprintf(`<item id="image%s" href="%s" media-type="%s"/>`, match[1], name, http.DetectContentType(imageRecord))
+	}
+	chapter = mobiImageReference.ReplaceAll(chapter, []byte(`src="images/$1"`))
+
+	files := []struct{ name, content string }{
+		{"META-INF/container.xml", `<?xml version="1.0"?><container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container"><rootfiles><rootfile full-path="content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`},
+		{"content.opf", `<?xml version="1.0"?><package xmlns="http://www.idpf.org/2007/opf" version="2.0"><metadata/><manifest>` + manifest + `</manifest><spine><itemref idref="text"/></spine></package>`},
+		{"text.xhtml", string(chapter)},
+	}
+	for _, file := range files {
+		if writer, err = archive.Create(file.name); err != nil {
+			return nil, err
+		}
+		io.WriteString(writer, file.content)
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mobiChapter turns the HTML soup of a MOBI into XHTML. MOBI page breaks
+// become CSS page breaks, everything else is left to the HTML parser.
+func mobiChapter(text []byte) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewReader(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse MOBI text: %w", err)
+	}
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.Data == "mbp:pagebreak" {
+			node.Data = "div"
+			node.Attr = []html.Attribute{{Key: "style", Val: "page-break-after: always"}}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	for child := doc.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.Data == "html" {
+			child.Attr = append(child.Attr, html.Attribute{Key: "xmlns", Val: "http://www.w3.org/1999/xhtml"})
+			if err := html.Render(&buf, child); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,200 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// pngWithSize is the start of a PNG whose header claims width x height,
+// enough for image.DecodeConfig but not for decoding.
+func pngWithSize(width, height int) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[8:], uint32(height))
+	ihdr[12] = 8 // bit depth
+	ihdr[13] = 6 // RGBA
+	var out bytes.Buffer
+	out.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&out, binary.BigEndian, uint32(13))
+	out.Write(ihdr)
+	binary.Write(&out, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	return out.Bytes()
+}
+
+// fb2WithCover is a FictionBook whose cover is the image in cover.
+func fb2WithCover(cover []byte) []byte {
+	return []byte(`<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns:l="http://www.w3.org/1999/xlink"><description><title-info>` +
+		`<coverpage><image l:href="#cover.png"/></coverpage></title-info></description>` +
+		`<binary id="cover.png" content-type="image/png">` + base64.StdEncoding.EncodeToString(cover) + `</binary></FictionBook>`)
+}
+
+// buildMobi writes an uncompressed, UTF-8 MOBI holding text and one image record.
+func buildMobi(title string, text string, cover []byte) []byte {
+	record0 := make([]byte, 16+232)
+	binary.BigEndian.PutUint16(record0[0:], 1) // no compression
+	binary.BigEndian.PutUint32(record0[4:], uint32(len(text)))
+	binary.BigEndian.PutUint16(record0[8:], 1) // one text record
+	copy(record0[16:], "MOBI")
+	binary.BigEndian.PutUint32(record0[20:], 232)
+	binary.BigEndian.PutUint32(record0[28:], 65001)
+	binary.BigEndian.PutUint32(record0[84:], uint32(len(record0)))
+	binary.BigEndian.PutUint32(record0[88:], uint32(len(title)))
+	binary.BigEndian.PutUint32(record0[108:], 2) // images start after the text
+	record0 = append(record0, title...)
+
+	records := [][]byte{record0, []byte(text), cover}
+	header := make([]byte, 78+len(records)*8)
+	copy(header[60:], "BOOKMOBI")
+	binary.BigEndian.PutUint16(header[76:], uint16(len(records)))
+	offset := len(header)
+	for i, record := range records {
+		binary.BigEndian.PutUint32(header[78+i*8:], uint32(offset))
+		offset += len(record)
+	}
+	return append(header, bytes.Join(records, nil)...)
+}
+
+func TestMobiToEPUB(t *testing.T) {
+	var cover bytes.Buffer
+	png.Encode(&cover, image.NewRGBA(image.Rect(0, 0, 20, 30)))
+	text := `<html><body><p>First page<br>unclosed</p><mbp:pagebreak/><img recindex="00001"><p>Second page</p></body></html>`
+	raw := buildMobi("Some Book", text, cover.Bytes())
+
+	doc, err := openDocumentFromMemory(raw, ".mobi")
+	if err != nil {
+		t.Fatalf("failed to open MOBI: %v", err)
+	}
+	defer doc.Close()
+	if doc.NumPage() < 2 {
+		t.Errorf("got %d pages, want the page break to give at least 2", doc.NumPage())
+	}
+	if _, err := renderPage(doc, 0, 256); err != nil {
+		t.Errorf("failed to render first page: %v", err)
+	}
+
+	book, err := parseMobi(raw)
+	if err != nil {
+		t.Fatalf("parseMobi failed: %v", err)
+	}
+	if book.title != "Some Book" {
+		t.Errorf("title = %q", book.title)
+	}
+}
+
+func TestMobiRejectsHostileInput(t *testing.T) {
+	valid := buildMobi("x", "<p>hello</p>", nil)
+	tests := []struct {
+		name   string
+		mutate func(raw []byte)
+	}{
+		{"DRM", func(raw []byte) { binary.BigEndian.PutUint16(raw[78+3*8+12:], 1) }},
+		{"HUFF/CDIC", func(raw []byte) { binary.BigEndian.PutUint16(raw[78+3*8:], 17480) }},
+		{"text length over the cap", func(raw []byte) { binary.BigEndian.PutUint32(raw[78+3*8+4:], maxMobiTextSize+1) }},
+		{"text records past the table", func(raw []byte) { binary.BigEndian.PutUint16(raw[78+3*8+8:], 500) }},
+		{"record offset past the end", func(raw []byte) { binary.BigEndian.PutUint32(raw[78+8:], 1<<30) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := bytes.Clone(valid)
+			tt.mutate(raw)
+			if _, err := mobiToEPUB(raw); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestPalmDocDecompress(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  []byte
+		want    string
+		wantErr bool
+	}{
+		{"literals", []byte("plain"), "plain", false},
+		{"escaped literals", []byte{3, 0xc0, 0xc1, 0xc2}, "\xc0\xc1\xc2", false},
+		{"space pair", []byte{'a', 0xe2}, "a b", false},
+		// distance 3, length 3+2: an overlapping copy of "abc"
+		{"back reference", []byte{'a', 'b', 'c', 0x80, 3<<3 | 2}, "abcabcab", false},
+		{"distance past the start", []byte{'a', 0x80, 9 << 3}, "", true},
+		{"zero distance", []byte{'a', 0x80, 0}, "", true},
+		{"truncated reference", []byte{'a', 0x80}, "", true},
+		{"truncated literal", []byte{5, 'a'}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := palmDocDecompress(nil, tt.record, 1024)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// a back reference chain blowing up past the limit is cut short
+	bomb := []byte{'a'}
+	for i := 0; i < 10000; i++ {
+		bomb = append(bomb, 0x80, 1<<3|7)
+	}
+	if _, err := palmDocDecompress(nil, bomb, 1000); err == nil {
+		t.Error("expected the limit to stop decompression")
+	}
+}
+
+func TestTrimTrailingEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		record []byte
+		flags  uint16
+		want   string
+	}{
+		{"no flags", []byte("text"), 0, "text"},
+		{"multibyte overlap", []byte{'t', 'e', 'x', 't', 'x', 1}, 1, "text"},
+		// a 3 byte entry whose size byte has the stop bit set
+		{"trailing entry", []byte{'t', 'e', 'x', 't', 'z', 'z', 0x83}, 2, "text"},
+		{"entry larger than record", []byte{'t', 0xff}, 2, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimTrailingEntries(tt.record, tt.flags); string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractCoverChecksSize(t *testing.T) {
+	var small bytes.Buffer
+	png.Encode(&small, tinyImage())
+	tests := []struct {
+		name   string
+		cover  []byte
+		tooBig bool
+	}{
+		{"small cover", small.Bytes(), false},
+		{"header claiming 60000x60000", pngWithSize(60000, 60000), true},
+		{"header just over the cap", pngWithSize(maxStillSourcePixels/1000+1, 1000), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := extractCover(fb2WithCover(tt.cover), ".fb2")
+			if tt.tooBig {
+				if err == nil || !strings.Contains(err.Error(), "too large") {
+					t.Errorf("got %v, want a size error", err)
+				}
+			} else if err != nil {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// shouldStripMetadata reports whether a file must be served without
+// identifying metadata, either because the file or its owner asked for it.
+func shouldStripMetadata(file database.FileData) bool {
+	if file.StripMetadata {
+		return true
+	}
+	owner, err := database.FindUserByToken(file.AccountToken)
+	return err == nil && owner.StripMetadata
+}
+
+// canStripMetadata reports whether the file is in a format strippedImage handles.
+func canStripMetadata(file database.FileData) bool {
+	switch strings.ToLower(filepath.Ext(file.Md5sum)) {
+	case ".jpg", ".jpeg", ".png", ".webp", ".heic", ".heif", ".tiff", ".tif":
+		return true
+	}
+	return false
+}
+
+// strippedImage returns a copy of an image with GPS and all other EXIF, XMP,
+// IPTC and comment metadata removed, and the content type to serve it with.
+// ok is false for formats that don't carry such metadata, which are served as-is.
+func strippedImage(file database.FileData) (data []byte, contentType string, ok bool, err error) {
+	originalFilePath := filepath.Join(UPLOAD_DIR, "i", file.Md5sum)
+	ext := strings.ToLower(filepath.Ext(file.Md5sum))
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".webp":
+		raw, err := os.ReadFile(originalFilePath)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("failed to read original file: %w", err)
+		}
+		switch ext {
+		case ".png":
+			data, err = stripPNG(raw)
+		case ".webp":
+			data, err = stripWebP(raw)
+		default:
+			data, err = stripJPEG(raw)
+		}
+		return data, strippedContentType(file), true, err
+	case ".heic", ".heif", ".tiff", ".tif":
+		// Metadata is too entangled with these containers to cut out, so
+		// they are re-encoded instead (with orientation already applied).
+		original, err := os.Open(originalFilePath)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("failed to open original file: %w", err)
+		}
+		defer original.Close()
+		var img image.Image
+		if ext == ".heic" || ext == ".heif" {
+			img, err = decodeHEIC(original)
+		} else {
+			img, err = correctImageOrientation(original)
+		}
+		if err != nil {
+			return nil, "", false, fmt.Errorf("failed to decode image: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 92}); err != nil {
+			return nil, "", false, fmt.Errorf("failed to encode jpeg: %w", err)
+		}
+		return buf.Bytes(), "image/jpeg", true, nil
+	}
+	return nil, "", false, nil
+}
+
+// strippedImagePath is where the metadata-free copy of a file is cached.
+func strippedImagePath(fileDirectory string) string {
+	return filepath.Join(UPLOAD_DIR, "stripped_images", fileDirectory)
+}
+
+// strippedContentType is the type strippedImage produces for a file, HEIC
+// and TIFF come back as JPEG.
+func strippedContentType(file database.FileData) string {
+	switch strings.ToLower(filepath.Ext(file.Md5sum)) {
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+// strippedFileName is the name the stripped copy of file is served under,
+// HEIC and TIFF are converted to JPEG and named after that.
+func strippedFileName(file database.FileData) string {
+	switch strings.ToLower(filepath.Ext(file.Md5sum)) {
+	case ".heic", ".heif", ".tiff", ".tif":
+		return strings.TrimSuffix(file.OriginalFileName, filepath.Ext(file.OriginalFileName)) + ".jpg"
+	}
+	return file.OriginalFileName
+}
+
+// path -> the Digest and Repr-Digest headers of a cached stripped image
+var strippedDigests sync.Map
+
+// cachedStrippedImage returns the path of the metadata-free copy of file,
+// stripping it on first use. The copy lives with the previews, so it is
+// budgeted, evicted and removed along with them.
+func cachedStrippedImage(file database.FileData) (string, error) {
+	path := strippedImagePath(file.FileDirectory)
+	generate := func() error {
+		data, _, _, err := strippedImage(file)
+		if err != nil {
+			return err
+		}
+		md5sum := md5.Sum(data)
+		sha := sha256.Sum256(data)
+		strippedDigests.Store(path, [2]string{
+			"md5=" + base64.StdEncoding.EncodeToString(md5sum[:]),
+			"sha-256=:" + base64.StdEncoding.EncodeToString(sha[:]) + ":",
+		})
+		return writePreviewFile(path, bytes.NewReader(data))
+	}
+	if err := generateOnce("stripped/"+file.FileDirectory, path, generate); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// setStrippedDigestHeaders adds the digests of a cached stripped image,
+// hashing it once if it was stripped before a restart.
+func setStrippedDigestHeaders(c *gin.Context, path string) {
+	digests, ok := strippedDigests.Load(path)
+	if !ok {
+		blob, err := os.Open(path)
+		if err != nil {
+			return
+		}
+		defer blob.Close()
+		md5Hash, shaHash := md5.New(), sha256.New()
+		if _, err := io.Copy(io.MultiWriter(md5Hash, shaHash), blob); err != nil {
+			return
+		}
+		digests = [2]string{
+			"md5=" + base64.StdEncoding.EncodeToString(md5Hash.Sum(nil)),
+			"sha-256=:" + base64.StdEncoding.EncodeToString(shaHash.Sum(nil)) + ":",
+		}
+		strippedDigests.Store(path, digests)
+	}
+	c.Header("Digest", digests.([2]string)[0])
+	c.Header("Repr-Digest", digests.([2]string)[1])
+}
+
+// orientationOnlyExif builds an APP1 payload holding nothing but the
+// Orientation tag, so stripped JPEGs still display the right way up.
+func orientationOnlyExif(orientation uint16) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("Exif\x00\x00")
+	buf.WriteString("MM\x00\x2a")
+	binary.Write(&buf, binary.BigEndian, uint32(8))      // offset of IFD0
+	binary.Write(&buf, binary.BigEndian, uint16(1))      // one entry
+	binary.Write(&buf, binary.BigEndian, uint16(0x0112)) // Orientation
+	binary.Write(&buf, binary.BigEndian, uint16(3))      // SHORT
+	binary.Write(&buf, binary.BigEndian, uint32(1))      // count
+	binary.Write(&buf, binary.BigEndian, orientation)
+	binary.Write(&buf, binary.BigEndian, uint16(0)) // padding
+	binary.Write(&buf, binary.BigEndian, uint32(0)) // no next IFD
+	return buf.Bytes()
+}
+
+func stripJPEG(raw []byte) ([]byte, error) {
+	if len(raw) < 4 || raw[0] != 0xFF || raw[1] != 0xD8 {
+		return nil, fmt.Errorf("not a JPEG file")
+	}
+	orientation := uint16(1)
+	if x, err := exif.Decode(bytes.NewReader(raw)); err == nil {
+		if tag, err := x.Get(exif.Orientation); err == nil {
+			if value, err := tag.Int(0); err == nil {
+				orientation = uint16(value)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	out.Write(raw[:2])
+	wroteOrientation := orientation == 1
+	writeOrientation := func() {
+		if wroteOrientation {
+			return
+		}
+		payload := orientationOnlyExif(orientation)
+		out.Write([]byte{0xFF, 0xE1})
+		binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+		out.Write(payload)
+		wroteOrientation = true
+	}
+
+	pos := 2
+	for pos+4 <= len(raw) {
+		if raw[pos] != 0xFF {
+			return nil, fmt.Errorf("corrupt JPEG segment at %d", pos)
+		}
+		marker := raw[pos+1]
+		if marker == 0xFF { // fill byte
+			pos++
+			continue
+		}
+		if marker == 0xDA { // start of scan, the rest is image data
+			writeOrientation()
+			out.Write(raw[pos:])
+			return out.Bytes(), nil
+		}
+		length := int(binary.BigEndian.Uint16(raw[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(raw) {
+			return nil, fmt.Errorf("corrupt JPEG segment at %d", pos)
+		}
+		switch {
+		case marker == 0xE1, marker == 0xED, marker == 0xFE:
+			// APP1 (EXIF/XMP), APP13 (IPTC) and comments are dropped
+		case marker == 0xE0:
+			out.Write(raw[pos:end])
+		default:
+			// EXIF has to come after JFIF's APP0 but before anything else
+			writeOrientation()
+			out.Write(raw[pos:end])
+		}
+		pos = end
+	}
+	return nil, fmt.Errorf("JPEG has no image data")
+}
+
+func stripPNG(raw []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(raw, []byte(signature)) {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+	var out bytes.Buffer
+	out.WriteString(signature)
+	pos := len(signature)
+	for pos+12 <= len(raw) {
+		length := int(binary.BigEndian.Uint32(raw[pos : pos+4]))
+		end := pos + 12 + length
+		if length < 0 || end > len(raw) {
+			return nil, fmt.Errorf("corrupt PNG chunk at %d", pos)
+		}
+		switch string(raw[pos+4 : pos+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out.Write(raw[pos:end])
+		}
+		pos = end
+	}
+	return out.Bytes(), nil
+}
+
+func stripWebP(raw []byte) ([]byte, error) {
+	if len(raw) < 12 || string(raw[0:4]) != "RIFF" || string(raw[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("not a WebP file")
+	}
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	pos := 12
+	for pos+8 <= len(raw) {
+		fourCC := string(raw[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(raw[pos+4 : pos+8]))
+		end := pos + 8 + size + size%2 // chunks are padded to even sizes
+		if end > len(raw) {
+			end = len(raw)
+		}
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), raw[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04 // clear the EXIF and XMP flags
+			}
+			body.Write(chunk)
+		default:
+			body.Write(raw[pos:end])
+		}
+		pos = end
+	}
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
@@ -0,0 +1,282 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/tiff"
+)
+
+// secretMarker stands in for GPS coordinates and other metadata, it must
+// never show up in anything served for a stripped image.
+const secretMarker = "GPS-48.8584N-2.2945E"
+
+// setupUploads points the endpoints at a fresh upload directory and database.
+func setupUploads(t *testing.T) {
+	t.Helper()
+	// not t.TempDir, requests kick off activity pulses that may still be
+	// writing to the database when the test ends
+	dir, err := os.MkdirTemp("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	UPLOAD_DIR = dir
+	if err := os.MkdirAll(filepath.Join(UPLOAD_DIR, "i"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("SAVE_DRIVE_RAM", "true")
+	defer os.Unsetenv("SAVE_DRIVE_RAM")
+	if err := database.InitializeDatabase(UPLOAD_DIR); err != nil {
+		t.Fatalf("InitializeDatabase failed: %v", err)
+	}
+}
+
+// storeTestFile writes blob to i/ and inserts a file owned by accountToken.
+func storeTestFile(t *testing.T, fileDirectory string, blob []byte, accountToken string) database.FileData {
+	t.Helper()
+	md5sum := "md5-" + fileDirectory
+	if err := os.WriteFile(filepath.Join(UPLOAD_DIR, "i", md5sum), blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := database.FileData{
+		OriginalFileName: fileDirectory,
+		FileDirectory:    fileDirectory,
+		AccountToken:     accountToken,
+		FileSize:         int64(len(blob)),
+		Timestamp:        1,
+		Md5sum:           md5sum,
+	}
+	if err := file.Insert(); err != nil {
+		t.Fatalf("insert file failed: %v", err)
+	}
+	return file
+}
+
+func tinyImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	return img
+}
+
+// jpegWithMetadata is a tiny JPEG carrying the marker in APP1, APP13 and a comment.
+func jpegWithMetadata() []byte {
+	var encoded bytes.Buffer
+	jpeg.Encode(&encoded, tinyImage(), nil)
+	raw := encoded.Bytes()
+	var out bytes.Buffer
+	out.Write(raw[:2])
+	for _, marker := range []byte{0xE1, 0xED, 0xFE} {
+		payload := []byte("Exif\x00\x00" + secretMarker)
+		out.Write([]byte{0xFF, marker})
+		binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+		out.Write(payload)
+	}
+	out.Write(raw[2:])
+	return out.Bytes()
+}
+
+func pngWithMetadata() []byte {
+	var encoded bytes.Buffer
+	png.Encode(&encoded, tinyImage())
+	raw := encoded.Bytes()
+	chunk := func(kind string, data string) []byte {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+		buf.WriteString(kind + data)
+		buf.Write([]byte{0, 0, 0, 0}) // CRC, not checked by the stripper
+		return buf.Bytes()
+	}
+	// after the signature and IHDR
+	ihdrEnd := 8 + 12 + 13
+	return bytes.Join([][]byte{raw[:ihdrEnd], chunk("tEXt", "Location\x00"+secretMarker), chunk("eXIf", secretMarker), raw[ihdrEnd:]}, nil)
+}
+
+func webpWithMetadata() []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	body.WriteString("VP8X")
+	binary.Write(&body, binary.LittleEndian, uint32(10))
+	body.Write([]byte{0x08 | 0x04, 0, 0, 0, 3, 0, 0, 3, 0, 0})
+	body.WriteString("EXIF")
+	binary.Write(&body, binary.LittleEndian, uint32(len(secretMarker)))
+	body.WriteString(secretMarker)
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+func TestStripMetadata(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   []byte
+		strip func([]byte) ([]byte, error)
+	}{
+		{"JPEG", jpegWithMetadata(), stripJPEG},
+		{"PNG", pngWithMetadata(), stripPNG},
+		{"WebP", webpWithMetadata(), stripWebP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripped, err := tt.strip(tt.raw)
+			if err != nil {
+				t.Fatalf("strip failed: %v", err)
+			}
+			if bytes.Contains(stripped, []byte(secretMarker)) {
+				t.Error("metadata survived stripping")
+			}
+		})
+	}
+
+	// the image itself still decodes
+	stripped, _ := stripJPEG(jpegWithMetadata())
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("stripped JPEG doesn't decode: %v", err)
+	}
+	stripped, _ = stripWebP(webpWithMetadata())
+	if stripped[20]&(0x08|0x04) != 0 {
+		t.Error("VP8X still announces EXIF/XMP")
+	}
+}
+
+func TestStripMetadataRejectsHostileInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   []byte
+		strip func([]byte) ([]byte, error)
+	}{
+		{"JPEG without SOI", []byte("not a jpeg"), stripJPEG},
+		{"JPEG segment past the end", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF, 0}, stripJPEG},
+		{"JPEG segment length under 2", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 1, 0, 0}, stripJPEG},
+		{"JPEG without scan", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0, 2}, stripJPEG},
+		{"PNG without signature", []byte("GIF89a"), stripPNG},
+		{"PNG chunk past the end", append([]byte("\x89PNG\r\n\x1a\n"), 0xFF, 0xFF, 0xFF, 0xFF, 't', 'E', 'X', 't', 0, 0, 0, 0), stripPNG},
+		{"WebP without RIFF", []byte("RIFX0000WEBP"), stripWebP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.strip(tt.raw); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	// a chunk claiming more than the file holds is cut at the end, not read past it
+	truncated := webpWithMetadata()
+	binary.LittleEndian.PutUint32(truncated[16:], 1<<31)
+	if _, err := stripWebP(truncated); err != nil {
+		t.Errorf("stripWebP failed on an oversized chunk: %v", err)
+	}
+}
+
+func TestServeStrippedImage(t *testing.T) {
+	setupUploads(t)
+	file := storeTestFile(t, "photo.jpg", jpegWithMetadata(), "owner-token")
+	if _, err := file.SetStripMetadata(true); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/i/:file_directory", returnFile)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/i/photo.jpg", nil))
+	if response.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", response.Code, response.Body.String())
+	}
+	body := response.Body.Bytes()
+	if bytes.Contains(body, []byte(secretMarker)) {
+		t.Error("served image still has its metadata")
+	}
+	if _, err := os.Stat(strippedImagePath("photo.jpg")); err != nil {
+		t.Errorf("stripped copy wasn't cached: %v", err)
+	}
+	if response.Header().Get("Repr-Digest") == "" {
+		t.Error("missing Repr-Digest")
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/i/photo.jpg", nil)
+	request.Header.Set("Range", "bytes=0-9")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != http.StatusPartialContent || !bytes.Equal(response.Body.Bytes(), body[:10]) {
+		t.Errorf("range request: status %d, %d bytes", response.Code, response.Body.Len())
+	}
+}
+
+func TestImagePreviewNeverCopiesMetadata(t *testing.T) {
+	setupUploads(t)
+	// stripping is off, the preview must still come without the metadata
+	storeTestFile(t, "tiny.jpg", jpegWithMetadata(), "owner-token")
+
+	previewsDir := filepath.Join(UPLOAD_DIR, "image_previews")
+	previewFile := filepath.Join(previewsDir, "tiny.jpg")
+	if err := generateImagePreview("tiny.jpg", previewsDir, previewFile); err != nil {
+		t.Fatalf("generateImagePreview failed: %v", err)
+	}
+	preview, err := os.ReadFile(previewFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(preview, []byte(secretMarker)) {
+		t.Error("preview carries the original's metadata")
+	}
+	if _, _, err := image.Decode(bytes.NewReader(preview)); err != nil {
+		t.Errorf("preview doesn't decode: %v", err)
+	}
+}
+
+func TestStrippedDownloadName(t *testing.T) {
+	setupUploads(t)
+	var scan bytes.Buffer
+	if err := tiff.Encode(&scan, tinyImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		blob        []byte
+		filename    string
+		contentType string
+	}{
+		{"photo.jpg", jpegWithMetadata(), "photo.jpg", "image/jpeg"},
+		{"scan.tiff", scan.Bytes(), "scan.jpg", "image/jpeg"},
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/download/:file_directory", downloadFile)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := storeTestFile(t, tt.name, tt.blob, "owner-token")
+			if _, err := file.SetStripMetadata(true); err != nil {
+				t.Fatal(err)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/download/"+tt.name, nil))
+			if response.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", response.Code, response.Body.String())
+			}
+			if disposition := response.Header().Get("Content-Disposition"); !strings.Contains(disposition, `filename=`+tt.filename) {
+				t.Errorf("Content-Disposition = %q, want filename %s", disposition, tt.filename)
+			}
+			if contentType := response.Header().Get("Content-Type"); contentType != tt.contentType {
+				t.Errorf("Content-Type = %q, want %s", contentType, tt.contentType)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package endpoints
+
+import (
+	"angadrive/socketHandler"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downloadExport serves a finished data export. The ID in the link is the
+// only credential, it's long and random and dies with the export.
+func downloadExport(c *gin.Context) {
+	exportPath, name, ok := socketHandler.ExportFile(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found or expired"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(exportPath, name)
+}
@@ -9,62 +9,66 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func getFilePath(file_directory string) string {
-	File, err := database.GetFile(file_directory)
-	if err != nil {
-		return ""
-	}
-	return UPLOAD_DIR + string(os.PathSeparator) + "i" + string(os.PathSeparator) + File.Md5sum
-}
-
-func getFileName(file_directory string) string {
-	File, err := database.GetFile(file_directory)
-	if err != nil {
-		return file_directory
-	}
-	return File.OriginalFileName
-}
-
 func returnFile(c *gin.Context) {
 	go socketHandler.SiteActivityPulse()
-	file_directory := c.Param("file_directory")
-
-	filePath := getFilePath(file_directory)
-	if filePath == "" {
-		c.JSON(404, gin.H{
-			"error": "File not found",
-		})
-		return
-	}
-
-	c.File(filePath)
+	serveBlob(c, c.Param("file_directory"), false)
 }
 
 func returnNamedFile(c *gin.Context) {
 	go socketHandler.SiteActivityPulse()
 	file_directory := c.Param("file_directory")
 	original_name := c.Param("original_name")
-	filepath := getFilePath(file_directory + filepath.Ext(original_name))
-	if filepath == "" {
-		c.JSON(404, gin.H{
-			"error": "File not found",
-		})
-		return
-	}
-	c.File(filepath)
+	serveBlob(c, file_directory+filepath.Ext(original_name), false)
 }
 
 func downloadFile(c *gin.Context) {
 	go socketHandler.SiteActivityPulse()
-	file_directory := c.Param("file_directory")
+	serveBlob(c, c.Param("file_directory"), true)
+}
 
-	filePath := getFilePath(file_directory)
-	if filePath == "" {
+// serveBlob answers with the stored file behind file_directory, or its
+// metadata-free copy when the owner asked for that.
+func serveBlob(c *gin.Context, file_directory string, attachment bool) {
+	File, err := database.GetFile(file_directory)
+	if err != nil {
 		c.JSON(404, gin.H{
 			"error": "File not found",
 		})
 		return
 	}
 
-	c.FileAttachment(filePath, getFileName(file_directory))
+	if serveStripped(c, File, attachment) {
+		return
+	}
+	setServingHeaders(c, File.OriginalFileName, attachment)
+	if notModified(c, blobETag(File, ""), blobCacheControl(File)) {
+		return
+	}
+	setDigestHeaders(c, File)
+	c.File(UPLOAD_DIR + string(os.PathSeparator) + "i" + string(os.PathSeparator) + File.Md5sum)
+}
+
+// serveStripped answers the request with a metadata-free copy of the image
+// when its owner asked for that. It returns false if the caller should serve
+// the stored file untouched.
+func serveStripped(c *gin.Context, File database.FileData, attachment bool) bool {
+	if !canStripMetadata(File) || !shouldStripMetadata(File) {
+		return false
+	}
+	setServingHeaders(c, strippedFileName(File), attachment)
+	if notModified(c, blobETag(File, "stripped"), revalidateCacheControl) {
+		return true
+	}
+	path, err := cachedStrippedImage(File)
+	if err != nil {
+		clearCacheHeaders(c)
+		c.String(500, "Failed to strip image metadata: "+err.Error())
+		return true
+	}
+	// set before c.File, which would guess from the name (HEIC and TIFF come back as JPEG)
+	c.Header("Content-Type", strippedContentType(File))
+	setStrippedDigestHeaders(c, path)
+	touchPreview(path)
+	c.File(path)
+	return true
 }
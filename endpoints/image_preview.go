@@ -29,9 +29,8 @@ func returnImagePreview(c *gin.Context) {
 
 	fileDirectory := c.Param("file_directory")
 
-	// SVG files are served raw (no rasterization needed), with a size limit.
-	if strings.ToLower(filepath.Ext(fileDirectory)) == ".svg" {
-		serveRawSVG(c, fileDirectory)
+	if audioExtensions[strings.ToLower(filepath.Ext(fileDirectory))] {
+		returnAudioCover(c, fileDirectory)
 		return
 	}
 
@@ -41,15 +40,28 @@ func returnImagePreview(c *gin.Context) {
 	previewFile := filepath.Join(previewsDir, fileDirectory)
 
 	if _, err := os.Stat(previewFile); !os.IsNotExist(err) {
-		c.File(previewFile)
+		// the preview outlives its file being hidden, so the file is checked first
+		fileInfo, err := database.GetFile(fileDirectory)
+		if err != nil {
+			c.String(http.StatusNotFound, "File not found")
+			return
+		}
+		if fileInfo.BlurHash == "" {
+			backfillPlaceholder(fileDirectory, previewFile)
+		}
+		if fileInfo.PerceptualHash == "" {
+			backfillPerceptualHash(fileDirectory, previewFile)
+		}
+		servePreview(c, previewFile)
 		return
 	}
 
-	if err := generateImagePreview(fileDirectory, previewsDir, previewFile); err != nil {
+	generate := func() error { return generateImagePreview(fileDirectory, previewsDir, previewFile) }
+	if err := generateOnce(fileDirectory, previewFile, generate); err != nil {
 		c.String(http.StatusInternalServerError, "Failed to generate preview: "+err.Error())
 		return
 	}
-	c.File(previewFile)
+	servePreview(c, previewFile)
 }
 
 func generateImagePreview(fileDirectory string, previewsDir string, previewFilePath string) error {
@@ -69,9 +81,75 @@ func generateImagePreview(fileDirectory string, previewsDir string, previewFileP
 	}
 	defer file.Close()
 
+	ext := strings.ToLower(filepath.Ext(originalFilePath))
+
+	var buf bytes.Buffer
+	encoded := false
+	switch ext {
+	case ".gif":
+		encoded = animatedGIFPreview(file, &buf)
+	case ".webp":
+		encoded, err = animatedWebPPreview(file, &buf)
+		if err != nil {
+			return fmt.Errorf("failed to decode animated webp: %w", err)
+		}
+	case ".svg":
+		if err := rasterizeSVG(file, &buf); err != nil {
+			return err
+		}
+		encoded = true
+	}
+	if !encoded {
+		buf.Reset()
+		if err := encodeStillPreview(file, ext, &buf); err != nil {
+			return err
+		}
+	}
+
+	// SVGs are never copied, the whole point of their preview is not serving the original
+	if int64(buf.Len()) > fileInfo.FileSize && ext != ".svg" && canStripMetadata(fileInfo) {
+		// Previews are public whatever the owner's stripping setting, so the
+		// original only stands in for the preview without its metadata. If
+		// that fails the generated preview is used, it never carries any.
+		if stripped, _, ok, err := strippedImage(fileInfo); ok && err == nil {
+			buf.Reset()
+			buf.Write(stripped)
+		}
+		if err := writePreviewFile(previewFilePath, &buf); err != nil {
+			return err
+		}
+	} else if int64(buf.Len()) > fileInfo.FileSize && ext != ".svg" {
+		// If the generated preview is larger than the original, copy the original file instead
+		originalFile, err := os.Open(originalFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to open original file for copying: %w", err)
+		}
+		defer originalFile.Close()
+
+		if err := writePreviewFile(previewFilePath, originalFile); err != nil {
+			return fmt.Errorf("failed to copy original file to preview path: %w", err)
+		}
+	} else {
+		// Otherwise, write the generated preview
+		if err := writePreviewFile(previewFilePath, &buf); err != nil {
+			return err
+		}
+	}
+
+	storePlaceholder(fileDirectory, previewFilePath)
+	storePerceptualHash(fileDirectory, previewFilePath)
+	return nil
+}
+
+// encodeStillPreview writes a single-frame preview of the image in file to buf,
+// keeping the original format wherever the standard library can encode it.
+func encodeStillPreview(file *os.File, ext string, buf *bytes.Buffer) error {
 	var img image.Image
+	var err error
 
-	ext := strings.ToLower(filepath.Ext(originalFilePath))
+	if err := checkStillSourceSize(file); err != nil {
+		return err
+	}
 	switch ext {
 	case ".heic", ".heif":
 		img, err = decodeHEIC(file)
@@ -85,105 +163,73 @@ func generateImagePreview(fileDirectory string, previewsDir string, previewFileP
 		}
 	}
 
-	imageHeight := img.Bounds().Dy()
-	imageWidth := img.Bounds().Dx()
-
-	var newHeight, newWidth int
-	if imageHeight > imageWidth {
-		ratioOfConversion := float64(imageHeight) / 512.0
-		newWidth = int(float64(imageWidth) / ratioOfConversion)
-		newHeight = 512
-	} else {
-		ratioOfConversion := float64(imageWidth) / 512.0
-		newHeight = int(float64(imageHeight) / ratioOfConversion)
-		newWidth = 512
-	}
-
+	newWidth, newHeight := previewDimensions(img.Bounds().Dx(), img.Bounds().Dy())
 	resizedImg := imaging.Thumbnail(img, newWidth, newHeight, imaging.Lanczos)
 
-	var buf bytes.Buffer
-
 	switch ext {
 	case ".jpg", ".jpeg":
-		if err := jpeg.Encode(&buf, resizedImg, nil); err != nil {
+		if err := jpeg.Encode(buf, resizedImg, nil); err != nil {
 			return fmt.Errorf("failed to encode jpeg: %w", err)
 		}
 	case ".png", ".heic", ".heif": // HEIC will be encoded as PNG preview
-		if err := png.Encode(&buf, resizedImg); err != nil {
+		if err := png.Encode(buf, resizedImg); err != nil {
 			return fmt.Errorf("failed to encode png: %w", err)
 		}
 	case ".gif":
-		if err := gif.Encode(&buf, resizedImg, nil); err != nil {
+		if err := gif.Encode(buf, resizedImg, nil); err != nil {
 			return fmt.Errorf("failed to encode gif: %w", err)
 		}
 	case ".bmp":
-		if err := bmp.Encode(&buf, resizedImg); err != nil {
+		if err := bmp.Encode(buf, resizedImg); err != nil {
 			return fmt.Errorf("failed to encode bmp: %w", err)
 		}
 	case ".tiff":
-		if err := tiff.Encode(&buf, resizedImg, nil); err != nil {
+		if err := tiff.Encode(buf, resizedImg, nil); err != nil {
 			return fmt.Errorf("failed to encode tiff: %w", err)
 		}
 	case ".webp":
 		// Note: Standard library does not support encoding webp.
 		// Using a third-party library would be needed for full webp support.
 		// For now, we can encode it as PNG as a fallback.
-		if err := png.Encode(&buf, resizedImg); err != nil {
+		if err := png.Encode(buf, resizedImg); err != nil {
 			return fmt.Errorf("failed to encode webp as png: %w", err)
 		}
 	default:
-		return fmt.Errorf("unsupported image format: %s", fileInfo.OriginalFileName)
-	}
-
-	if int64(buf.Len()) > fileInfo.FileSize {
-		// If the generated preview is larger than the original, copy the original file instead
-		originalFile, err := os.Open(originalFilePath)
-		if err != nil {
-			return fmt.Errorf("failed to open original file for copying: %w", err)
-		}
-		defer originalFile.Close()
-
-		outFile, err := os.Create(previewFilePath)
-		if err != nil {
-			return fmt.Errorf("failed to create preview file for copying: %w", err)
-		}
-		defer outFile.Close()
-
-		_, err = io.Copy(outFile, originalFile)
-		if err != nil {
-			return fmt.Errorf("failed to copy original file to preview path: %w", err)
-		}
-	} else {
-		// Otherwise, write the generated preview
-		outFile, err := os.Create(previewFilePath)
-		if err != nil {
-			return fmt.Errorf("failed to create preview file: %w", err)
-		}
-		defer outFile.Close()
-
-		_, err = outFile.Write(buf.Bytes())
-		if err != nil {
-			return fmt.Errorf("failed to write preview to file: %w", err)
-		}
+		return fmt.Errorf("unsupported image format: %s", ext)
 	}
 
 	return nil
 }
 
-func serveRawSVG(c *gin.Context, fileDirectory string) {
-	fileInfo, err := database.GetFile(fileDirectory)
+// maxStillSourcePixels caps the images still previews are decoded from, a
+// few bytes of header can otherwise claim gigapixels
+const maxStillSourcePixels = 150_000_000
+
+// checkStillSourceSize reads the size an image claims in its header and
+// refuses to decode it when that is over maxStillSourcePixels.
+func checkStillSourceSize(source io.ReadSeeker) error {
+	if _, err := source.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	config, _, err := image.DecodeConfig(source)
 	if err != nil {
-		c.String(http.StatusNotFound, "File not found")
-		return
+		// decoding proper reports what is wrong with the file
+		return nil
 	}
-
-	if fileInfo.FileSize > 250*1024 {
-		c.String(http.StatusBadRequest, "SVG file exceeds 250KB preview limit")
-		return
+	if config.Width*config.Height > maxStillSourcePixels {
+		return fmt.Errorf("image of %dx%d is too large to preview", config.Width, config.Height)
 	}
+	return nil
+}
 
-	originalFilePath := filepath.Join(UPLOAD_DIR, "i", fileInfo.Md5sum)
-	c.File(originalFilePath)
+// previewDimensions fits a width x height image into the 512px preview box.
+func previewDimensions(imageWidth, imageHeight int) (int, int) {
+	if imageHeight > imageWidth {
+		ratioOfConversion := float64(imageHeight) / 512.0
+		return max(int(float64(imageWidth)/ratioOfConversion), 1), 512
+	}
+	ratioOfConversion := float64(imageWidth) / 512.0
+	return 512, max(int(float64(imageHeight)/ratioOfConversion), 1)
 }
 
 func decodeHEIC(file *os.File) (image.Image, error) {
@@ -1,6 +1,7 @@
 package endpoints
 
 import (
+	"angadrive/database"
 	"angadrive/vars"
 
 	"github.com/gin-gonic/gin"
@@ -8,6 +9,11 @@ import (
 
 func InitEndpoints(r *gin.Engine, UPLOAD_DIR string) {
 	setupUploaderRoutes(r, UPLOAD_DIR)
+	setupOIDCRoutes(r)
+	initPreviewCache()
+	startPreviewWorkers()
+	database.AfterFileInsert = QueuePreview
+	database.AfterFileDelete = RemovePreviews
 	r.GET("/i/:file_directory", func(c *gin.Context) {
 		if c.Request.Host == vars.AssetsURL {
 			returnFile(c)
@@ -23,14 +29,54 @@ func InitEndpoints(r *gin.Engine, UPLOAD_DIR string) {
 			returnFilePreview(c)
 		}
 	})
+	r.GET("/preview/:file_directory/page/:page", func(c *gin.Context) {
+		if c.Request.Host == vars.AssetsURL {
+			returnPagePreview(c)
+		}
+	})
+	r.GET("/preview/:file_directory/info", func(c *gin.Context) {
+		if c.Request.Host == vars.AssetsURL {
+			returnDocumentInfo(c)
+		}
+	})
 	r.GET("/preview-image/:file_directory", func(c *gin.Context) {
 		if c.Request.Host == vars.AssetsURL {
 			returnImagePreview(c)
 		}
 	})
+	r.GET("/preview-status/:file_directory", func(c *gin.Context) {
+		if c.Request.Host == vars.AssetsURL {
+			returnPreviewStatus(c)
+		}
+	})
+	r.GET("/preview-text/:file_directory", func(c *gin.Context) {
+		if c.Request.Host == vars.AssetsURL {
+			returnTextPreview(c)
+		}
+	})
+	r.GET("/audio/:file_directory", func(c *gin.Context) {
+		if c.Request.Host == vars.AssetsURL {
+			returnAudioPreview(c)
+		}
+	})
+	r.GET("/archive/:file_directory", func(c *gin.Context) {
+		if c.Request.Host == vars.AssetsURL {
+			returnArchiveListing(c)
+		}
+	})
+	r.GET("/archive/:file_directory/entry", func(c *gin.Context) {
+		if c.Request.Host == vars.AssetsURL {
+			returnArchiveEntry(c)
+		}
+	})
 	r.GET("/download/:file_directory", func(c *gin.Context) {
 		if c.Request.Host == vars.AssetsURL {
 			downloadFile(c)
 		}
 	})
+	r.GET("/export/:id", func(c *gin.Context) {
+		if c.Request.Host == vars.AssetsURL {
+			downloadExport(c)
+		}
+	})
 }
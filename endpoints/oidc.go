@@ -0,0 +1,79 @@
+package endpoints
+
+import (
+	"angadrive/accounts"
+	"angadrive/vars"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupOIDCRoutes(r *gin.Engine) {
+	r.GET("/auth/oidc/providers", func(c *gin.Context) {
+		if c.Request.Host == vars.WebURL {
+			c.JSON(http.StatusOK, accounts.OIDCProviders())
+		}
+	})
+	r.GET("/auth/oidc/:provider/login", func(c *gin.Context) {
+		if c.Request.Host == vars.WebURL {
+			startOIDCLogin(c)
+		}
+	})
+	r.GET("/auth/oidc/:provider/callback", func(c *gin.Context) {
+		if c.Request.Host == vars.WebURL {
+			finishOIDCLogin(c)
+		}
+	})
+}
+
+// oidcBindingCookie ties a login to the browser that started it, it holds a
+// hash of the login's state
+const oidcBindingCookie = "oidc_binding"
+
+func setOIDCBindingCookie(c *gin.Context, binding string, maxAge int) {
+	// Lax, the provider's redirect back is a cross-site navigation
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(vars.WebLink(""), "https://")
+	c.SetCookie(oidcBindingCookie, binding, maxAge, "/auth/oidc/", "", secure, true)
+}
+
+func startOIDCLogin(c *gin.Context) {
+	authURL, binding, err := accounts.BeginOIDCLogin(c.Param("provider"))
+	if errors.Is(err, accounts.ErrUnknownOIDCProvider) {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		fmt.Printf("Warning: Failed to start OIDC login with %s: %v\n", c.Param("provider"), err)
+		c.String(http.StatusBadGateway, err.Error())
+		return
+	}
+	setOIDCBindingCookie(c, binding, int(accounts.OIDCFlowLifetime.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// finishOIDCLogin sends the browser back to the account page, which trades
+// the ticket for a session over the websocket.
+func finishOIDCLogin(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		message := providerError
+		if description := c.Query("error_description"); description != "" {
+			message = description
+		}
+		c.Redirect(http.StatusFound, "/account?oidc_error="+url.QueryEscape(message))
+		return
+	}
+	binding, _ := c.Cookie(oidcBindingCookie)
+	setOIDCBindingCookie(c, "", -1)
+	ticket, err := accounts.CompleteOIDCLogin(c.Request.Context(), c.Param("provider"), c.Query("state"), binding, c.Query("code"))
+	if err != nil {
+		fmt.Printf("Warning: OIDC login with %s failed: %v\n", c.Param("provider"), err)
+		c.Redirect(http.StatusFound, "/account?oidc_error="+url.QueryEscape(err.Error()))
+		return
+	}
+	c.Redirect(http.StatusFound, "/account?oidc_ticket="+url.QueryEscape(ticket))
+}
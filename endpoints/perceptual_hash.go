@@ -0,0 +1,57 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/disintegration/imaging"
+)
+
+// dHash compares each pixel of a 9x8 grayscale thumbnail with its right
+// neighbour, which survives re-encoding, resizing and small colour changes.
+func dHash(img image.Image) uint64 {
+	small := imaging.Resize(imaging.Grayscale(img), 9, 8, imaging.Box)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			// grayscale, so the red channel is the luminance
+			left := small.Pix[y*small.Stride+x*4]
+			right := small.Pix[y*small.Stride+(x+1)*4]
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// storePerceptualHash hashes the generated preview of an image and saves it
+// on the file record. The preview is hashed rather than the original since
+// it's already decoded, oriented and small.
+func storePerceptualHash(fileDirectory string, previewFile string) {
+	file, err := database.GetFile(fileDirectory)
+	if err != nil || file.PerceptualHash != "" {
+		return
+	}
+	img, err := imaging.Open(previewFile)
+	if err != nil {
+		return
+	}
+	if _, err := file.SetPerceptualHash(fmt.Sprintf("%016x", dHash(img))); err != nil {
+		fmt.Printf("Warning: Failed to store perceptual hash for %s: %v\n", fileDirectory, err)
+	}
+}
+
+// fileDirectory -> true once a backfill was attempted
+var perceptualHashBackfills sync.Map
+
+// backfillPerceptualHash hashes a preview generated before perceptual hashes existed.
+func backfillPerceptualHash(fileDirectory string, previewFile string) {
+	if _, attempted := perceptualHashBackfills.LoadOrStore(fileDirectory, true); attempted {
+		return
+	}
+	go storePerceptualHash(fileDirectory, previewFile)
+}
@@ -0,0 +1,160 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/buckket/go-blurhash"
+	"github.com/disintegration/imaging"
+)
+
+// BlurHash components, 4x3 is what the BlurHash authors recommend for thumbnails
+const blurHashX = 4
+const blurHashY = 3
+
+var videoPosterExtensions = map[string]bool{
+	".mp4":  true,
+	".mkv":  true,
+	".avi":  true,
+	".mov":  true,
+	".wmv":  true,
+	".flv":  true,
+	".webm": true,
+}
+
+// computePlaceholder returns the BlurHash and the dominant colour ("#rrggbb") of img.
+func computePlaceholder(img image.Image) (string, string, error) {
+	// both only need a rough picture, and BlurHash cost grows with the pixel count
+	small := imaging.Fit(img, 32, 32, imaging.Box)
+	hash, err := blurhash.Encode(blurHashX, blurHashY, small)
+	if err != nil {
+		return "", "", err
+	}
+	return hash, dominantColor(small), nil
+}
+
+// dominantColor buckets opaque pixels by their top 4 bits per channel and
+// returns the average colour of the most common bucket.
+func dominantColor(img *image.NRGBA) string {
+	type bucket struct{ count, r, g, b int }
+	buckets := make(map[int]*bucket)
+	var best *bucket
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		r, g, b, a := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2]), img.Pix[i+3]
+		if a < 128 {
+			continue
+		}
+		key := r>>4<<8 | g>>4<<4 | b>>4
+		bk, ok := buckets[key]
+		if !ok {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.count++
+		bk.r += r
+		bk.g += g
+		bk.b += b
+		if best == nil || bk.count > best.count {
+			best = bk
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
+
+// storePlaceholder computes the placeholder of a file from its generated
+// preview and saves it on the file record.
+func storePlaceholder(fileDirectory string, previewFile string) {
+	file, err := database.GetFile(fileDirectory)
+	if err != nil || file.BlurHash != "" {
+		return
+	}
+	img, err := imaging.Open(previewFile)
+	if err != nil {
+		// e.g. animated WebP originals copied as their own preview
+		return
+	}
+	if err := savePlaceholder(file, img); err != nil {
+		fmt.Printf("Warning: Failed to store placeholder for %s: %v\n", fileDirectory, err)
+	}
+}
+
+// fileDirectory -> true once a backfill was attempted, so previews that
+// can't be decoded aren't retried on every request
+var placeholderBackfills sync.Map
+
+// backfillPlaceholder stores the placeholder of a preview generated before
+// placeholders existed.
+func backfillPlaceholder(fileDirectory string, previewFile string) {
+	if _, attempted := placeholderBackfills.LoadOrStore(fileDirectory, true); attempted {
+		return
+	}
+	go storePlaceholder(fileDirectory, previewFile)
+}
+
+func savePlaceholder(file database.FileData, img image.Image) error {
+	hash, color, err := computePlaceholder(img)
+	if err != nil {
+		return err
+	}
+	_, err = file.SetPlaceholder(hash, color)
+	return err
+}
+
+// storeVideoPlaceholder grabs a poster frame of a video with ffmpeg and
+// saves the placeholder computed from it. Videos have no stored preview,
+// the frame only lives in memory.
+func storeVideoPlaceholder(file database.FileData) error {
+	videoPath := filepath.Join(UPLOAD_DIR, "i", file.Md5sum)
+	// a second in skips black intro frames, short clips fall back to the first frame
+	for _, seek := range []string{"1", "0"} {
+		cmd := exec.Command("ffmpeg",
+			"-ss", seek,
+			"-i", videoPath,
+			"-frames:v", "1",
+			"-vf", "scale=64:-2",
+			"-f", "image2pipe",
+			"-c:v", "png",
+			"-",
+		)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		if stdout.Len() == 0 {
+			continue
+		}
+		img, _, err := image.Decode(&stdout)
+		if err != nil {
+			return fmt.Errorf("failed to decode poster frame: %w", err)
+		}
+		return savePlaceholder(file, img)
+	}
+	return fmt.Errorf("video has no frames")
+}
+
+// queueVideoPlaceholder computes the placeholder of a newly inserted video in
+// the background, sharing the preview workers' concurrency limit.
+func queueVideoPlaceholder(file database.FileData) {
+	if _, err := os.Stat(filepath.Join(UPLOAD_DIR, "i", file.Md5sum)); err != nil {
+		return
+	}
+	go func() {
+		previewLimiter <- struct{}{}
+		defer func() { <-previewLimiter }()
+		if err := generateRecovered(func() error { return storeVideoPlaceholder(file) }); err != nil {
+			fmt.Printf("Warning: Failed to store placeholder for %s: %v\n", file.FileDirectory, err)
+		}
+	}()
+}
@@ -4,9 +4,15 @@ import (
 	"angadrive/database"
 	"angadrive/socketHandler"
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"image"
 	"image/png"
+	"math"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gen2brain/go-fitz"
@@ -14,6 +20,37 @@ import (
 	"github.com/nfnt/resize"
 )
 
+const (
+	defaultPageWidth = 512
+	minPageWidth     = 64
+	maxPageWidth     = 2048
+	// requested widths are rounded to this step so a client can't fill the
+	// disk with one cached render per pixel width
+	pageWidthStep = 64
+
+	// pages are first rendered at probeDPI to learn their size, cheap even
+	// for absurd page sizes
+	probeDPI = 8
+	// renders are capped at this DPI and pixel count whatever the page size,
+	// a page 1pt wide and miles tall would otherwise allocate gigabytes
+	maxRenderDPI    = 600
+	maxRenderPixels = 16_000_000
+
+	// documents are held in memory while MuPDF works on them, so they are
+	// capped in size and in how many are open at once
+	maxDocumentSize        = 200 * 1024 * 1024
+	maxConcurrentDocuments = 2
+)
+
+var documentLimiter = make(chan struct{}, maxConcurrentDocuments)
+
+// DocumentInfo is the metadata returned by /preview/:file_directory/info
+type DocumentInfo struct {
+	PageCount int    `json:"page_count"`
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+}
+
 func returnFilePreview(c *gin.Context) {
 	go socketHandler.SiteActivityPulse()
 
@@ -22,45 +59,69 @@ func returnFilePreview(c *gin.Context) {
 	previewFile := previewsDir + string(os.PathSeparator) + file_directory
 
 	if _, err := os.Stat(previewFile); !os.IsNotExist(err) {
-		c.File(previewFile)
+		if _, err := database.GetFile(strings.TrimSuffix(file_directory, ".png")); err != nil {
+			c.String(http.StatusNotFound, "File not found")
+			return
+		}
+		servePreview(c, previewFile)
 	} else {
-		err := generatePreview(file_directory)
+		generate := func() error { return generatePreview(file_directory) }
+		err := generateOnce(strings.TrimSuffix(file_directory, ".png"), previewFile, generate)
 		if err != nil {
 			c.String(500, "Failed to generate preview: "+err.Error())
 			return
 		}
-		c.File(previewFile)
+		servePreview(c, previewFile)
 	}
 }
 
+// documentExtensions are the formats MuPDF can preview, MOBI through an EPUB
+// conversion. CBR is accepted because most "CBR" files in the wild are really
+// zips of images, which MuPDF opens as a comic book archive.
+var documentExtensions = map[string]bool{
+	".pdf":  true,
+	".epub": true,
+	".mobi": true,
+	".xps":  true,
+	".oxps": true,
+	".cbz":  true,
+	".cbr":  true,
+	".fb2":  true,
+}
+
 func generatePreview(file_directory string) error {
 	previewFile := UPLOAD_DIR + string(os.PathSeparator) + "pdf_previews" + string(os.PathSeparator) + file_directory
 	if !strings.HasSuffix(file_directory, ".png") {
 		return fmt.Errorf("file must be a PNG image")
 	}
 	file_directory_without_png := strings.TrimSuffix(file_directory, ".png")
-	if !strings.HasSuffix(file_directory_without_png, ".pdf") {
-		return fmt.Errorf("file must be a PDF document")
+	ext := strings.ToLower(filepath.Ext(file_directory_without_png))
+	if !documentExtensions[ext] {
+		return fmt.Errorf("file must be a PDF, EPUB, MOBI, XPS, CBZ or FB2 document")
 	}
 
-	file_info, err := database.GetFile(file_directory_without_png)
+	raw, release, err := readDocument(file_directory_without_png)
 	if err != nil {
-		return fmt.Errorf("file not found: %w", err)
+		return err
 	}
+	defer release()
 
-	doc, err := fitz.New(UPLOAD_DIR + string(os.PathSeparator) + "i" + string(os.PathSeparator) + file_info.Md5sum)
+	img, err := extractCover(raw, ext)
 	if err != nil {
-		return fmt.Errorf("failed to open PDF document: %w", err)
-	}
-	defer doc.Close()
+		doc, err := openDocumentFromMemory(raw, ext)
+		if err != nil {
+			return err
+		}
+		defer doc.Close()
 
-	if doc.NumPage() < 1 {
-		return fmt.Errorf("PDF document has no pages")
-	}
+		if doc.NumPage() < 1 {
+			return fmt.Errorf("document has no pages")
+		}
 
-	img, err := doc.Image(0)
-	if err != nil {
-		return fmt.Errorf("failed to extract image from PDF: %w", err)
+		img, err = renderPage(doc, 0, 512)
+		if err != nil {
+			return fmt.Errorf("failed to extract image from document: %w", err)
+		}
 	}
 
 	// Calculate new dimensions while preserving aspect ratio
@@ -86,27 +147,267 @@ func generatePreview(file_directory string) error {
 	}
 
 	resized := resize.Resize(newWidth, newHeight, img, resize.Lanczos3)
+	return writePNG(previewFile, resized)
+}
+
+// readDocument loads the stored blob behind a document's file_directory and
+// holds one of maxConcurrentDocuments slots until release is called.
+//
+// go-fitz reads the whole file even when opening by path, and MuPDF then
+// picks the format from the extension, which blobs in i/ don't have (a zip
+// taken for a PDF aborts the process). Documents are always opened from
+// memory, this is where that memory is bounded.
+func readDocument(fileDirectory string) (raw []byte, release func(), err error) {
+	if !documentExtensions[strings.ToLower(filepath.Ext(fileDirectory))] {
+		return nil, nil, fmt.Errorf("file must be a PDF, EPUB, MOBI, XPS, CBZ or FB2 document")
+	}
+	fileInfo, err := database.GetFile(fileDirectory)
+	if err != nil {
+		return nil, nil, fmt.Errorf("file not found: %w", err)
+	}
+	blobPath := filepath.Join(UPLOAD_DIR, "i", fileInfo.Md5sum)
+	stat, err := os.Stat(blobPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	if stat.Size() > maxDocumentSize {
+		return nil, nil, fmt.Errorf("document is too large to preview")
+	}
+
+	documentLimiter <- struct{}{}
+	release = func() { <-documentLimiter }
+	raw, err = os.ReadFile(blobPath)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	return raw, release, nil
+}
+
+// openDocumentFromMemory hands a document to MuPDF. Opening from memory
+// makes go-fitz sniff the format from magic bytes instead of trusting the
+// extension, which is what lets zip-based .cbr files open as comics. MuPDF
+// can't read MOBI, those are converted to an EPUB first.
+func openDocumentFromMemory(raw []byte, ext string) (*fitz.Document, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("document is empty")
+	}
+	if ext == ".mobi" {
+		epub, err := mobiToEPUB(raw)
+		if err != nil {
+			return nil, err
+		}
+		raw = epub
+	}
+	doc, err := fitz.NewFromMemory(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open document: %w", err)
+	}
+	return doc, nil
+}
+
+// openDocument opens the stored blob behind a document's file_directory with
+// MuPDF. release must be called once the document is closed.
+func openDocument(fileDirectory string) (doc *fitz.Document, release func(), err error) {
+	raw, release, err := readDocument(fileDirectory)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err = openDocumentFromMemory(raw, strings.ToLower(filepath.Ext(fileDirectory)))
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return doc, release, nil
+}
+
+// writePNG encodes img with maximum compression and writes it to path.
+func writePNG(path string, img image.Image) error {
 	var buf bytes.Buffer
 	encoder := png.Encoder{CompressionLevel: png.BestCompression}
-	err = encoder.Encode(&buf, resized)
-	if err != nil {
+	if err := encoder.Encode(&buf, img); err != nil {
 		return fmt.Errorf("failed to encode image: %w", err)
 	}
 
-	previewsDir := UPLOAD_DIR + string(os.PathSeparator) + "pdf_previews"
-	if err := os.MkdirAll(previewsDir, os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create previews directory: %w", err)
+	return writePreviewFile(path, &buf)
+}
+
+// pagePreviewsDir is where per-page renders and document info for a file are cached:
+// /uploaded_files/pdf_previews/pages/<file_directory>
+func pagePreviewsDir(fileDirectory string) string {
+	return filepath.Join(UPLOAD_DIR, "pdf_previews", "pages", fileDirectory)
+}
+
+// parsePageWidth clamps the requested width into [minPageWidth, maxPageWidth]
+// and rounds it to the nearest pageWidthStep.
+func parsePageWidth(raw string) int {
+	if raw == "" {
+		return defaultPageWidth
+	}
+	width, err := strconv.Atoi(raw)
+	if err != nil {
+		return defaultPageWidth
+	}
+	width = int(math.Round(float64(width)/pageWidthStep)) * pageWidthStep
+	if width < minPageWidth {
+		width = minPageWidth
+	}
+	if width > maxPageWidth {
+		width = maxPageWidth
+	}
+	return width
+}
+
+func returnPagePreview(c *gin.Context) {
+	go socketHandler.SiteActivityPulse()
+
+	fileDirectory := c.Param("file_directory")
+	page, err := strconv.Atoi(c.Param("page"))
+	if err != nil || page < 0 {
+		c.String(http.StatusBadRequest, "Invalid page number")
+		return
+	}
+	width := parsePageWidth(c.Query("width"))
+
+	previewFile := filepath.Join(pagePreviewsDir(fileDirectory), fmt.Sprintf("%d_%d.png", page, width))
+	if _, err := os.Stat(previewFile); err == nil {
+		if _, err := database.GetFile(fileDirectory); err != nil {
+			c.String(http.StatusNotFound, "File not found")
+			return
+		}
+		servePreview(c, previewFile)
+		return
+	}
+
+	// every page and width is a job of its own, all share the preview slots
+	generate := func() error { return generatePagePreview(fileDirectory, page, width, previewFile) }
+	key := "page/" + fileDirectory + "/" + filepath.Base(previewFile)
+	if err := runPreviewJob(key, previewFile, generate); err != nil {
+		if err == fitz.ErrPageMissing {
+			c.String(http.StatusNotFound, "Page not found")
+			return
+		}
+		c.String(http.StatusInternalServerError, "Failed to generate preview: "+err.Error())
+		return
+	}
+	servePreview(c, previewFile)
+}
+
+// generatePagePreview renders a single zero-based page of a document so that
+// the output is exactly width pixels wide.
+func generatePagePreview(fileDirectory string, page int, width int, previewFilePath string) error {
+	doc, release, err := openDocument(fileDirectory)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer doc.Close()
+
+	if page >= doc.NumPage() {
+		return fitz.ErrPageMissing
+	}
+
+	img, err := renderPage(doc, page, width)
+	if err != nil {
+		return fmt.Errorf("failed to render page %d: %w", page, err)
+	}
+
+	// the output is width pixels wide whatever the page, so its height is
+	// what has to stay within budget
+	bounds := img.Bounds()
+	if int64(width)*int64(width)*int64(bounds.Dy())/int64(bounds.Dx()) > maxRenderPixels {
+		return fmt.Errorf("page %d is too large to preview", page)
 	}
 
-	f, err := os.Create(previewFile)
+	resized := resize.Resize(uint(width), 0, img, resize.Lanczos3)
+	return writePNG(previewFilePath, resized)
+}
+
+// renderPage renders a zero-based page at the DPI that gets it just past
+// width pixels wide, within maxRenderDPI and maxRenderPixels. The result may
+// be narrower than width when the page is too large to render that big.
+func renderPage(doc *fitz.Document, page int, width int) (image.Image, error) {
+	probe, err := doc.ImageDPI(page, probeDPI)
 	if err != nil {
-		return fmt.Errorf("failed to create image file: %w", err)
+		return nil, err
 	}
-	defer f.Close()
+	probeWidth, probeHeight := probe.Bounds().Dx(), probe.Bounds().Dy()
+	if probeWidth < 1 || probeHeight < 1 {
+		return nil, fmt.Errorf("page has no size")
+	}
+
+	dpi := math.Min(math.Ceil(probeDPI*float64(width)/float64(probeWidth)), maxRenderDPI)
+	// pixel count grows with the square of the DPI
+	if pixelDPI := probeDPI * math.Sqrt(maxRenderPixels/float64(probeWidth*probeHeight)); dpi > pixelDPI {
+		dpi = math.Floor(pixelDPI)
+	}
+	if dpi <= probeDPI {
+		return probe, nil
+	}
+	return doc.ImageDPI(page, dpi)
+}
 
-	_, err = f.Write(buf.Bytes())
+func returnDocumentInfo(c *gin.Context) {
+	fileDirectory := c.Param("file_directory")
+	documentInfo, err := getDocumentInfo(fileDirectory)
 	if err != nil {
-		return fmt.Errorf("failed to write image to file: %w", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, documentInfo)
+}
+
+// getDocumentInfo returns page count, title and author for a document,
+// reading them from the on-disk cache when the document was opened before.
+func getDocumentInfo(fileDirectory string) (DocumentInfo, error) {
+	var documentInfo DocumentInfo
+	infoFile := filepath.Join(pagePreviewsDir(fileDirectory), "info.json")
+	if raw, err := os.ReadFile(infoFile); err == nil {
+		if _, err := database.GetFile(fileDirectory); err != nil {
+			return documentInfo, fmt.Errorf("file not found: %w", err)
+		}
+		if err := json.Unmarshal(raw, &documentInfo); err == nil {
+			touchPreview(infoFile)
+			return documentInfo, nil
+		}
+	}
+
+	raw, release, err := readDocument(fileDirectory)
+	if err != nil {
+		return documentInfo, err
+	}
+	defer release()
+	ext := strings.ToLower(filepath.Ext(fileDirectory))
+	doc, err := openDocumentFromMemory(raw, ext)
+	if err != nil {
+		return documentInfo, err
+	}
+	defer doc.Close()
+
+	metadata := doc.Metadata()
+	documentInfo = DocumentInfo{
+		PageCount: doc.NumPage(),
+		Title:     cleanMetadata(metadata["title"]),
+		Author:    cleanMetadata(metadata["author"]),
+	}
+	if ext == ".mobi" {
+		// the converted EPUB carries no metadata, the MOBI header does
+		if book, err := parseMobi(raw); err == nil {
+			documentInfo.Title = cleanMetadata(book.title)
+			documentInfo.Author = cleanMetadata(book.author)
+		}
+	}
+
+	if raw, err := json.Marshal(documentInfo); err == nil {
+		writePreviewFile(infoFile, bytes.NewReader(raw))
+	}
+	return documentInfo, nil
+}
+
+// cleanMetadata trims the fixed-size, NUL padded buffers go-fitz hands back.
+func cleanMetadata(value string) string {
+	if i := strings.IndexByte(value, 0); i >= 0 {
+		value = value[:i]
 	}
-	return nil
+	return strings.TrimSpace(value)
 }
@@ -0,0 +1,248 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"angadrive/vars"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewCacheDirs are the directories under UPLOAD_DIR that only hold
+// derived data, anything in them can be regenerated from the original blob.
+var previewCacheDirs = []string{"image_previews", "pdf_previews", "text_previews", "archive_listings", "audio_previews", "stripped_images"}
+
+const previewSweepInterval = time.Hour
+
+// access times are written back to disk at most this often per preview, so
+// LRU order survives restarts without a write on every request
+const previewTouchPersistInterval = time.Hour
+
+type previewCacheEntry struct {
+	size          int64
+	lastAccess    time.Time
+	lastPersisted time.Time
+}
+
+var (
+	previewCache      = make(map[string]*previewCacheEntry)
+	previewCacheBytes int64
+	previewCacheLock  sync.Mutex
+)
+
+// initPreviewCache indexes every preview already on disk, using modification
+// time as the last access time, then starts the periodic orphan sweep.
+func initPreviewCache() {
+	previewCacheLock.Lock()
+	for _, dir := range previewCacheDirs {
+		filepath.WalkDir(filepath.Join(UPLOAD_DIR, dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			previewCache[path] = &previewCacheEntry{
+				size:          info.Size(),
+				lastAccess:    info.ModTime(),
+				lastPersisted: info.ModTime(),
+			}
+			previewCacheBytes += info.Size()
+			return nil
+		})
+	}
+	previewCacheLock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(previewSweepInterval)
+		defer ticker.Stop()
+		for {
+			sweepOrphanedPreviews()
+			evictPreviews()
+			<-ticker.C
+		}
+	}()
+}
+
+// recordPreview adds a freshly written preview to the index and evicts the
+// least recently used previews if that pushed the cache over budget.
+func recordPreview(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	previewCacheLock.Lock()
+	if old, ok := previewCache[path]; ok {
+		previewCacheBytes -= old.size
+	}
+	previewCache[path] = &previewCacheEntry{size: info.Size(), lastAccess: now, lastPersisted: now}
+	previewCacheBytes += info.Size()
+	overBudget := previewCacheBytes > vars.PreviewCacheBytes
+	previewCacheLock.Unlock()
+
+	if overBudget {
+		go evictPreviews()
+	}
+}
+
+// touchPreview marks a preview as just used.
+func touchPreview(path string) {
+	now := time.Now()
+	previewCacheLock.Lock()
+	entry, ok := previewCache[path]
+	if !ok {
+		previewCacheLock.Unlock()
+		return
+	}
+	entry.lastAccess = now
+	persist := now.Sub(entry.lastPersisted) > previewTouchPersistInterval
+	if persist {
+		entry.lastPersisted = now
+	}
+	previewCacheLock.Unlock()
+
+	if persist {
+		os.Chtimes(path, now, now)
+	}
+}
+
+// servePreview sends a cached preview and records the access for LRU eviction.
+func servePreview(c *gin.Context, path string) {
+	touchPreview(path)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", previewCacheControl)
+	// previews get regenerated rather than changed, size and mtime are enough
+	// to tell versions apart (ServeFile answers If-None-Match with it)
+	if info, err := os.Stat(path); err == nil {
+		c.Header("ETag", fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	}
+	// previews keep their source's name but not always its format (SVG and
+	// WebP previews are PNGs), so the type comes from the content
+	if file, err := os.Open(path); err == nil {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(file, head)
+		file.Close()
+		if contentType := http.DetectContentType(head[:n]); strings.HasPrefix(contentType, "image/") {
+			c.Header("Content-Type", contentType)
+		}
+	}
+	c.File(path)
+}
+
+// evictPreviews removes least recently used previews until the cache is back
+// under 90% of its budget, leaving headroom so eviction doesn't run on every write.
+func evictPreviews() {
+	previewCacheLock.Lock()
+	defer previewCacheLock.Unlock()
+	if previewCacheBytes <= vars.PreviewCacheBytes {
+		return
+	}
+	target := vars.PreviewCacheBytes / 10 * 9
+
+	paths := make([]string, 0, len(previewCache))
+	for path := range previewCache {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return previewCache[paths[i]].lastAccess.Before(previewCache[paths[j]].lastAccess)
+	})
+
+	evicted := 0
+	for _, path := range paths {
+		if previewCacheBytes <= target {
+			break
+		}
+		unsafeRemovePreview(path)
+		evicted++
+	}
+	fmt.Printf("[GIN-debug] Evicted %d previews, preview cache is now %d bytes\n", evicted, previewCacheBytes)
+}
+
+// unsafeRemovePreview deletes a preview from disk and from the index.
+// The caller MUST hold previewCacheLock.
+func unsafeRemovePreview(path string) {
+	entry, ok := previewCache[path]
+	if !ok {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	previewCacheBytes -= entry.size
+	delete(previewCache, path)
+	// per-page document renders live in their own directory, drop it once empty
+	if dir := filepath.Dir(path); filepath.Base(filepath.Dir(dir)) == "pages" {
+		os.Remove(dir)
+	}
+}
+
+// previewSource maps a preview path back to the file_directory it was made from.
+func previewSource(path string) string {
+	relative, err := filepath.Rel(UPLOAD_DIR, path)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(filepath.ToSlash(relative), "/")
+	switch {
+	case len(parts) == 2 && (parts[0] == "image_previews" || parts[0] == "stripped_images"):
+		return parts[1]
+	case len(parts) == 2 && parts[0] == "pdf_previews":
+		return strings.TrimSuffix(parts[1], ".png")
+	case len(parts) == 4 && parts[0] == "pdf_previews" && parts[1] == "pages":
+		return parts[2]
+	case len(parts) == 2 && parts[0] == "text_previews":
+		return strings.TrimSuffix(parts[1], ".json")
+	case len(parts) == 2 && (parts[0] == "archive_listings" || parts[0] == "audio_previews"):
+		return strings.TrimSuffix(parts[1], ".json")
+	}
+	return ""
+}
+
+// sweepOrphanedPreviews removes previews whose source file no longer exists.
+func sweepOrphanedPreviews() {
+	previewCacheLock.Lock()
+	paths := make([]string, 0, len(previewCache))
+	for path := range previewCache {
+		paths = append(paths, path)
+	}
+	previewCacheLock.Unlock()
+
+	removed := 0
+	for _, path := range paths {
+		// previews of accounts pending deletion are kept, the account can
+		// still be restored
+		source := previewSource(path)
+		if source != "" && database.FileExists(source) {
+			continue
+		}
+		previewCacheLock.Lock()
+		unsafeRemovePreview(path)
+		previewCacheLock.Unlock()
+		removed++
+	}
+	if removed > 0 {
+		fmt.Printf("[GIN-debug] Removed %d orphaned previews\n", removed)
+	}
+}
+
+// RemovePreviews deletes every cached preview derived from a file.
+func RemovePreviews(file database.FileData) {
+	previewCacheLock.Lock()
+	defer previewCacheLock.Unlock()
+	for path := range previewCache {
+		if previewSource(path) == file.FileDirectory {
+			unsafeRemovePreview(path)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestCachedPreviewsOfHiddenFiles checks that a preview left on disk isn't
+// served once its file is hidden by the owner's pending account deletion.
+func TestCachedPreviewsOfHiddenFiles(t *testing.T) {
+	setupUploads(t)
+	var image bytes.Buffer
+	if err := png.Encode(&image, tinyImage()); err != nil {
+		t.Fatal(err)
+	}
+	for _, fileDirectory := range []string{"photo.png", "doc.pdf", "notes.txt", "song.mp3", "pack.zip"} {
+		storeTestFile(t, fileDirectory, []byte("original"), "leaving-token")
+	}
+
+	cached := map[string][]byte{
+		filepath.Join("image_previews", "photo.png"):                   image.Bytes(),
+		filepath.Join("image_previews", "song.mp3"):                    image.Bytes(),
+		filepath.Join("pdf_previews", "doc.pdf.png"):                   image.Bytes(),
+		filepath.Join("pdf_previews", "pages", "doc.pdf", "0_512.png"): image.Bytes(),
+		filepath.Join("pdf_previews", "pages", "doc.pdf", "info.json"): []byte(`{"page_count":1}`),
+		filepath.Join("text_previews", "notes.txt.json"):               []byte(`{}`),
+		filepath.Join("audio_previews", "song.mp3.json"):               []byte(`{}`),
+		filepath.Join("archive_listings", "pack.zip.json"):             []byte(`{}`),
+	}
+	for name, data := range cached {
+		path := filepath.Join(UPLOAD_DIR, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/preview/:file_directory", returnFilePreview)
+	router.GET("/preview/:file_directory/page/:page", returnPagePreview)
+	router.GET("/preview/:file_directory/info", returnDocumentInfo)
+	router.GET("/preview-image/:file_directory", returnImagePreview)
+	router.GET("/preview-text/:file_directory", returnTextPreview)
+	router.GET("/audio/:file_directory", returnAudioPreview)
+	router.GET("/archive/:file_directory", returnArchiveListing)
+
+	paths := []string{
+		"/preview/doc.pdf.png",
+		"/preview/doc.pdf/page/0",
+		"/preview/doc.pdf/info",
+		"/preview-image/photo.png",
+		"/preview-image/song.mp3",
+		"/preview-text/notes.txt",
+		"/audio/song.mp3",
+		"/archive/pack.zip",
+	}
+	for _, hidden := range []bool{false, true} {
+		database.PendingDeletionMutex.Lock()
+		if hidden {
+			database.PendingDeletion["leaving-token"] = 1
+		} else {
+			delete(database.PendingDeletion, "leaving-token")
+		}
+		database.PendingDeletionMutex.Unlock()
+
+		want := http.StatusOK
+		if hidden {
+			want = http.StatusNotFound
+		}
+		for _, path := range paths {
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+			if response.Code != want {
+				t.Errorf("%s (hidden %v): status = %d, want %d: %s", path, hidden, response.Code, want, response.Body.String())
+			}
+		}
+	}
+	database.PendingDeletionMutex.Lock()
+	delete(database.PendingDeletion, "leaving-token")
+	database.PendingDeletionMutex.Unlock()
+}
+
+func TestSweepKeepsPreviewsOfPendingAccounts(t *testing.T) {
+	setupUploads(t)
+	storeTestFile(t, "kept.png", []byte("original"), "leaving-token")
+	database.PendingDeletionMutex.Lock()
+	database.PendingDeletion["leaving-token"] = 1
+	database.PendingDeletionMutex.Unlock()
+	t.Cleanup(func() {
+		database.PendingDeletionMutex.Lock()
+		delete(database.PendingDeletion, "leaving-token")
+		database.PendingDeletionMutex.Unlock()
+	})
+
+	tests := []struct {
+		name string
+		path string
+		kept bool
+	}{
+		// the account can still be restored within the grace period
+		{"file of a pending account", filepath.Join(UPLOAD_DIR, "image_previews", "kept.png"), true},
+		{"file that is gone", filepath.Join(UPLOAD_DIR, "image_previews", "gone.png"), false},
+	}
+	for _, tt := range tests {
+		os.MkdirAll(filepath.Dir(tt.path), os.ModePerm)
+		if err := os.WriteFile(tt.path, []byte("preview"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		recordPreview(tt.path)
+	}
+	sweepOrphanedPreviews()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := os.Stat(tt.path)
+			if kept := err == nil; kept != tt.kept {
+				t.Errorf("kept = %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
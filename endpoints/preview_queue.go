@@ -0,0 +1,240 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"angadrive/socketHandler"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxConcurrentPreviews = 4
+const previewQueueSize = 1000
+
+// files larger than this are left for the lazy path, the frontend doesn't
+// request previews for them anyway
+const maxEagerPreviewSize = 40 * 1024 * 1024
+
+var imagePreviewExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".bmp":  true,
+	".webp": true,
+	".tiff": true,
+	".heic": true,
+	".heif": true,
+	".svg":  true,
+}
+
+// previewJob is a preview that is currently being generated. Anyone else who
+// wants the same preview waits on done instead of generating it again.
+type previewJob struct {
+	done chan struct{}
+	err  error
+}
+
+var (
+	previewJobs     = make(map[string]*previewJob)
+	previewJobsLock sync.Mutex
+
+	// fileDirectory -> true while the file is waiting in previewQueue
+	previewQueued sync.Map
+	// fileDirectory -> error message of the last failed attempt
+	previewFailures sync.Map
+
+	previewQueue   = make(chan database.FileData, previewQueueSize)
+	previewLimiter = make(chan struct{}, maxConcurrentPreviews)
+)
+
+// previewFor returns where the preview of fileDirectory lives and the function
+// that builds it. ok is false for file types that have no image preview.
+func previewFor(fileDirectory string) (previewFile string, generate func() error, ok bool) {
+	ext := strings.ToLower(filepath.Ext(fileDirectory))
+	switch {
+	case imagePreviewExtensions[ext]:
+		previewsDir := filepath.Join(UPLOAD_DIR, "image_previews")
+		previewFile = filepath.Join(previewsDir, fileDirectory)
+		return previewFile, func() error { return generateImagePreview(fileDirectory, previewsDir, previewFile) }, true
+	case audioExtensions[ext]:
+		previewFile = audioPreviewFile(fileDirectory)
+		return previewFile, func() error { return generateAudioPreview(fileDirectory) }, true
+	case documentExtensions[ext]:
+		previewFile = filepath.Join(UPLOAD_DIR, "pdf_previews", fileDirectory+".png")
+		return previewFile, func() error { return generatePreview(fileDirectory + ".png") }, true
+	}
+	return "", nil, false
+}
+
+// generateOnce runs generate for fileDirectory unless previewFile already
+// exists, making sure only one generation per file runs at a time and at
+// most maxConcurrentPreviews run overall. The outcome is kept for /preview-status.
+func generateOnce(fileDirectory string, previewFile string, generate func() error) error {
+	return runPreviewJob(fileDirectory, previewFile, func() error {
+		err := generateRecovered(generate)
+		if err != nil {
+			previewFailures.Store(fileDirectory, err.Error())
+		} else {
+			previewFailures.Delete(fileDirectory)
+		}
+		return err
+	})
+}
+
+// runPreviewJob is generateOnce without the status, for previews that are one
+// of many of a file (document pages) and keyed by more than its directory.
+func runPreviewJob(key string, previewFile string, generate func() error) error {
+	previewJobsLock.Lock()
+	if job, ok := previewJobs[key]; ok {
+		previewJobsLock.Unlock()
+		<-job.done
+		return job.err
+	}
+	if _, err := os.Stat(previewFile); err == nil {
+		previewJobsLock.Unlock()
+		return nil
+	}
+	job := &previewJob{done: make(chan struct{})}
+	previewJobs[key] = job
+	previewJobsLock.Unlock()
+
+	previewLimiter <- struct{}{}
+	job.err = generateRecovered(generate)
+	<-previewLimiter
+
+	previewJobsLock.Lock()
+	delete(previewJobs, key)
+	previewJobsLock.Unlock()
+	close(job.done)
+	return job.err
+}
+
+// generateRecovered turns a panic in a decoder into an error. Generation also
+// runs from the preview workers, outside gin's Recovery middleware, where a
+// panic would take the whole server down.
+func generateRecovered(generate func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("preview generation panicked: %v", r)
+		}
+	}()
+	return generate()
+}
+
+// QueuePreview schedules background preview generation for a newly inserted file.
+func QueuePreview(file database.FileData) {
+	if videoPosterExtensions[strings.ToLower(filepath.Ext(file.FileDirectory))] {
+		queueVideoPlaceholder(file)
+		return
+	}
+	if _, _, ok := previewFor(file.FileDirectory); !ok || file.FileSize > maxEagerPreviewSize {
+		return
+	}
+	if _, loaded := previewQueued.LoadOrStore(file.FileDirectory, true); loaded {
+		return
+	}
+	select {
+	case previewQueue <- file:
+		go socketHandler.PreviewStatusPulse(file.AccountToken, file.FileDirectory, "queued")
+	default:
+		// Queue is full, the preview will be generated when first requested.
+		previewQueued.Delete(file.FileDirectory)
+	}
+}
+
+func startPreviewWorkers() {
+	for i := 0; i < maxConcurrentPreviews; i++ {
+		go func() {
+			for file := range previewQueue {
+				processQueuedPreview(file)
+			}
+		}()
+	}
+}
+
+func processQueuedPreview(file database.FileData) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("Warning: Preview worker panicked on %s: %v\n", file.FileDirectory, r)
+		}
+	}()
+	previewQueued.Delete(file.FileDirectory)
+	previewFile, generate, _ := previewFor(file.FileDirectory)
+	status := "ready"
+	if err := generateOnce(file.FileDirectory, previewFile, generate); err != nil {
+		fmt.Printf("Warning: Failed to generate preview for %s: %v\n", file.FileDirectory, err)
+		status = "failed"
+	}
+	go socketHandler.PreviewStatusPulse(file.AccountToken, file.FileDirectory, status)
+}
+
+// previewStatus reports one of "unsupported", "queued", "processing",
+// "ready", "failed" or "missing" (supported but never generated).
+func previewStatus(fileDirectory string) (string, string) {
+	previewFile, _, ok := previewFor(fileDirectory)
+	if !ok {
+		return "unsupported", ""
+	}
+	if _, queued := previewQueued.Load(fileDirectory); queued {
+		return "queued", ""
+	}
+	previewJobsLock.Lock()
+	_, processing := previewJobs[fileDirectory]
+	previewJobsLock.Unlock()
+	if processing {
+		return "processing", ""
+	}
+	if _, err := os.Stat(previewFile); err == nil {
+		return "ready", ""
+	}
+	if message, failed := previewFailures.Load(fileDirectory); failed {
+		return "failed", message.(string)
+	}
+	return "missing", ""
+}
+
+func returnPreviewStatus(c *gin.Context) {
+	fileDirectory := c.Param("file_directory")
+	if _, err := database.GetFile(fileDirectory); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	status, message := previewStatus(fileDirectory)
+	response := gin.H{"file_directory": fileDirectory, "status": status}
+	if message != "" {
+		response["error"] = message
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// writePreviewFile writes a preview through a temporary file and renames it
+// into place, so a reader never sees a half-written preview.
+func writePreviewFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create previews directory: %w", err)
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(path), ".preview-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create preview file: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+	if _, err := io.Copy(tempFile, r); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to write preview to file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to write preview to file: %w", err)
+	}
+	if err := os.Rename(tempFile.Name(), path); err != nil {
+		return fmt.Errorf("failed to move preview into place: %w", err)
+	}
+	recordPreview(path)
+	return nil
+}
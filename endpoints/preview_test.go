@@ -0,0 +1,154 @@
+package endpoints
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gen2brain/go-fitz"
+	"github.com/gin-gonic/gin"
+)
+
+// buildPDF writes a minimal single page PDF with the given MediaBox size in points.
+func buildPDF(width, height int) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] >>", width, height),
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestRenderPage(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int // page size in points
+		requested     int
+		minWidth      int
+	}{
+		{"letter", 612, 792, 1024, 1024},
+		{"small page hits the DPI cap", 100, 100, 2048, 100 * maxRenderDPI / 72},
+		{"huge square", 14400, 14400, 2048, 2048},
+		{"sliver", 1, 14400, 2048, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := fitz.NewFromMemory(buildPDF(tt.width, tt.height))
+			if err != nil {
+				t.Fatalf("failed to open PDF: %v", err)
+			}
+			defer doc.Close()
+
+			img, err := renderPage(doc, 0, tt.requested)
+			if err != nil {
+				t.Fatalf("renderPage failed: %v", err)
+			}
+			bounds := img.Bounds()
+			if pixels := bounds.Dx() * bounds.Dy(); pixels > maxRenderPixels {
+				t.Errorf("rendered %dx%d, over the %d pixel budget", bounds.Dx(), bounds.Dy(), maxRenderPixels)
+			}
+			if bounds.Dx() < tt.minWidth {
+				t.Errorf("rendered %d pixels wide, want at least %d", bounds.Dx(), tt.minWidth)
+			}
+		})
+	}
+}
+
+func TestGenerateOnceRecoversPanics(t *testing.T) {
+	previewFile := filepath.Join(t.TempDir(), "preview.png")
+	err := generateOnce("panics.png", previewFile, func() error { panic("corrupt input") })
+	if err == nil {
+		t.Fatal("expected the panic to come back as an error")
+	}
+	if len(previewLimiter) != 0 {
+		t.Error("panicking generation kept its limiter slot")
+	}
+	previewJobsLock.Lock()
+	_, stuck := previewJobs["panics.png"]
+	previewJobsLock.Unlock()
+	if stuck {
+		t.Error("panicking generation left its job behind")
+	}
+	// the failure is recorded and the next attempt runs again
+	if status, _ := previewStatus("panics.png"); status != "failed" {
+		t.Errorf("status = %q, want failed", status)
+	}
+	if err := generateOnce("panics.png", previewFile, func() error { return nil }); err != nil {
+		t.Errorf("retry failed: %v", err)
+	}
+}
+
+func TestRunPreviewJobRunsOnce(t *testing.T) {
+	previewFile := filepath.Join(t.TempDir(), "0_512.png")
+	var runs atomic.Int32
+	generate := func() error {
+		runs.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return os.WriteFile(previewFile, []byte("png"), 0644)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := runPreviewJob("page/doc.pdf/0_512.png", previewFile, generate); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if runs.Load() != 1 {
+		t.Errorf("generated %d times, want once", runs.Load())
+	}
+}
+
+func TestPagePreview(t *testing.T) {
+	setupUploads(t)
+	storeTestFile(t, "doc.pdf", buildPDF(612, 792), "owner-token")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/preview/:file_directory/page/:page", returnPagePreview)
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"first page", "/preview/doc.pdf/page/0", http.StatusOK},
+		{"first page cached", "/preview/doc.pdf/page/0", http.StatusOK},
+		{"missing page", "/preview/doc.pdf/page/5", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if response.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", response.Code, tt.status, response.Body.String())
+			}
+		})
+	}
+	// a missing page isn't a failed preview of the document
+	if status, _ := previewStatus("doc.pdf"); status == "failed" {
+		t.Error("page error was recorded as the document's preview status")
+	}
+}
@@ -0,0 +1,68 @@
+package endpoints
+
+import (
+	"angadrive/vars"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// activeContentTypes can run scripts or pull in other resources when a
+// browser renders them, so they never render with the assets origin's privileges.
+var activeContentTypes = map[string]bool{
+	"text/html":                     true,
+	"application/xhtml+xml":         true,
+	"image/svg+xml":                 true,
+	"text/xml":                      true,
+	"application/xml":               true,
+	"text/xsl":                      true,
+	"application/xslt+xml":          true,
+	"text/javascript":               true,
+	"application/javascript":        true,
+	"application/x-javascript":      true,
+	"application/ecmascript":        true,
+	"application/wasm":              true,
+	"application/x-shockwave-flash": true,
+}
+
+// sandboxPolicy makes the browser treat a rendered document as a unique
+// origin with scripts, forms, plugins and popups disabled.
+const sandboxPolicy = "sandbox; default-src 'none'; img-src data:; style-src 'unsafe-inline'; media-src data:"
+
+func isActiveContent(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	return activeContentTypes[mediaType]
+}
+
+// setServingHeaders applies the serving policy to a response carrying the
+// user content called name, and returns the content type it's served as.
+//
+// The type only ever comes from the extension and nosniff stops browsers
+// from guessing a more dangerous one. Active content is sandboxed, and is
+// always a download when the assets are served from the app's own host,
+// since a sandbox is the only thing between it and the user's session there.
+func setServingHeaders(c *gin.Context, name string, attachment bool) string {
+	contentType := mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if isActiveContent(contentType) {
+		c.Header("Content-Security-Policy", sandboxPolicy)
+		if vars.AssetsURL == vars.WebURL {
+			attachment = true
+		}
+	}
+	disposition := "inline"
+	if attachment {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": path.Base(name)}))
+	return contentType
+}
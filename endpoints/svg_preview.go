@@ -0,0 +1,176 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"golang.org/x/net/html/charset"
+)
+
+const maxSVGPreviewSize = 20 * 1024 * 1024
+
+// elements that can run code or pull in other documents, dropped with everything inside them
+var unsafeSVGElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"image":         true,
+	"feimage":       true,
+	"animate":       true,
+	"set":           true,
+}
+
+// matches url(...) references that point anywhere but an element of the same document
+var externalURL = regexp.MustCompile(`(?i)url\(\s*['"]?\s*[^#'"\s)]`)
+
+// rasterizeSVG renders a sanitized copy of the SVG in file to a PNG that fits
+// the 512px preview box. The original SVG is never served from the preview
+// route, so scripts in it can't run on the assets domain.
+func rasterizeSVG(file *os.File, buf *bytes.Buffer) (err error) {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > maxSVGPreviewSize {
+		return fmt.Errorf("SVG file exceeds %dMB preview limit", maxSVGPreviewSize/1024/1024)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return err
+	}
+	clean, err := sanitizeSVG(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse SVG: %w", err)
+	}
+
+	// the renderer isn't hardened against every malformed path
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to render SVG: %v", r)
+		}
+	}()
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(clean))
+	if err != nil {
+		return fmt.Errorf("failed to parse SVG: %w", err)
+	}
+	width, height := icon.ViewBox.W, icon.ViewBox.H
+	if width <= 0 || height <= 0 {
+		width, height = 512, 512
+	}
+	// vectors scale up for free, so small icons get the full preview size too
+	newWidth, newHeight := previewDimensions(int(math.Ceil(width)), int(math.Ceil(height)))
+	icon.SetTarget(0, 0, float64(newWidth), float64(newHeight))
+	img := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	scanner := rasterx.NewScannerGV(newWidth, newHeight, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(newWidth, newHeight, scanner), 1)
+
+	if err := png.Encode(buf, img); err != nil {
+		return fmt.Errorf("failed to encode png: %w", err)
+	}
+	return nil
+}
+
+// sanitizeSVG re-encodes an SVG without scripts, event handlers, external
+// references, comments or DOCTYPEs (which is where entity definitions live).
+func sanitizeSVG(r io.Reader) ([]byte, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var out bytes.Buffer
+	encoder := xml.NewEncoder(&out)
+	skipDepth := 0
+	styleDepth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 || !safeSVGElement(&t) {
+				skipDepth++
+				continue
+			}
+			if strings.EqualFold(t.Name.Local, "style") {
+				styleDepth++
+			}
+			if err := encoder.EncodeToken(t); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			if strings.EqualFold(t.Name.Local, "style") {
+				styleDepth--
+			}
+			t.Name.Space = ""
+			if err := encoder.EncodeToken(t); err != nil {
+				return nil, err
+			}
+		case xml.CharData:
+			if skipDepth > 0 {
+				continue
+			}
+			if styleDepth > 0 && (externalURL.Match(t) || bytes.Contains(bytes.ToLower(t), []byte("@import"))) {
+				continue
+			}
+			if err := encoder.EncodeToken(t.Copy()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// safeSVGElement strips the unsafe attributes of element in place and
+// reports whether the element should be kept at all.
+func safeSVGElement(element *xml.StartElement) bool {
+	name := strings.ToLower(element.Name.Local)
+	if unsafeSVGElements[name] {
+		return false
+	}
+	element.Name.Space = ""
+	attrs := element.Attr[:0]
+	hasHref := false
+	for _, attr := range element.Attr {
+		key := strings.ToLower(attr.Name.Local)
+		switch {
+		case attr.Name.Space == "xmlns" || key == "xmlns":
+			continue // namespaces are flattened, the renderer only looks at local names
+		case strings.HasPrefix(key, "on"):
+			continue
+		case key == "href" || key == "src":
+			if !strings.HasPrefix(strings.TrimSpace(attr.Value), "#") {
+				continue
+			}
+			hasHref = true
+		case externalURL.MatchString(attr.Value):
+			continue
+		}
+		attr.Name.Space = ""
+		attrs = append(attrs, attr)
+	}
+	element.Attr = attrs
+	// a <use> that pointed outside the document has nothing left to draw
+	return name != "use" || hasHref
+}
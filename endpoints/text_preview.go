@@ -0,0 +1,235 @@
+package endpoints
+
+import (
+	"angadrive/database"
+	"angadrive/socketHandler"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/gin-gonic/gin"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+const (
+	// only this much of a file is ever read for a text preview
+	maxTextPreviewBytes = 256 * 1024
+	// CSV/TSV previews stop after this many rows
+	maxTablePreviewRows = 500
+)
+
+// TextPreview is the JSON body returned by /preview-text/:file_directory
+type TextPreview struct {
+	Kind      string     `json:"kind"` // "code", "markdown", "table" or "text"
+	Language  string     `json:"language,omitempty"`
+	HTML      string     `json:"html,omitempty"`
+	Rows      [][]string `json:"rows,omitempty"`
+	Encoding  string     `json:"encoding"`
+	Truncated bool       `json:"truncated"`
+}
+
+var markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// markdownPolicy strips scripts, event handlers and anything else that could
+// run in the viewer from rendered markdown.
+var markdownPolicy = bluemonday.UGCPolicy()
+
+func returnTextPreview(c *gin.Context) {
+	go socketHandler.SiteActivityPulse()
+
+	fileDirectory := c.Param("file_directory")
+
+	// this creates: /uploaded_files/text_previews/<file_directory>.json
+	previewFile := filepath.Join(UPLOAD_DIR, "text_previews", fileDirectory+".json")
+	if _, err := os.Stat(previewFile); err == nil {
+		if _, err := database.GetFile(fileDirectory); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		servePreview(c, previewFile)
+		return
+	}
+
+	preview, err := generateTextPreview(fileDirectory)
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	raw, err := json.Marshal(preview)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to encode preview: "+err.Error())
+		return
+	}
+	writePreviewFile(previewFile, bytes.NewReader(raw))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", raw)
+}
+
+func generateTextPreview(fileDirectory string) (TextPreview, error) {
+	var preview TextPreview
+
+	fileInfo, err := database.GetFile(fileDirectory)
+	if err != nil {
+		return preview, fmt.Errorf("file not found: %w", err)
+	}
+	file, err := os.Open(filepath.Join(UPLOAD_DIR, "i", fileInfo.Md5sum))
+	if err != nil {
+		return preview, fmt.Errorf("failed to open original file: %w", err)
+	}
+	defer file.Close()
+
+	prefix, err := io.ReadAll(io.LimitReader(file, maxTextPreviewBytes))
+	if err != nil {
+		return preview, fmt.Errorf("failed to read file: %w", err)
+	}
+	preview.Truncated = fileInfo.FileSize > int64(len(prefix))
+
+	text, encodingName, err := decodeText(prefix, preview.Truncated)
+	if err != nil {
+		return preview, err
+	}
+	preview.Encoding = encodingName
+
+	fileName := fileInfo.OriginalFileName
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".md", ".markdown":
+		var rendered bytes.Buffer
+		if err := markdownRenderer.Convert([]byte(text), &rendered); err != nil {
+			return preview, fmt.Errorf("failed to render markdown: %w", err)
+		}
+		preview.Kind = "markdown"
+		preview.HTML = markdownPolicy.Sanitize(rendered.String())
+		return preview, nil
+	case ".csv", ".tsv":
+		preview.Kind = "table"
+		preview.Rows = parseTable(text, strings.ToLower(filepath.Ext(fileName)) == ".tsv", preview.Truncated)
+		return preview, nil
+	}
+
+	lexer := detectLexer(fileName, text)
+	if lexer == nil || lexer.Config().Name == "plaintext" {
+		preview.Kind = "text"
+		preview.HTML = highlight(lexers.Fallback, text)
+		return preview, nil
+	}
+	preview.Kind = "code"
+	preview.Language = lexer.Config().Name
+	preview.HTML = highlight(lexer, text)
+	return preview, nil
+}
+
+// decodeText converts a file prefix to UTF-8, guessing its encoding from BOMs
+// and byte patterns. Anything containing NUL bytes is treated as binary.
+func decodeText(prefix []byte, truncated bool) (string, string, error) {
+	decoded := prefix
+	encodingName := "utf-8"
+	if !utf8.Valid(trimPartialRune(prefix, truncated)) {
+		var enc encoding.Encoding
+		enc, encodingName, _ = charset.DetermineEncoding(prefix, "text/plain")
+		var err error
+		decoded, err = enc.NewDecoder().Bytes(prefix)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to decode text: %w", err)
+		}
+	}
+	if bytes.IndexByte(decoded, 0) >= 0 {
+		return "", "", fmt.Errorf("file does not look like text")
+	}
+	decoded = trimPartialRune(decoded, truncated)
+	decoded = bytes.TrimPrefix(decoded, []byte("\ufeff"))
+	return strings.ToValidUTF8(string(decoded), "\ufffd"), encodingName, nil
+}
+
+// trimPartialRune drops a multi-byte character that the preview cut landed
+// in the middle of. Untruncated text is returned unchanged.
+func trimPartialRune(text []byte, truncated bool) []byte {
+	if !truncated {
+		return text
+	}
+	for i := 0; i < utf8.UTFMax && len(text) > 0; i++ {
+		r, size := utf8.DecodeLastRune(text)
+		if r != utf8.RuneError || size != 1 {
+			break
+		}
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// detectLexer picks a lexer from the file name, then from a shebang line,
+// then from chroma's content analysis. It returns nil for plain text.
+func detectLexer(fileName string, text string) chroma.Lexer {
+	if lexer := lexers.Match(fileName); lexer != nil {
+		return lexer
+	}
+	if strings.HasPrefix(text, "#!") {
+		firstLine, _, _ := strings.Cut(text, "\n")
+		fields := strings.Fields(strings.TrimPrefix(firstLine, "#!"))
+		if len(fields) > 0 {
+			interpreter := filepath.Base(fields[0])
+			if interpreter == "env" && len(fields) > 1 {
+				interpreter = fields[len(fields)-1]
+			}
+			interpreter = strings.TrimRight(interpreter, "0123456789.")
+			if lexer := lexers.Get(interpreter); lexer != nil {
+				return lexer
+			}
+		}
+	}
+	return lexers.Analyse(text)
+}
+
+func highlight(lexer chroma.Lexer, text string) string {
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, text)
+	if err != nil {
+		return ""
+	}
+	var out bytes.Buffer
+	formatter := chromahtml.New(chromahtml.WithLineNumbers(true), chromahtml.TabWidth(4))
+	if err := formatter.Format(&out, styles.Get("monokai"), iterator); err != nil {
+		return ""
+	}
+	return out.String()
+}
+
+// parseTable reads up to maxTablePreviewRows rows of CSV/TSV. Ragged rows are
+// kept as-is; when the prefix was truncated the last (likely partial) row is dropped.
+func parseTable(text string, tabSeparated bool, truncated bool) [][]string {
+	reader := csv.NewReader(strings.NewReader(text))
+	if tabSeparated {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows := [][]string{}
+	for len(rows) < maxTablePreviewRows {
+		row, err := reader.Read()
+		if err == io.EOF {
+			if truncated && len(rows) > 0 {
+				rows = rows[:len(rows)-1]
+			}
+			break
+		}
+		if err != nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -3,6 +3,7 @@ package endpoints
 import (
 	"compress/gzip"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -83,19 +84,40 @@ func finalizeUpload(c *gin.Context) {
 
 	var accountToken string
 	if email != "" && password != "" {
-		if accounts.Authenticate(email, password) {
+		if err := accounts.AuthenticateFrom(email, password, c.ClientIP()); err == nil {
 			user, err := database.FindUserByEmail(email)
 			if err != nil {
 				c.String(401, "Authentication successful but failed to retrieve user details")
 				return
 			}
 			accountToken = user.Token
+		} else if lockout, ok := err.(accounts.LockoutError); ok {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(lockout.Until).Seconds())+1))
+			c.String(429, lockout.Error())
+			return
 		} else {
 			c.String(401, "Invalid email or password")
 			return
 		}
+	} else if accounts.IsAPIKey(userToken) {
+		key, err := accounts.AuthorizeAPIKey(userToken, accounts.ScopeUpload)
+		if err != nil {
+			c.String(403, err.Error())
+			return
+		}
+		// checked before assembling, a key limited to some collections can only upload into them
+		if key.Restricted() && !key.AllowsCollection(collectionID) {
+			c.String(403, "API key can only upload into the collections it's limited to")
+			return
+		}
+		accountToken = key.AccountToken
 	} else if userToken != "" {
-		accountToken = userToken
+		var err error
+		accountToken, err = accounts.ResolveToken(userToken)
+		if err != nil {
+			c.String(401, err.Error())
+			return
+		}
 	} else {
 		c.String(400, "Missing authentication details (token or email/password)")
 		return
@@ -145,10 +167,11 @@ func finalizeUpload(c *gin.Context) {
 		}
 	}
 
-	// Calculate MD5 hash of the assembled file
+	// Calculate MD5 hash of the assembled file, the SHA-256 is for Repr-Digest headers
 	tempFile.Seek(0, 0) // Go back to the start of the file
 	hash := md5.New()
-	if _, err := io.Copy(hash, tempFile); err != nil {
+	sha := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(hash, sha), tempFile); err != nil {
 		c.String(500, "Failed to calculate MD5 hash")
 		return
 	}
@@ -160,6 +183,10 @@ func finalizeUpload(c *gin.Context) {
 		return
 	}
 	fileSize := fileInfo.Size()
+	if err := accounts.CheckStorageQuota(accountToken, fileSize); err != nil {
+		c.String(413, err.Error())
+		return
+	}
 
 	// Rename the temp file to its final name
 	finalFilePath := filepath.Join(finalDestDir, md5sum+filepath.Ext(originalFileName))
@@ -178,6 +205,7 @@ func finalizeUpload(c *gin.Context) {
 		FileSize:         fileSize,
 		Timestamp:        time.Now().Unix(),
 		Md5sum:           md5sum + filepath.Ext(originalFileName),
+		Sha256:           hex.EncodeToString(sha.Sum(nil)),
 	}
 
 	if err := fileData.Insert(); err != nil {
@@ -188,12 +216,7 @@ func finalizeUpload(c *gin.Context) {
 
 	// If a collection ID is provided, add the file to the collection
 	if collectionID != "" {
-		addReq := socketHandler.AddFileToCollectionRequest{
-			CollectionID:  collectionID,
-			FileDirectory: fileData.FileDirectory,
-			Auth:          socketHandler.AuthInfo{Token: accountToken},
-		}
-		if _, err := socketHandler.AddFileToCollection(addReq); err != nil {
+		if _, err := socketHandler.AddUploadedFile(accountToken, collectionID, fileData.FileDirectory); err != nil {
 			// Log this error, but don't fail the entire upload.
 			// The file is uploaded, just not added to the collection.
 			fmt.Printf("Warning: Failed to add file %s to collection %s: %v\n", fileData.FileDirectory, collectionID, err)
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"angadrive/vars"
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNotConfigured = errors.New("mail is not set up on this server")
+
+func Enabled() bool {
+	return vars.SMTPHost != ""
+}
+
+// Send delivers a plain text mail. STARTTLS is used whenever the server offers it.
+func Send(to string, subject string, body string) error {
+	if !Enabled() {
+		return ErrNotConfigured
+	}
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient")
+	}
+	var auth smtp.Auth
+	if vars.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", vars.SMTPUsername, vars.SMTPPassword, vars.SMTPHost)
+	}
+	message := "From: " + vars.SMTPFrom + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+	// SMTP_FROM may carry a display name, the envelope only takes the address
+	envelopeFrom := vars.SMTPFrom
+	if parsed, err := mail.ParseAddress(vars.SMTPFrom); err == nil {
+		envelopeFrom = parsed.Address
+	}
+	addr := vars.SMTPHost + ":" + strconv.Itoa(vars.SMTPPort)
+	return smtp.SendMail(addr, auth, envelopeFrom, []string{to}, []byte(message))
+}
@@ -5,6 +5,7 @@ import (
 	"angadrive/endpoints"
 	"angadrive/info"
 	"angadrive/socketHandler"
+	"angadrive/vars"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +16,11 @@ func main() {
 	UPLOAD_DIR := "uploaded_files"
 
 	r := gin.Default()
+	// ClientIP is what failed logins are counted against, a forwarded
+	// header is only believed from the configured proxies
+	if err := r.SetTrustedProxies(vars.TrustedProxies); err != nil {
+		panic(err)
+	}
 	// FOR DEVELOPMENT ONLY
 	if gin.Mode() != gin.ReleaseMode {
 		// TURN OFF CORS FOR DEVELOPMENT
@@ -0,0 +1,170 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+	"angadrive/database"
+	"angadrive/vars"
+	"fmt"
+	"time"
+)
+
+const maxAdminPageSize = 200
+
+// requireAdmin returns the admin auth belongs to, everyone else is refused.
+func requireAdmin(auth AuthInfo) (database.Account, error) {
+	account, err := requestAccount(auth)
+	if err != nil {
+		return database.Account{}, err
+	}
+	if !account.Admin {
+		return database.Account{}, fmt.Errorf("only admins can do this")
+	}
+	return account, nil
+}
+
+// logAdminAction leaves a trace of what admins did to other people's data.
+func logAdminAction(admin database.Account, format string, args ...any) {
+	timestamp := time.Now().Format("03:04:05 PM, 02 Jan 2006")
+	fmt.Printf("[%s] Admin %s %s\n", timestamp, admin.Email, fmt.Sprintf(format, args...))
+}
+
+func adminUserInfo(account database.Account) AdminUserInfo {
+	info := AdminUserInfo{
+		Email:         account.Email,
+		DisplayName:   account.DisplayName,
+		EmailVerified: account.EmailVerified,
+		TOTPEnabled:   account.TOTPEnabled,
+		Admin:         account.Admin,
+		Disabled:      account.Disabled,
+		DeleteAt:      account.DeleteAt,
+		StorageQuota:  account.StorageQuota,
+		QuotaBytes:    accounts.StorageQuota(account.Token),
+	}
+	files, used, err := database.GetStorageUsed(account.Token)
+	if err != nil {
+		fmt.Printf("Warning: Failed to get storage used by %s: %v\n", account.Email, err)
+	}
+	info.Files, info.StorageUsed = files, used
+	if collections, err := account.GetCollections(); err == nil {
+		info.Collections = len(collections)
+	}
+	return info
+}
+
+func AdminListUsers(req AdminListUsersRequest) (AdminUserList, error) {
+	if _, err := requireAdmin(req.Auth); err != nil {
+		return AdminUserList{}, err
+	}
+	if req.Limit <= 0 || req.Limit > maxAdminPageSize {
+		req.Limit = maxAdminPageSize
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+	found, total, err := database.SearchAccounts(req.Query, req.Offset, req.Limit)
+	if err != nil {
+		return AdminUserList{}, fmt.Errorf("failed to search accounts: %v", err)
+	}
+	list := AdminUserList{Users: []AdminUserInfo{}, Total: total}
+	for _, account := range found {
+		list.Users = append(list.Users, adminUserInfo(account))
+	}
+	return list, nil
+}
+
+func AdminSetDisabled(req AdminSetDisabledRequest) (string, error) {
+	admin, err := requireAdmin(req.Auth)
+	if err != nil {
+		return "", err
+	}
+	if req.Email == admin.Email {
+		return "", fmt.Errorf("admins can't disable themselves")
+	}
+	account, err := database.FindUserByEmail(req.Email)
+	if err != nil {
+		return "", fmt.Errorf("account not found")
+	}
+	sessions, err := accounts.SetAccountDisabled(account, req.Disabled)
+	if err != nil {
+		return "", err
+	}
+	if !req.Disabled {
+		logAdminAction(admin, "enabled %s", account.Email)
+		return "Account enabled", nil
+	}
+	logAdminAction(admin, "disabled %s", account.Email)
+	for _, session := range sessions {
+		go logoutSession(session.ID, account.Email)
+	}
+	go logoutUser(account.Email)
+	return "Account disabled", nil
+}
+
+func AdminSetQuota(req AdminSetQuotaRequest) (string, error) {
+	admin, err := requireAdmin(req.Auth)
+	if err != nil {
+		return "", err
+	}
+	if req.Quota < accounts.UnlimitedStorageQuota {
+		return "", fmt.Errorf("quota must be a number of bytes, 0 for the default or -1 for no limit")
+	}
+	account, err := database.FindUserByEmail(req.Email)
+	if err != nil {
+		return "", fmt.Errorf("account not found")
+	}
+	if _, err := account.SetStorageQuota(req.Quota); err != nil {
+		return "", fmt.Errorf("failed to set quota: %v", err)
+	}
+	logAdminAction(admin, "set the storage quota of %s to %d", account.Email, req.Quota)
+	return "Storage quota updated", nil
+}
+
+func AdminDeleteFile(req AdminDeleteFileRequest) (string, error) {
+	admin, err := requireAdmin(req.Auth)
+	if err != nil {
+		return "", err
+	}
+	file, err := database.GetFile(req.FileDirectory)
+	if err != nil {
+		return "", fmt.Errorf("file not found: %v", err)
+	}
+	if err := database.DeleteFile(file, PulseCollectionSubscribers); err != nil {
+		return "", fmt.Errorf("error deleting file: %v", err)
+	}
+	logAdminAction(admin, "deleted file %s", file.FileDirectory)
+	go RemoveFile(file.Md5sum)
+	go UserFilesPulse(FileUpdate{Toggle: false, File: file})
+	go UpdateUserCount()
+	return "File deleted", nil
+}
+
+func AdminDeleteCollection(req AdminDeleteCollectionRequest) (string, error) {
+	admin, err := requireAdmin(req.Auth)
+	if err != nil {
+		return "", err
+	}
+	collection, err := database.GetCollection(req.CollectionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get collection: %v", err)
+	}
+	if err := collection.Delete(); err != nil {
+		return "", fmt.Errorf("failed to delete collection: %v", err)
+	}
+	logAdminAction(admin, "deleted collection %s", collection.ID)
+	go CollectionPulse(false, collection)
+	return "Collection deleted", nil
+}
+
+func AdminGetStats(req AdminRequest) (AdminStats, error) {
+	if _, err := requireAdmin(req.Auth); err != nil {
+		return AdminStats{}, err
+	}
+	stats, err := database.GetSystemStats()
+	if err != nil {
+		return AdminStats{}, fmt.Errorf("failed to get stats: %v", err)
+	}
+	ActiveWebsocketsMutex.RLock()
+	connections := len(ActiveWebsockets)
+	ActiveWebsocketsMutex.RUnlock()
+	return AdminStats{SystemStats: stats, Connections: connections, DefaultStorageQuota: vars.DefaultStorageQuota}, nil
+}
@@ -0,0 +1,49 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+	"angadrive/database"
+	"testing"
+)
+
+func TestAdminSetQuota(t *testing.T) {
+	admin, session := setupAuth(t)
+	admin.Admin = true
+	if err := admin.Update(admin); err != nil {
+		t.Fatal(err)
+	}
+	// Update refreshes the cache in the background
+	database.UserAccountsByTokenMutex.Lock()
+	database.UserAccountsByToken[admin.Token] = admin
+	database.UserAccountsByTokenMutex.Unlock()
+	target := database.Account{Token: accounts.GenToken(), Email: "user@example.com"}
+	if err := target.Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		quota int64
+		ok    bool
+	}{
+		{"bytes", 1024 * 1024, true},
+		{"default", 0, true},
+		{"no limit", accounts.UnlimitedStorageQuota, true},
+		{"below -1", -2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := AdminSetQuota(AdminSetQuotaRequest{Email: target.Email, Quota: tt.quota, Auth: AuthInfo{Token: session}})
+			if (err == nil) != tt.ok {
+				t.Fatalf("got %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			stored, _ := database.FindUserByEmail(target.Email)
+			if stored.StorageQuota != tt.quota {
+				t.Errorf("stored quota = %d, want %d", stored.StorageQuota, tt.quota)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+)
+
+// API keys are managed with a login, a key can't mint or revoke keys.
+
+func CreateAPIKey(req CreateAPIKeyRequest) (accounts.NewAPIKey, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return accounts.NewAPIKey{}, err
+	}
+	return accounts.CreateAPIKey(account.Token, req.Name, req.Scopes, req.Collections, req.ExpiresAt)
+}
+
+func ListAPIKeys(req ListAPIKeysRequest) ([]accounts.APIKeyInfo, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return accounts.ListAPIKeys(account.Token)
+}
+
+func RevokeAPIKey(req RevokeAPIKeyRequest) (string, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return "", err
+	}
+	if err := accounts.RevokeAPIKey(account.Token, req.ID); err != nil {
+		return "", err
+	}
+	return "API key revoked", nil
+}
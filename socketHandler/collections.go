@@ -9,7 +9,7 @@ import (
 )
 
 func CreateNewCollection(req CreateCollectionRequest) (string, error) {
-	userToken, err := req.Auth.GetToken()
+	userToken, err := req.Auth.GetTokenFor(accounts.ScopeManageCollections)
 	if err != nil {
 		return "", fmt.Errorf("authentication failed: %v", err)
 	}
@@ -25,7 +25,7 @@ func CreateNewCollection(req CreateCollectionRequest) (string, error) {
 }
 
 func DeleteCollection(req DeleteCollectionRequest) (string, error) {
-	userToken, err := req.Auth.GetToken()
+	userToken, err := req.Auth.GetTokenFor(accounts.ScopeManageCollections, req.CollectionID)
 	if err != nil {
 		return "", fmt.Errorf("authentication failed: %v", err)
 	}
@@ -45,7 +45,7 @@ func DeleteCollection(req DeleteCollectionRequest) (string, error) {
 }
 
 func GetUserCollections(req AuthInfo) ([]CollectionCardData, error) {
-	token, err := req.GetToken()
+	token, err := req.GetTokenFor(accounts.ScopeReadFiles)
 	if err != nil {
 		return nil, fmt.Errorf("authentication failed: %v", err)
 	}
@@ -132,7 +132,7 @@ func GetCollection(req GetCollectionRequest) (GetCollectionResponse, error) {
 	if err != nil {
 		return resp, fmt.Errorf("failed to get collection: %v", err)
 	}
-	req.Auth.Token, err = req.Auth.GetToken()
+	req.Auth.Token, err = req.Auth.GetTokenFor(accounts.ScopeReadFiles, req.CollectionID)
 	if err != nil {
 		return resp, fmt.Errorf("authentication failed: %v", err)
 	}
@@ -140,7 +140,7 @@ func GetCollection(req GetCollectionRequest) (GetCollectionResponse, error) {
 }
 
 func updateCollectionFolders(collectionID, folderID string, auth AuthInfo, add bool) (GetCollectionResponse, error) {
-	token, err := auth.GetToken()
+	token, err := auth.GetTokenFor(accounts.ScopeManageCollections, collectionID, folderID)
 	if err != nil {
 		return GetCollectionResponse{}, fmt.Errorf("authentication failed: %v", err)
 	}
@@ -173,7 +173,7 @@ func RemoveFolder(req RemoveFolderFromCollectionRequest) (GetCollectionResponse,
 }
 
 func CreateFolderInCollection(req CreateFolderInCollectionRequest) (GetCollectionResponse, error) {
-	token, err := req.Auth.GetToken()
+	token, err := req.Auth.GetTokenFor(accounts.ScopeManageCollections, req.CollectionID)
 	if err != nil {
 		return GetCollectionResponse{}, fmt.Errorf("authentication failed: %v", err)
 	}
@@ -201,10 +201,20 @@ func CreateFolderInCollection(req CreateFolderInCollectionRequest) (GetCollectio
 }
 
 func updateCollectionFiles(collectionID, fileDirectory string, auth AuthInfo, add bool) (GetCollectionResponse, error) {
-	token, err := auth.GetToken()
+	token, err := auth.GetTokenFor(accounts.ScopeManageCollections, collectionID)
 	if err != nil {
 		return GetCollectionResponse{}, fmt.Errorf("authentication failed: %v", err)
 	}
+	return updateCollectionFilesAs(token, collectionID, fileDirectory, add)
+}
+
+// AddUploadedFile puts a file that was just uploaded into a collection, for
+// the upload route which has already authenticated accountToken.
+func AddUploadedFile(accountToken, collectionID, fileDirectory string) (GetCollectionResponse, error) {
+	return updateCollectionFilesAs(accountToken, collectionID, fileDirectory, true)
+}
+
+func updateCollectionFilesAs(token, collectionID, fileDirectory string, add bool) (GetCollectionResponse, error) {
 	collection, err := database.GetCollection(collectionID)
 	if err != nil {
 		return GetCollectionResponse{}, fmt.Errorf("failed to get collection: %v", err)
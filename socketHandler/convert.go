@@ -211,11 +211,9 @@ func performConversion(inputFile database.FileData) {
 
 func HandleConversionRequest(req ConvertVideoRequest) (string, error) {
 	var err error
-	if req.Auth.Token == "" {
-		req.Auth.Token, err = req.Auth.GetToken()
-		if err != nil {
-			return "", fmt.Errorf("failed to get token: %v", err)
-		}
+	req.Auth.Token, err = req.Auth.GetToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to get token: %v", err)
 	}
 	fileToConvert, err := database.GetFile(req.FileDirectory)
 	if err != nil {
@@ -0,0 +1,16 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+)
+
+func RequestEmailVerification(req EmailVerificationRequest) (string, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return "", err
+	}
+	if err := accounts.SendVerificationEmail(account); err != nil {
+		return "", err
+	}
+	return "Verification mail sent to " + account.Email, nil
+}
@@ -0,0 +1,449 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+	"angadrive/database"
+	"angadrive/vars"
+	"archive/zip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exports can be downloaded for this long after they're done
+const exportLifetime = 24 * time.Hour
+
+// progress is pushed at most this often, every file would flood the socket
+const exportProgressInterval = time.Second
+
+const maxConcurrentExports = 2
+
+const (
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// ExportStatus is what the owner of an export is told about it.
+type ExportStatus struct {
+	Status      string `json:"status"` // empty if there's no export
+	Done        int    `json:"done"`   // files written so far
+	Total       int    `json:"total"`  // files to write
+	DownloadURL string `json:"download_url,omitempty"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type exportJob struct {
+	ExportStatus
+	id           string // also the secret in the download link
+	accountToken string
+	path         string
+	created      time.Time
+}
+
+var (
+	// every account has at most one export, running or ready
+	exportJobs      = make(map[string]*exportJob)
+	exportJobsByID  = make(map[string]*exportJob)
+	exportJobsMutex sync.Mutex
+
+	exportLimiter = make(chan struct{}, maxConcurrentExports)
+)
+
+func exportDir() string {
+	return filepath.Join(UPLOAD_DIR, "exports")
+}
+
+// initExports throws away exports from before a restart, their links died
+// with the jobs that knew about them.
+func initExports() {
+	os.RemoveAll(exportDir())
+	os.MkdirAll(exportDir(), os.ModePerm)
+}
+
+// ExportFile returns the archive a download link points to, and the name
+// it's downloaded as.
+func ExportFile(id string) (string, string, bool) {
+	exportJobsMutex.Lock()
+	defer exportJobsMutex.Unlock()
+	job, ok := exportJobsByID[id]
+	if !ok || job.Status != ExportReady {
+		return "", "", false
+	}
+	return job.path, "angadrive-export-" + job.created.Format("2006-01-02") + ".zip", true
+}
+
+// RequestExport starts packaging everything the account owns, the owner is
+// notified as it progresses. A previous export is replaced.
+func RequestExport(req ExportRequest) (string, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return "", err
+	}
+	idBytes := make([]byte, 24)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", fmt.Errorf("failed to start export: %v", err)
+	}
+	job := &exportJob{
+		ExportStatus: ExportStatus{Status: ExportRunning},
+		id:           hex.EncodeToString(idBytes),
+		accountToken: account.Token,
+		created:      time.Now(),
+	}
+	job.path = filepath.Join(exportDir(), job.id+".zip")
+
+	exportJobsMutex.Lock()
+	if previous, ok := exportJobs[account.Token]; ok {
+		if previous.Status == ExportRunning {
+			exportJobsMutex.Unlock()
+			return "", fmt.Errorf("an export is already running")
+		}
+		removeExportLocked(previous)
+	}
+	exportJobs[account.Token] = job
+	exportJobsByID[job.id] = job
+	exportJobsMutex.Unlock()
+
+	go runExport(job, account)
+	return "Export started, you'll be notified when it's ready", nil
+}
+
+func GetExportStatus(req ExportRequest) (ExportStatus, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return ExportStatus{}, err
+	}
+	exportJobsMutex.Lock()
+	defer exportJobsMutex.Unlock()
+	// no status at all for accounts that never exported, asking isn't an error
+	if job, ok := exportJobs[account.Token]; ok {
+		return job.ExportStatus, nil
+	}
+	return ExportStatus{}, nil
+}
+
+// dropExport throws away the export of an account that's going away.
+func dropExport(accountToken string) {
+	exportJobsMutex.Lock()
+	defer exportJobsMutex.Unlock()
+	if job, ok := exportJobs[accountToken]; ok && job.Status != ExportRunning {
+		removeExportLocked(job)
+	}
+}
+
+func removeExportLocked(job *exportJob) {
+	os.Remove(job.path)
+	if exportJobs[job.accountToken] == job {
+		delete(exportJobs, job.accountToken)
+	}
+	delete(exportJobsByID, job.id)
+}
+
+func updateExport(job *exportJob, update func(status *ExportStatus)) ExportStatus {
+	exportJobsMutex.Lock()
+	defer exportJobsMutex.Unlock()
+	update(&job.ExportStatus)
+	return job.ExportStatus
+}
+
+// pulseExport pushes progress to every connection of the owner. The link is
+// left out, pulses reach connections the owner authenticated with any token,
+// it's only handed out to export_status requests.
+func pulseExport(job *exportJob, status ExportStatus) {
+	status.DownloadURL = ""
+	genericUserPulse(job.accountToken, map[string]interface{}{
+		"type": "export_progress",
+		"data": status,
+	})
+}
+
+func runExport(job *exportJob, account database.Account) {
+	exportLimiter <- struct{}{}
+	defer func() { <-exportLimiter }()
+
+	err := writeExport(job, account)
+	if err != nil {
+		os.Remove(job.path)
+		fmt.Printf("Warning: Export for %s failed: %v\n", account.Email, err)
+		status := updateExport(job, func(status *ExportStatus) {
+			status.Status = ExportFailed
+			status.Error = err.Error()
+		})
+		pulseExport(job, status)
+		genericUserPulse(job.accountToken, map[string]interface{}{
+			"type": "notification",
+			"data": "Export failed: " + err.Error(),
+		})
+		return
+	}
+	status := updateExport(job, func(status *ExportStatus) {
+		status.Status = ExportReady
+		status.DownloadURL = vars.AssetsLink("/export/" + job.id)
+		status.ExpiresAt = time.Now().Add(exportLifetime).Unix()
+	})
+	time.AfterFunc(exportLifetime, func() {
+		exportJobsMutex.Lock()
+		defer exportJobsMutex.Unlock()
+		removeExportLocked(job)
+	})
+	pulseExport(job, status)
+	genericUserPulse(job.accountToken, map[string]interface{}{
+		"type": "notification",
+		"data": "Your export is ready to download",
+	})
+}
+
+type exportManifest struct {
+	ExportedAt  int64                 `json:"exported_at"`
+	Account     exportAccount         `json:"account"`
+	Files       []exportFile          `json:"files"`
+	Collections []exportCollection    `json:"collections"`
+	Sessions    []database.Session    `json:"sessions"`
+	APIKeys     []accounts.APIKeyInfo `json:"api_keys"`
+}
+
+type exportAccount struct {
+	Email         string `json:"email"`
+	DisplayName   string `json:"display_name"`
+	EmailVerified bool   `json:"email_verified"`
+	TOTPEnabled   bool   `json:"totp_enabled"`
+	StripMetadata bool   `json:"strip_metadata"`
+}
+
+type exportFile struct {
+	FileDirectory    string   `json:"file_directory"`
+	OriginalFileName string   `json:"original_file_name"`
+	Size             int64    `json:"size"`
+	Timestamp        int64    `json:"timestamp"`
+	Sha256           string   `json:"sha256,omitempty"`
+	StripMetadata    bool     `json:"strip_metadata"`
+	Title            string   `json:"title,omitempty"`
+	Artist           string   `json:"artist,omitempty"`
+	Album            string   `json:"album,omitempty"`
+	Duration         float64  `json:"duration,omitempty"`
+	Link             string   `json:"link"`
+	Path             string   `json:"path"`    // where the file is in the archive
+	AlsoIn           []string `json:"also_in"` // where else it belongs, it's only stored once
+}
+
+type exportCollection struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Timestamp int64    `json:"timestamp"`
+	Size      int      `json:"size"`
+	Editors   int      `json:"editors"`
+	Files     []string `json:"files"`   // file_directory of every file, including other editors'
+	Folders   []string `json:"folders"` // IDs of the collections inside it
+	Path      string   `json:"path"`    // its directory in the archive, collections in several are only in the first
+	Link      string   `json:"link"`
+}
+
+// exportLayout decides where files go in the archive, mirroring the
+// collections they're in. Names are made unique per directory. Every
+// collection gets one directory, however many others it's in, so shared
+// folders don't multiply the walk or the archive.
+type exportLayout struct {
+	owned   map[string]database.FileData
+	paths   map[string][]string
+	used    map[string]bool
+	visited map[string]string // collection ID -> its directory
+}
+
+func exportName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+func (layout *exportLayout) unique(dir string, name string) string {
+	name = exportName(name)
+	candidate := path.Join(dir, name)
+	ext := path.Ext(name)
+	for i := 2; layout.used[candidate]; i++ {
+		candidate = path.Join(dir, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext))
+	}
+	layout.used[candidate] = true
+	return candidate
+}
+
+func (layout *exportLayout) walk(collection database.Collection, dir string) {
+	layout.visited[collection.ID] = dir
+	for _, fileDirectory := range collection.GetFiles() {
+		if file, ok := layout.owned[fileDirectory]; ok {
+			layout.paths[fileDirectory] = append(layout.paths[fileDirectory], layout.unique(dir, file.OriginalFileName))
+		}
+	}
+	for _, folderID := range collection.GetCollections() {
+		if _, ok := layout.visited[folderID]; ok {
+			continue
+		}
+		folder, err := database.GetCollection(folderID)
+		if err != nil {
+			continue
+		}
+		layout.walk(folder, layout.unique(dir, folder.Name))
+	}
+}
+
+func writeExport(job *exportJob, account database.Account) error {
+	files, err := database.GetUserFiles(account.Token)
+	if err != nil {
+		return fmt.Errorf("failed to get files: %v", err)
+	}
+	allCollections, err := account.GetCollections()
+	if err != nil {
+		return fmt.Errorf("failed to get collections: %v", err)
+	}
+	var collections []database.Collection
+	folderIDs := make(map[string]bool)
+	for _, collection := range allCollections {
+		if collection.IsEditor(account.Token) {
+			collections = append(collections, collection)
+			for _, folderID := range collection.GetCollections() {
+				folderIDs[folderID] = true
+			}
+		}
+	}
+
+	layout := exportLayout{
+		owned:   make(map[string]database.FileData),
+		paths:   make(map[string][]string),
+		used:    make(map[string]bool),
+		visited: make(map[string]string),
+	}
+	for _, file := range files {
+		layout.owned[file.FileDirectory] = file
+	}
+	// top level collections first, then whatever only nests in itself
+	for _, onlyTopLevel := range []bool{true, false} {
+		for _, collection := range collections {
+			if _, ok := layout.visited[collection.ID]; ok || (onlyTopLevel && folderIDs[collection.ID]) {
+				continue
+			}
+			layout.walk(collection, layout.unique("collections", collection.Name))
+		}
+	}
+	for _, file := range files {
+		if len(layout.paths[file.FileDirectory]) == 0 {
+			layout.paths[file.FileDirectory] = []string{layout.unique("unsorted", file.OriginalFileName)}
+		}
+	}
+
+	manifest := exportManifest{
+		ExportedAt: time.Now().Unix(),
+		Account: exportAccount{
+			Email:         account.Email,
+			DisplayName:   account.DisplayName,
+			EmailVerified: account.EmailVerified,
+			TOTPEnabled:   account.TOTPEnabled,
+			StripMetadata: account.StripMetadata,
+		},
+		Files:       []exportFile{},
+		Collections: []exportCollection{},
+	}
+	for _, file := range files {
+		paths := layout.paths[file.FileDirectory]
+		manifest.Files = append(manifest.Files, exportFile{
+			FileDirectory:    file.FileDirectory,
+			OriginalFileName: file.OriginalFileName,
+			Size:             file.FileSize,
+			Timestamp:        file.Timestamp,
+			Sha256:           file.Sha256,
+			StripMetadata:    file.StripMetadata,
+			Title:            file.Title,
+			Artist:           file.Artist,
+			Album:            file.Album,
+			Duration:         file.Duration,
+			Link:             vars.AssetsLink("/i/" + file.FileDirectory),
+			Path:             paths[0],
+			AlsoIn:           paths[1:],
+		})
+	}
+	for _, collection := range collections {
+		manifest.Collections = append(manifest.Collections, exportCollection{
+			ID:        collection.ID,
+			Name:      collection.Name,
+			Timestamp: collection.Timestamp,
+			Size:      collection.Size,
+			Editors:   len(collection.GetEditors()),
+			Files:     collection.GetFiles(),
+			Folders:   collection.GetCollections(),
+			Path:      layout.visited[collection.ID],
+			Link:      vars.WebLink("/collection/" + collection.ID),
+		})
+	}
+	if manifest.Sessions, err = database.GetAccountSessions(account.Token); err != nil {
+		return fmt.Errorf("failed to get sessions: %v", err)
+	}
+	if manifest.APIKeys, err = accounts.ListAPIKeys(account.Token); err != nil {
+		return err
+	}
+	pulseExport(job, updateExport(job, func(status *ExportStatus) { status.Total = len(files) }))
+
+	out, err := os.Create(job.path)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %v", err)
+	}
+	defer out.Close()
+	archive := zip.NewWriter(out)
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %v", err)
+	}
+	entry, err := archive.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write(raw); err != nil {
+		return err
+	}
+
+	done := 0
+	lastPulse := time.Now()
+	for _, file := range files {
+		if err := addExportFile(archive, layout.paths[file.FileDirectory][0], file); err != nil {
+			return fmt.Errorf("failed to add %s: %v", file.OriginalFileName, err)
+		}
+		done++
+		if time.Since(lastPulse) >= exportProgressInterval {
+			lastPulse = time.Now()
+			pulseExport(job, updateExport(job, func(status *ExportStatus) { status.Done = done }))
+		}
+	}
+	updateExport(job, func(status *ExportStatus) { status.Done = done })
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %v", err)
+	}
+	return out.Close()
+}
+
+// addExportFile stores the original upload, most files are already
+// compressed so deflating them again would only cost time.
+func addExportFile(archive *zip.Writer, archivePath string, file database.FileData) error {
+	blob, err := os.Open(filepath.Join(UPLOAD_DIR, "i", file.Md5sum))
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     archivePath,
+		Method:   zip.Store,
+		Modified: time.Unix(file.Timestamp, 0),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, blob)
+	return err
+}
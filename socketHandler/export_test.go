@@ -0,0 +1,96 @@
+package socketHandler
+
+import (
+	"angadrive/database"
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportStoresSharedContentOnce(t *testing.T) {
+	account, _ := setupAuth(t)
+	UPLOAD_DIR = t.TempDir()
+	os.MkdirAll(filepath.Join(UPLOAD_DIR, "i"), os.ModePerm)
+
+	// levels of two collections that both hold both collections of the next
+	// level, every path down doubles with each level
+	const levels = 24
+	var previous []*database.Collection
+	var top []*database.Collection
+	for level := 0; level < levels; level++ {
+		current := []*database.Collection{}
+		for _, side := range []string{"a", "b"} {
+			collection := &database.Collection{Name: fmt.Sprint(side, level), Editors: account.Token}
+			if err := collection.Insert(); err != nil {
+				t.Fatal(err)
+			}
+			current = append(current, collection)
+		}
+		for _, parent := range previous {
+			for _, child := range current {
+				if err := parent.AddFolder(child.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if top == nil {
+			top = current
+		}
+		previous = current
+	}
+	file := database.FileData{OriginalFileName: "deep.txt", FileDirectory: "deep.txt", AccountToken: account.Token, Md5sum: "deep", FileSize: 4}
+	if err := os.WriteFile(filepath.Join(UPLOAD_DIR, "i", file.Md5sum), []byte("deep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	for _, collection := range previous {
+		if err := collection.AddFile(file.FileDirectory); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a cycle back to the top doesn't trip the walk either
+	if err := previous[0].AddFolder(top[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	job := &exportJob{accountToken: account.Token, path: filepath.Join(UPLOAD_DIR, "export.zip")}
+	if err := writeExport(job, account); err != nil {
+		t.Fatalf("writeExport: %v", err)
+	}
+	archive, err := zip.OpenReader(job.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	if len(archive.File) != 2 {
+		t.Fatalf("archive has %d entries, want the manifest and one file", len(archive.File))
+	}
+
+	manifestFile, err := archive.Open("manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manifestFile.Close()
+	var manifest exportManifest
+	if err := json.NewDecoder(manifestFile).Decode(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 1 || len(manifest.Collections) != 2*levels {
+		t.Fatalf("manifest has %d files and %d collections", len(manifest.Files), len(manifest.Collections))
+	}
+	// once in each of the two collections of the last level
+	exported := manifest.Files[0]
+	if exported.Path != archive.File[1].Name || len(exported.AlsoIn) != 1 {
+		t.Errorf("file is at %q, also in %v; archive holds %q", exported.Path, exported.AlsoIn, archive.File[1].Name)
+	}
+	for _, collection := range manifest.Collections {
+		if collection.Path == "" {
+			t.Errorf("collection %s has no directory", collection.Name)
+		}
+	}
+}
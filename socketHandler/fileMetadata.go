@@ -0,0 +1,140 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+	"angadrive/database"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jdeng/goheif"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func readExif(file database.FileData) (*exif.Exif, error) {
+	f, err := os.Open(UPLOAD_DIR + string(os.PathSeparator) + "i" + string(os.PathSeparator) + file.Md5sum)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ext := strings.ToLower(filepath.Ext(file.Md5sum))
+	if ext == ".heic" || ext == ".heif" {
+		raw, err := goheif.ExtractExif(f)
+		if err != nil {
+			return nil, err
+		}
+		return exif.Decode(bytes.NewReader(raw))
+	}
+	return exif.Decode(f)
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
+func exifInt(x *exif.Exif, name exif.FieldName) int {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+	value, err := tag.Int(0)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func exifFloat(x *exif.Exif, name exif.FieldName) float64 {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+	numerator, denominator, err := tag.Rat2(0)
+	if err != nil || denominator == 0 {
+		return 0
+	}
+	return float64(numerator) / float64(denominator)
+}
+
+func GetFileMetadata(req GetFileMetadataRequest) (ImageMetadata, error) {
+	var metadata ImageMetadata
+	token, err := req.Auth.GetTokenForFile(accounts.ScopeReadFiles, req.FileDirectory)
+	if err != nil {
+		return metadata, fmt.Errorf("authentication failed: %v", err)
+	}
+	file, err := database.GetFile(req.FileDirectory)
+	if err != nil {
+		return metadata, fmt.Errorf("file not found: %v", err)
+	}
+	if file.AccountToken != token {
+		return metadata, fmt.Errorf("file %s does not belong to this account", file.FileDirectory)
+	}
+	owner, _ := database.FindUserByToken(token)
+	metadata.StripMetadata = file.StripMetadata || owner.StripMetadata
+
+	x, err := readExif(file)
+	if err != nil {
+		// most files simply have no EXIF, that isn't an error for the details panel
+		return metadata, nil
+	}
+	metadata.HasExif = true
+	metadata.CameraMake = exifString(x, exif.Make)
+	metadata.CameraModel = exifString(x, exif.Model)
+	metadata.LensModel = exifString(x, exif.LensModel)
+	if takenAt, err := x.DateTime(); err == nil {
+		metadata.TakenAt = takenAt.Unix()
+	}
+	if tag, err := x.Get(exif.ExposureTime); err == nil {
+		if numerator, denominator, err := tag.Rat2(0); err == nil && denominator != 0 {
+			metadata.ExposureTime = fmt.Sprintf("%d/%d", numerator, denominator)
+		}
+	}
+	metadata.FNumber = exifFloat(x, exif.FNumber)
+	metadata.ISO = exifInt(x, exif.ISOSpeedRatings)
+	metadata.FocalLength = exifFloat(x, exif.FocalLength)
+	metadata.Width = exifInt(x, exif.PixelXDimension)
+	metadata.Height = exifInt(x, exif.PixelYDimension)
+	metadata.Orientation = exifInt(x, exif.Orientation)
+	if latitude, longitude, err := x.LatLong(); err == nil {
+		metadata.Latitude = &latitude
+		metadata.Longitude = &longitude
+	}
+	return metadata, nil
+}
+
+func SetFileMetadataStripping(req SetFileMetadataStrippingRequest) (database.FileData, error) {
+	token, err := req.Auth.GetToken()
+	if err != nil {
+		return database.FileData{}, fmt.Errorf("authentication failed: %v", err)
+	}
+	file, err := database.GetFile(req.FileDirectory)
+	if err != nil {
+		return database.FileData{}, fmt.Errorf("file not found: %v", err)
+	}
+	if file.AccountToken != token {
+		return database.FileData{}, fmt.Errorf("file %s does not belong to this account", file.FileDirectory)
+	}
+	return file.SetStripMetadata(req.Strip)
+}
+
+func SetAccountMetadataStripping(req SetAccountMetadataStrippingRequest) (database.Account, error) {
+	token, err := req.Auth.GetToken()
+	if err != nil {
+		return database.Account{}, fmt.Errorf("authentication failed: %v", err)
+	}
+	account, err := database.FindUserByToken(token)
+	if err != nil {
+		return database.Account{}, fmt.Errorf("account not found: %v", err)
+	}
+	return account.SetStripMetadata(req.Strip)
+}
@@ -12,14 +12,14 @@ func GetUserFiles(req AuthInfo) ([]database.FileData, error) {
 		return nil, errors.New("missing authentication credentials")
 	}
 
-	if req.Token == "" {
-		if !accounts.Authenticate(req.Email, req.Password) {
-			return nil, errors.New("invalid email or password")
-		}
-		userInfo, _ := database.FindUserByEmail(req.Email)
-		req.Token = userInfo.Token
+	token, err := req.GetTokenFor(accounts.ScopeReadFiles)
+	if errors.Is(err, accounts.ErrInvalidCredentials) {
+		return nil, errors.New("invalid email or password")
 	}
-	files, err := database.GetUserFiles(req.Token)
+	if err != nil {
+		return nil, err
+	}
+	files, err := database.GetUserFiles(token)
 	if err != nil {
 		return nil, errors.New("failed to retrieve files")
 	}
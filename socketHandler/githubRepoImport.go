@@ -1,6 +1,7 @@
 package socketHandler
 
 import (
+	"angadrive/accounts"
 	"angadrive/database"
 	"crypto/md5"
 	"encoding/json"
@@ -89,6 +90,9 @@ func GithubImportHandler(req ImportGithubRepoRequest) (string, error) {
 	if repoDetails.Size > 2621440 {
 		return "", errors.New("repository size exceeds the 2.5GB limit")
 	}
+	if err := accounts.CheckStorageQuota(userToken, int64(repoDetails.Size)*1024); err != nil {
+		return "", err
+	}
 
 	genericUserPulse(userToken, map[string]interface{}{
 		"type": "notification",
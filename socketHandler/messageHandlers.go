@@ -34,6 +34,10 @@ func processRequest[T any, R any](conn *websocket.Conn, data json.RawMessage, ha
 		})
 		return
 	}
+	// failed logins are counted per client IP as well as per account
+	if r, ok := any(&req).(interface{ SetSource(string) }); ok {
+		r.SetSource(connRemoteIP(conn))
+	}
 
 	responseInfo, err := handler(req)
 	if err != nil {
@@ -69,6 +73,12 @@ func processRequest[T any, R any](conn *websocket.Conn, data json.RawMessage, ha
 	})
 }
 
+func connRemoteIP(conn *websocket.Conn) string {
+	ActiveWebsocketsMutex.RLock()
+	defer ActiveWebsocketsMutex.RUnlock()
+	return ActiveWebsockets[conn].RemoteIP
+}
+
 // sendJSON safely sends a JSON message to a websocket connection.
 func sendJSON(conn *websocket.Conn, v interface{}) {
 	// Safely read the connection data; the conn may have been removed already
@@ -99,6 +109,9 @@ var messageHandlers = map[string]MessageHandler{
 	"login": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
 		processRequest(conn, data, accounts.LoginUser, "login_response")
 	}),
+	"oidc_login": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, accounts.OIDCLogin, "login_response")
+	}),
 	"change_password": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
 		processRequest(conn, data, accounts.ChangeUserPassword, "change_password_response")
 	}),
@@ -108,6 +121,18 @@ var messageHandlers = map[string]MessageHandler{
 	"change_display_name": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
 		processRequest(conn, data, accounts.ChangeUserDisplayName, "change_display_name_response")
 	}),
+	"request_email_verification": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, RequestEmailVerification, "success_notification")
+	}),
+	"verify_email": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, accounts.VerifyEmail, "success_notification")
+	}),
+	"request_password_reset": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, accounts.RequestPasswordReset, "success_notification")
+	}),
+	"reset_password": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, accounts.ResetPassword, "success_notification")
+	}),
 	"get_user_files":       HandlerFunc(handleGetUserFiles),
 	"get_user_collections": HandlerFunc(handleGetUserCollections),
 	"convert_video": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
@@ -145,6 +170,75 @@ var messageHandlers = map[string]MessageHandler{
 	"delete_account": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
 		processRequest(conn, data, removeAccountHandler, "success_notification")
 	}),
+	"get_file_metadata": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, GetFileMetadata, "get_file_metadata_response")
+	}),
+	"set_file_metadata_stripping": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, SetFileMetadataStripping, "set_file_metadata_stripping_response")
+	}),
+	"set_account_metadata_stripping": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, SetAccountMetadataStripping, "set_account_metadata_stripping_response")
+	}),
+	"find_similar_images": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, FindSimilarImages, "find_similar_images_response")
+	}),
+	"list_sessions": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, ListSessions, "list_sessions_response")
+	}),
+	"revoke_session": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, RevokeSession, "success_notification")
+	}),
+	"rotate_token": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, RotateToken, "success_notification")
+	}),
+	"logout": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, Logout, "logout_response")
+	}),
+	"create_api_key": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, CreateAPIKey, "create_api_key_response")
+	}),
+	"list_api_keys": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, ListAPIKeys, "list_api_keys_response")
+	}),
+	"revoke_api_key": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, RevokeAPIKey, "success_notification")
+	}),
+	"begin_totp_enrollment": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, BeginTOTPEnrollment, "begin_totp_enrollment_response")
+	}),
+	"confirm_totp_enrollment": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, ConfirmTOTPEnrollment, "confirm_totp_enrollment_response")
+	}),
+	"disable_totp": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, DisableTOTP, "success_notification")
+	}),
+	"regenerate_recovery_codes": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, RegenerateRecoveryCodes, "regenerate_recovery_codes_response")
+	}),
+	"request_export": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, RequestExport, "success_notification")
+	}),
+	"export_status": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, GetExportStatus, "export_progress")
+	}),
+	"admin_list_users": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, AdminListUsers, "admin_list_users_response")
+	}),
+	"admin_set_disabled": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, AdminSetDisabled, "success_notification")
+	}),
+	"admin_set_quota": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, AdminSetQuota, "success_notification")
+	}),
+	"admin_delete_file": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, AdminDeleteFile, "success_notification")
+	}),
+	"admin_delete_collection": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, AdminDeleteCollection, "success_notification")
+	}),
+	"admin_stats": HandlerFunc(func(conn *websocket.Conn, data json.RawMessage) {
+		processRequest(conn, data, AdminGetStats, "admin_stats_response")
+	}),
 }
 
 func handleEnableHomepageUpdates(conn *websocket.Conn, data json.RawMessage) {
@@ -201,6 +295,7 @@ func handleGetUserFiles(conn *websocket.Conn, data json.RawMessage) {
 		})
 		return
 	}
+	req.Source = connRemoteIP(conn)
 	files, err := GetUserFiles(req)
 	if err != nil {
 		sendJSON(conn, OutgoingResponse{
@@ -222,6 +317,7 @@ func handleGetUserCollections(conn *websocket.Conn, data json.RawMessage) {
 		})
 		return
 	}
+	req.Source = connRemoteIP(conn)
 	collections, err := GetUserCollections(req)
 	if err != nil {
 		sendJSON(conn, OutgoingResponse{
@@ -243,6 +339,7 @@ func handleDeleteFile(conn *websocket.Conn, data json.RawMessage) {
 		})
 		return
 	}
+	req.Auth.Source = connRemoteIP(conn)
 
 	fileToDelete, _ := database.GetFile(req.FileDirectory)
 	if err := DeleteFile(req); err != nil {
@@ -13,10 +13,12 @@ type UserInfo struct {
 	Token          string
 	Email          string
 	HashedPassword string
+	SessionID      string // set when the connection authenticated with a session token
 }
 
 type WebsocketData struct {
 	Mutex                 *sync.Mutex
+	RemoteIP              string
 	HomePageUpdates       bool
 	UserInfo              UserInfo
 	SubscribedCollections map[string]bool
@@ -63,15 +65,20 @@ type AuthInfo struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Token    string `json:"token"`
+	Source   string `json:"-"` // client IP, set by the server through SetSource
 }
 
 func (a AuthInfo) GetToken() (string, error) {
 	if (a.Email == "" || a.Password == "") && a.Token == "" {
 		return "", fmt.Errorf("no authentication information provided")
 	}
+	// a session is preferred, it's the only way in for accounts with 2FA
+	if accounts.IsSessionToken(a.Token) {
+		return accounts.ResolveToken(a.Token)
+	}
 	if a.Email != "" && a.Password != "" {
-		if !accounts.Authenticate(a.Email, a.Password) {
-			return "", fmt.Errorf("authentication failed")
+		if err := accounts.AuthenticateFrom(a.Email, a.Password, a.Source); err != nil {
+			return "", err
 		}
 		account, err := database.FindUserByEmail(a.Email)
 		if err != nil {
@@ -79,22 +86,68 @@ func (a AuthInfo) GetToken() (string, error) {
 		}
 		return account.Token, nil
 	} else if a.Token != "" {
-		return a.Token, nil
+		return accounts.ResolveToken(a.Token)
 	} else {
 		return "", fmt.Errorf("invalid authentication information provided")
 	}
 }
 
+// GetTokenFor is GetToken for the handlers scripts may call, it also takes
+// API keys that have scope. A key limited to some collections must be allowed
+// every one of collectionIDs, and can't be used where none are given.
+func (a AuthInfo) GetTokenFor(scope string, collectionIDs ...string) (string, error) {
+	if !accounts.IsAPIKey(a.Token) {
+		return a.GetToken()
+	}
+	key, err := accounts.AuthorizeAPIKey(a.Token, scope)
+	if err != nil {
+		return "", err
+	}
+	if key.Restricted() && len(collectionIDs) == 0 {
+		return "", fmt.Errorf("API key is limited to some collections")
+	}
+	for _, collectionID := range collectionIDs {
+		if !key.AllowsCollection(collectionID) {
+			return "", fmt.Errorf("API key can't access collection %s", collectionID)
+		}
+	}
+	return key.AccountToken, nil
+}
+
+// GetTokenForFile is GetTokenFor a request about a single file, keys limited
+// to some collections only reach the files in them.
+func (a AuthInfo) GetTokenForFile(scope string, fileDirectory string) (string, error) {
+	if !accounts.IsAPIKey(a.Token) {
+		return a.GetToken()
+	}
+	key, err := accounts.AuthorizeAPIKey(a.Token, scope)
+	if err != nil {
+		return "", err
+	}
+	if !key.AllowsFile(fileDirectory) {
+		return "", fmt.Errorf("API key can't access file %s", fileDirectory)
+	}
+	return key.AccountToken, nil
+}
+
 type ConvertVideoRequest struct {
 	FileDirectory string   `json:"file_directory"`
 	Auth          AuthInfo `json:"auth"`
 }
 
+func (r *ConvertVideoRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 type DeleteFileRequest struct {
 	FileDirectory string   `json:"file_directory"`
 	Auth          AuthInfo `json:"auth"`
 }
 
+func (r *DeleteFileRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 type connInfo struct {
 	conn *websocket.Conn
 	data *WebsocketData
@@ -105,16 +158,28 @@ type CreateCollectionRequest struct {
 	Auth           AuthInfo `json:"auth"`
 }
 
+func (r *CreateCollectionRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 type DeleteCollectionRequest struct {
 	CollectionID string   `json:"collection_id"`
 	Auth         AuthInfo `json:"auth"`
 }
 
+func (r *DeleteCollectionRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 type GetCollectionRequest struct {
 	CollectionID string   `json:"id"`
 	Auth         AuthInfo `json:"auth"`
 }
 
+func (r *GetCollectionRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 func (r GetCollectionRequest) GetCollectionID() string {
 	return r.CollectionID
 }
@@ -164,18 +229,30 @@ type AddFolderToCollectionRequest struct {
 	Auth         AuthInfo `json:"auth"`
 }
 
+func (r *AddFolderToCollectionRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 func (r AddFolderToCollectionRequest) GetCollectionID() string {
 	return r.CollectionID
 }
 
 type RemoveFolderFromCollectionRequest AddFolderToCollectionRequest
 
+func (r *RemoveFolderFromCollectionRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 type CreateFolderInCollectionRequest struct {
 	CollectionID string   `json:"collection_id"`
 	FolderName   string   `json:"folder_name"`
 	Auth         AuthInfo `json:"auth"`
 }
 
+func (r *CreateFolderInCollectionRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 func (r CreateFolderInCollectionRequest) GetCollectionID() string {
 	return r.CollectionID
 }
@@ -186,15 +263,267 @@ type AddFileToCollectionRequest struct {
 	Auth          AuthInfo `json:"auth"`
 }
 
+func (r *AddFileToCollectionRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 func (r AddFileToCollectionRequest) GetCollectionID() string {
 	return r.CollectionID
 }
 
 type RemoveFileFromCollectionRequest AddFileToCollectionRequest
 
+func (r *RemoveFileFromCollectionRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 type ImportGithubRepoRequest struct {
 	RepoURL string   `json:"repo_url"`
 	Auth    AuthInfo `json:"auth"`
 }
 
+func (r *ImportGithubRepoRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
 type removeAccRequest accounts.DeleteUserRequest
+
+func (r *removeAccRequest) SetSource(source string) {
+	r.Source = source
+}
+
+type GetFileMetadataRequest struct {
+	FileDirectory string   `json:"file_directory"`
+	Auth          AuthInfo `json:"auth"`
+}
+
+func (r *GetFileMetadataRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type SetFileMetadataStrippingRequest struct {
+	FileDirectory string   `json:"file_directory"`
+	Strip         bool     `json:"strip"`
+	Auth          AuthInfo `json:"auth"`
+}
+
+func (r *SetFileMetadataStrippingRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type SetAccountMetadataStrippingRequest struct {
+	Strip bool     `json:"strip"`
+	Auth  AuthInfo `json:"auth"`
+}
+
+func (r *SetAccountMetadataStrippingRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+// ImageMetadata is the camera/lens/date/location information shown in the file details.
+type ImageMetadata struct {
+	HasExif       bool     `json:"has_exif"`
+	CameraMake    string   `json:"camera_make,omitempty"`
+	CameraModel   string   `json:"camera_model,omitempty"`
+	LensModel     string   `json:"lens_model,omitempty"`
+	TakenAt       int64    `json:"taken_at,omitempty"`
+	ExposureTime  string   `json:"exposure_time,omitempty"`
+	FNumber       float64  `json:"f_number,omitempty"`
+	ISO           int      `json:"iso,omitempty"`
+	FocalLength   float64  `json:"focal_length,omitempty"`
+	Width         int      `json:"width,omitempty"`
+	Height        int      `json:"height,omitempty"`
+	Orientation   int      `json:"orientation,omitempty"`
+	Latitude      *float64 `json:"latitude,omitempty"`
+	Longitude     *float64 `json:"longitude,omitempty"`
+	StripMetadata bool     `json:"strip_metadata"` // true if GPS & co. are removed when this file is served
+}
+
+type FindSimilarImagesRequest struct {
+	MaxDistance *int     `json:"max_distance"` // bits two hashes may differ by, defaults to defaultSimilarityDistance
+	Auth        AuthInfo `json:"auth"`
+}
+
+func (r *FindSimilarImagesRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+// SimilarImages groups a user's images that look alike, each group holds at least two files.
+// Images only get a hash once their preview has been generated.
+type SimilarImages struct {
+	Groups [][]database.FileData `json:"groups"`
+}
+
+type ListSessionsRequest struct {
+	Auth AuthInfo `json:"auth"`
+}
+
+func (r *ListSessionsRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type RevokeSessionRequest struct {
+	SessionID string   `json:"session_id"`
+	Auth      AuthInfo `json:"auth"`
+}
+
+func (r *RevokeSessionRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type AdminRequest struct {
+	Auth AuthInfo `json:"auth"`
+}
+
+func (r *AdminRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type AdminListUsersRequest struct {
+	Query  string   `json:"query"` // part of the email or display name, empty for everyone
+	Offset int      `json:"offset"`
+	Limit  int      `json:"limit"`
+	Auth   AuthInfo `json:"auth"`
+}
+
+func (r *AdminListUsersRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type AdminSetDisabledRequest struct {
+	Email    string   `json:"email"`
+	Disabled bool     `json:"disabled"`
+	Auth     AuthInfo `json:"auth"`
+}
+
+func (r *AdminSetDisabledRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+// AdminSetQuotaRequest sets how many bytes of files an account can own. Quota
+// is a number of bytes, 0 goes back to the default quota and -1
+// (accounts.UnlimitedStorageQuota) lifts the limit, anything lower is refused.
+type AdminSetQuotaRequest struct {
+	Email string   `json:"email"`
+	Quota int64    `json:"quota"`
+	Auth  AuthInfo `json:"auth"`
+}
+
+func (r *AdminSetQuotaRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type AdminDeleteFileRequest struct {
+	FileDirectory string   `json:"file_directory"`
+	Auth          AuthInfo `json:"auth"`
+}
+
+func (r *AdminDeleteFileRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type AdminDeleteCollectionRequest struct {
+	CollectionID string   `json:"collection_id"`
+	Auth         AuthInfo `json:"auth"`
+}
+
+func (r *AdminDeleteCollectionRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type AdminUserInfo struct {
+	Email         string `json:"email"`
+	DisplayName   string `json:"display_name"`
+	EmailVerified bool   `json:"email_verified"`
+	TOTPEnabled   bool   `json:"totp_enabled"`
+	Admin         bool   `json:"admin"`
+	Disabled      bool   `json:"disabled"`
+	DeleteAt      int64  `json:"delete_at"`     // when the owner's deletion goes through, 0 if they didn't delete it
+	StorageQuota  int64  `json:"storage_quota"` // as set by an admin
+	QuotaBytes    int64  `json:"quota_bytes"`   // what applies, 0 for no limit
+	Files         int64  `json:"files"`
+	StorageUsed   int64  `json:"storage_used"`
+	Collections   int    `json:"collections"`
+}
+
+type AdminUserList struct {
+	Users []AdminUserInfo `json:"users"`
+	Total int64           `json:"total"`
+}
+
+type AdminStats struct {
+	database.SystemStats
+	Connections         int   `json:"connections"`
+	DefaultStorageQuota int64 `json:"default_storage_quota"`
+}
+
+type ExportRequest struct {
+	Auth AuthInfo `json:"auth"`
+}
+
+func (r *ExportRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type RotateTokenRequest struct {
+	Auth AuthInfo `json:"auth"`
+}
+
+func (r *RotateTokenRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type LogoutRequest struct {
+	SessionToken string `json:"session_token"`
+}
+
+type SessionInfo struct {
+	database.Session
+	Current bool `json:"current"` // the session this request was made with
+}
+
+type TwoFactorRequest struct {
+	Code string   `json:"code"` // TOTP or recovery code, unused when starting enrollment
+	Auth AuthInfo `json:"auth"`
+}
+
+func (r *TwoFactorRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type EmailVerificationRequest struct {
+	Auth AuthInfo `json:"auth"`
+}
+
+func (r *EmailVerificationRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type CreateAPIKeyRequest struct {
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	Collections []string `json:"collections"` // empty for all of them
+	ExpiresAt   int64    `json:"expires_at"`  // unix seconds, 0 for never
+	Auth        AuthInfo `json:"auth"`
+}
+
+func (r *CreateAPIKeyRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type ListAPIKeysRequest struct {
+	Auth AuthInfo `json:"auth"`
+}
+
+func (r *ListAPIKeysRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
+
+type RevokeAPIKeyRequest struct {
+	ID   string   `json:"id"`
+	Auth AuthInfo `json:"auth"`
+}
+
+func (r *RevokeAPIKeyRequest) SetSource(source string) {
+	r.Auth.Source = source
+}
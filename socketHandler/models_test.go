@@ -0,0 +1,208 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+	"angadrive/database"
+	"angadrive/vars"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// setupAuth starts a fresh database with one account, returning the account
+// and a session token of it.
+func setupAuth(t *testing.T) (database.Account, string) {
+	t.Helper()
+	database.UserAccountsByEmail = make(map[string]database.Account)
+	database.UserAccountsByToken = make(map[string]database.Account)
+	database.SessionsByHash = make(map[string]database.Session)
+	database.APIKeysByHash = make(map[string]database.APIKey)
+	database.CollectionCache = make(map[string]database.Collection)
+	database.FileCache = make(map[string]database.FileData)
+	memory, iterations := vars.Argon2MemoryKB, vars.Argon2Iterations
+	vars.Argon2MemoryKB, vars.Argon2Iterations = 64, 1
+	t.Cleanup(func() { vars.Argon2MemoryKB, vars.Argon2Iterations = memory, iterations })
+
+	os.Setenv("SAVE_DRIVE_RAM", "true")
+	defer os.Unsetenv("SAVE_DRIVE_RAM")
+	if err := database.InitializeDatabase(t.TempDir()); err != nil {
+		t.Fatalf("InitializeDatabase failed: %v", err)
+	}
+	hash, err := accounts.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := database.Account{Token: accounts.GenToken(), Email: "owner@example.com", HashedPassword: hash}
+	if err := account.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	session, err := accounts.NewSession(account, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account, session
+}
+
+func TestGetTokenFor(t *testing.T) {
+	account, session := setupAuth(t)
+	allowed := database.Collection{Name: "allowed", Editors: account.Token}
+	other := database.Collection{Name: "other", Editors: account.Token}
+	for _, collection := range []*database.Collection{&allowed, &other} {
+		if err := collection.Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := database.FileData{FileDirectory: "in-allowed.txt", AccountToken: account.Token, Md5sum: "a"}
+	outside := database.FileData{FileDirectory: "outside.txt", AccountToken: account.Token, Md5sum: "b"}
+	for _, f := range []database.FileData{file, outside} {
+		if err := f.Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := allowed.AddFile(file.FileDirectory); err != nil {
+		t.Fatal(err)
+	}
+	newKey := func(scopes []string, collections []string) string {
+		key, err := accounts.CreateAPIKey(account.Token, "script", scopes, collections, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key.Key
+	}
+	reader := newKey([]string{accounts.ScopeReadFiles}, nil)
+	restricted := newKey([]string{accounts.ScopeReadFiles, accounts.ScopeManageCollections}, []string{allowed.ID})
+
+	tests := []struct {
+		name        string
+		auth        AuthInfo
+		scope       string
+		collections []string
+		file        string // GetTokenForFile instead when set
+		ok          bool
+	}{
+		{"session", AuthInfo{Token: session}, accounts.ScopeDeleteFiles, nil, "", true},
+		{"password", AuthInfo{Email: account.Email, Password: "password"}, accounts.ScopeDeleteFiles, nil, "", true},
+		{"account token", AuthInfo{Token: account.Token}, accounts.ScopeReadFiles, nil, "", false},
+		{"key with the scope", AuthInfo{Token: reader}, accounts.ScopeReadFiles, nil, "", true},
+		{"key without the scope", AuthInfo{Token: reader}, accounts.ScopeDeleteFiles, nil, "", false},
+		{"key with no scope check", AuthInfo{Token: reader}, "", nil, "", false},
+		{"restricted key, its collection", AuthInfo{Token: restricted}, accounts.ScopeManageCollections, []string{allowed.ID}, "", true},
+		{"restricted key, another collection", AuthInfo{Token: restricted}, accounts.ScopeManageCollections, []string{allowed.ID, other.ID}, "", false},
+		{"restricted key, no collection", AuthInfo{Token: restricted}, accounts.ScopeReadFiles, nil, "", false},
+		{"restricted key, file in its collection", AuthInfo{Token: restricted}, accounts.ScopeReadFiles, nil, file.FileDirectory, true},
+		{"restricted key, file outside", AuthInfo{Token: restricted}, accounts.ScopeReadFiles, nil, outside.FileDirectory, false},
+		{"unrestricted key, any file", AuthInfo{Token: reader}, accounts.ScopeReadFiles, nil, outside.FileDirectory, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var token string
+			var err error
+			if tt.file != "" {
+				token, err = tt.auth.GetTokenForFile(tt.scope, tt.file)
+			} else {
+				token, err = tt.auth.GetTokenFor(tt.scope, tt.collections...)
+			}
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && token != account.Token {
+				t.Errorf("resolved to %q", token)
+			}
+		})
+	}
+}
+
+func TestUpdateConnAuth(t *testing.T) {
+	account, session := setupAuth(t)
+	key, err := accounts.CreateAPIKey(account.Token, "script", []string{accounts.ScopeReadFiles}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		auth      AuthInfo
+		token     string
+		sessionID bool
+	}{
+		{"session", AuthInfo{Token: session}, account.Token, true},
+		{"guest token", AuthInfo{Token: "guest.token.1"}, "guest.token.1", false},
+		// would subscribe the connection to the account's pulses
+		{"account token", AuthInfo{Token: account.Token}, "", false},
+		{"API key", AuthInfo{Token: key.Key}, "", false},
+		{"revoked session", AuthInfo{Token: "session_made-up"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &websocket.Conn{}
+			ActiveWebsocketsMutex.Lock()
+			ActiveWebsockets[conn] = WebsocketData{Mutex: &sync.Mutex{}}
+			ActiveWebsocketsMutex.Unlock()
+			defer func() {
+				ActiveWebsocketsMutex.Lock()
+				delete(ActiveWebsockets, conn)
+				ActiveWebsocketsMutex.Unlock()
+			}()
+
+			updateConnAuth(conn, tt.auth)
+			ActiveWebsocketsMutex.RLock()
+			info := ActiveWebsockets[conn].UserInfo
+			ActiveWebsocketsMutex.RUnlock()
+			if info.Token != tt.token || (info.SessionID != "") != tt.sessionID {
+				t.Errorf("connection got %+v", info)
+			}
+		})
+	}
+}
+
+func TestUpdateConnAuthCountsFailures(t *testing.T) {
+	account, _ := setupAuth(t)
+	conn := &websocket.Conn{}
+	ActiveWebsocketsMutex.Lock()
+	ActiveWebsockets[conn] = WebsocketData{Mutex: &sync.Mutex{}, RemoteIP: "203.0.113.7"}
+	ActiveWebsocketsMutex.Unlock()
+	defer func() {
+		ActiveWebsocketsMutex.Lock()
+		delete(ActiveWebsockets, conn)
+		ActiveWebsocketsMutex.Unlock()
+	}()
+
+	// well past any allowance, spread over accounts so only the IP locks
+	for i := 0; i < 100; i++ {
+		updateConnAuth(conn, AuthInfo{Email: fmt.Sprintf("guess%d@example.com", i), Password: "wrong"})
+	}
+	if _, ok := accounts.AuthenticateFrom(account.Email, "password", "203.0.113.7").(accounts.LockoutError); !ok {
+		t.Error("guessing through connection auth didn't lock the IP")
+	}
+	if err := accounts.AuthenticateFrom(account.Email, "password", "203.0.113.8"); err != nil {
+		t.Errorf("owner couldn't log in from elsewhere: %v", err)
+	}
+}
+
+func TestSetSource(t *testing.T) {
+	twoFactor := &TwoFactorRequest{}
+	removeFile := &RemoveFileFromCollectionRequest{}
+	removeAccount := &removeAccRequest{}
+	login := &accounts.LoginRequest{}
+	tests := []struct {
+		name    string
+		request interface{ SetSource(string) }
+		source  func() string
+	}{
+		{"request with auth", twoFactor, func() string { return twoFactor.Auth.Source }},
+		{"request defined from another", removeFile, func() string { return removeFile.Auth.Source }},
+		{"account deletion", removeAccount, func() string { return removeAccount.Source }},
+		{"login", login, func() string { return login.Source }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request.SetSource("198.51.100.1")
+			if got := tt.source(); got != "198.51.100.1" {
+				t.Errorf("source = %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package socketHandler
+
+// PreviewStatusPulse tells a file owner's open sessions that the preview of
+// one of their files changed state, so placeholders can be swapped out.
+func PreviewStatusPulse(token string, fileDirectory string, status string) {
+	genericUserPulse(token, map[string]interface{}{
+		"type": "preview_status",
+		"data": map[string]interface{}{
+			"file_directory": fileDirectory,
+			"status":         status,
+		},
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"angadrive/accounts"
 	"angadrive/database"
 	"fmt"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -46,19 +47,70 @@ func logoutUser(email string) error {
 }
 
 func removeAccountHandler(req removeAccRequest) (string, error) {
-	files, collections, err := accounts.DeleteUser(accounts.DeleteUserRequest(req))
+	account, sessions, err := accounts.DeleteUser(accounts.DeleteUserRequest(req))
 	if err != nil {
 		return "", fmt.Errorf("failed to remove account: %v", err)
 	}
+	for _, session := range sessions {
+		go logoutSession(session.ID, account.Email)
+	}
+	go logoutUser(req.Email)
+	deadline := time.Unix(account.DeleteAt, 0).Format("02 Jan 2006")
+	return "Account deleted, log in again before " + deadline + " to restore it", nil
+}
+
+// purgeDeletedAccounts deletes the accounts whose grace period is over,
+// along with everything they owned.
+func purgeDeletedAccounts() {
+	due, err := database.GetAccountsDueForDeletion(time.Now().Unix())
+	if err != nil {
+		fmt.Printf("Warning: Failed to get accounts due for deletion: %v\n", err)
+		return
+	}
+	for _, account := range due {
+		// content first, it would show up again while the account is already
+		// gone. The account is kept for the next run if any of it is left.
+		if err := purgeAccountContent(account); err != nil {
+			fmt.Printf("Warning: Failed to purge the content of %s: %v\n", account.Email, err)
+			continue
+		}
+		if err := account.Delete(); err != nil {
+			fmt.Printf("Warning: Failed to purge account %s: %v\n", account.Email, err)
+			continue
+		}
+		dropExport(account.Token)
+	}
+	if len(due) > 0 {
+		go UpdateUserCount()
+		go FileCountPulse()
+	}
+}
+
+func purgeAccountContent(account database.Account) error {
+	files, collections, err := database.GetPurgeContent(account.Token)
+	if err != nil {
+		return err
+	}
 	for _, file := range files {
-		go func(file database.FileData) {
-			database.DeleteFile(file, PulseCollectionSubscribers)
-			RemoveFile(file.Md5sum)
-		}(file)
+		if err := database.DeleteFile(file, PulseCollectionSubscribers); err != nil {
+			return fmt.Errorf("failed to delete file %s: %v", file.FileDirectory, err)
+		}
+		RemoveFile(file.Md5sum)
 	}
 	for _, collection := range collections {
-		go collection.Delete()
+		if err := collection.Delete(); err != nil {
+			return fmt.Errorf("failed to delete collection %s: %v", collection.ID, err)
+		}
+	}
+	return nil
+}
+
+func initAccountPurger() {
+	purgeDeletedAccounts()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		purgeDeletedAccounts()
 	}
-	go logoutUser(req.Email)
-	return "Account deleted successfully", nil
 }
@@ -0,0 +1,76 @@
+package socketHandler
+
+import (
+	"angadrive/database"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	account, _ := setupAuth(t)
+	UPLOAD_DIR = t.TempDir()
+	os.MkdirAll(filepath.Join(UPLOAD_DIR, "i"), os.ModePerm)
+	storeFile := func(fileDirectory string, owner string) database.FileData {
+		t.Helper()
+		file := database.FileData{OriginalFileName: fileDirectory, FileDirectory: fileDirectory, AccountToken: owner, Md5sum: "md5-" + fileDirectory}
+		if err := os.WriteFile(filepath.Join(UPLOAD_DIR, "i", file.Md5sum), []byte(fileDirectory), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.Insert(); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	owned := storeFile("owned.txt", account.Token)
+	kept := storeFile("someone-elses.txt", "other-token")
+	collection := database.Collection{Name: "owned", Editors: account.Token}
+	if err := collection.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if err := collection.AddFile(owned.FileDirectory); err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := account.SetDeleteAt(time.Now().Add(-time.Minute).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// hidden while pending, which is why the purge can't go through these
+	if files, _ := database.GetUserFiles(account.Token); len(files) != 0 {
+		t.Fatalf("pending account still shows %d files", len(files))
+	}
+
+	purgeDeletedAccounts()
+
+	db := database.GetDB()
+	rows := []struct {
+		name  string
+		model any
+		where string
+		arg   string
+		want  int64
+	}{
+		{"account", &database.Account{}, "token = ?", account.Token, 0},
+		{"owned file", &database.FileData{}, "file_directory = ?", owned.FileDirectory, 0},
+		{"collection", &database.Collection{}, "id = ?", collection.ID, 0},
+		{"collection file", &database.CollectionFile{}, "collection_id = ?", collection.ID, 0},
+		{"someone else's file", &database.FileData{}, "file_directory = ?", kept.FileDirectory, 1},
+	}
+	for _, row := range rows {
+		var count int64
+		if err := db.Model(row.model).Where(row.where, row.arg).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != row.want {
+			t.Errorf("%d rows of %s left, want %d", count, row.name, row.want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(UPLOAD_DIR, "i", owned.Md5sum)); !os.IsNotExist(err) {
+		t.Errorf("blob of the purged file is still there: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(UPLOAD_DIR, "i", kept.Md5sum)); err != nil {
+		t.Errorf("blob of someone else's file is gone: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+	"angadrive/database"
+
+	"github.com/gorilla/websocket"
+)
+
+// RotateToken replaces the caller's account token. The session the request
+// came from stays logged in, every other one is logged out.
+func RotateToken(req RotateTokenRequest) (string, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return "", err
+	}
+	keepSessionID := ""
+	if accounts.IsSessionToken(req.Auth.Token) {
+		if session, err := accounts.FindSession(req.Auth.Token); err == nil {
+			keepSessionID = session.ID
+		}
+	}
+	rotated, err := accounts.RotateToken(account, keepSessionID)
+	if err != nil {
+		return "", err
+	}
+	go moveConnections(account, rotated.Token, keepSessionID)
+	return "Token rotated, other sessions were logged out", nil
+}
+
+// moveConnections points the connections of the kept session at the new
+// token and logs out everything else still holding the old one.
+func moveConnections(account database.Account, newToken string, keepSessionID string) {
+	var connectionsToUpdate []connInfo
+	ActiveWebsocketsMutex.Lock()
+	for conn, connData := range ActiveWebsockets {
+		if connData.UserInfo.Token != account.Token {
+			continue
+		}
+		if keepSessionID != "" && connData.UserInfo.SessionID == keepSessionID {
+			connData.UserInfo.Token = newToken
+		} else {
+			connectionsToUpdate = append(connectionsToUpdate, connInfo{conn: conn, data: &connData})
+			connData.UserInfo = UserInfo{}
+		}
+		ActiveWebsockets[conn] = connData
+	}
+	ActiveWebsocketsMutex.Unlock()
+	for _, ci := range connectionsToUpdate {
+		go func(conn *websocket.Conn, connData *WebsocketData) {
+			connData.Mutex.Lock()
+			defer connData.Mutex.Unlock()
+			conn.WriteJSON(map[string]any{
+				"type": "force_logout",
+				"data": account.Email,
+			})
+		}(ci.conn, ci.data)
+	}
+}
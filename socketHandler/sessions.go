@@ -0,0 +1,98 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+	"angadrive/database"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// logoutSession drops the auth of every connection using a revoked session
+// and tells them to log out, like logoutUser does for a deleted account.
+func logoutSession(sessionID string, email string) {
+	var connectionsToUpdate []connInfo
+	ActiveWebsocketsMutex.Lock()
+	for conn, connData := range ActiveWebsockets {
+		if connData.UserInfo.SessionID == sessionID {
+			connectionsToUpdate = append(connectionsToUpdate, connInfo{conn: conn, data: &connData})
+			connData.UserInfo = UserInfo{}
+			ActiveWebsockets[conn] = connData
+		}
+	}
+	ActiveWebsocketsMutex.Unlock()
+	for _, ci := range connectionsToUpdate {
+		go func(conn *websocket.Conn, connData *WebsocketData) {
+			connData.Mutex.Lock()
+			defer connData.Mutex.Unlock()
+			conn.WriteJSON(map[string]any{
+				"type": "force_logout",
+				"data": email,
+			})
+		}(ci.conn, ci.data)
+	}
+}
+
+func ListSessions(req ListSessionsRequest) ([]SessionInfo, error) {
+	token, err := req.Auth.GetToken()
+	if err != nil {
+		return nil, fmt.Errorf("authentication failed: %v", err)
+	}
+	if _, err := database.FindUserByToken(token); err != nil {
+		return nil, fmt.Errorf("guests have no sessions")
+	}
+	sessions, err := database.GetAccountSessions(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %v", err)
+	}
+	currentID := ""
+	if accounts.IsSessionToken(req.Auth.Token) {
+		if current, err := accounts.FindSession(req.Auth.Token); err == nil {
+			currentID = current.ID
+		}
+	}
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, SessionInfo{Session: session, Current: session.ID == currentID})
+	}
+	return infos, nil
+}
+
+func RevokeSession(req RevokeSessionRequest) (string, error) {
+	token, err := req.Auth.GetToken()
+	if err != nil {
+		return "", fmt.Errorf("authentication failed: %v", err)
+	}
+	account, err := database.FindUserByToken(token)
+	if err != nil {
+		return "", fmt.Errorf("guests have no sessions")
+	}
+	session, err := accounts.RevokeSession(token, req.SessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to revoke session: %v", err)
+	}
+	go logoutSession(session.ID, account.Email)
+	return "Session revoked", nil
+}
+
+// Logout ends the session the client is holding. Unknown or expired tokens
+// are fine, the client is logged out either way.
+func Logout(req LogoutRequest) (string, error) {
+	if !accounts.IsSessionToken(req.SessionToken) {
+		return "Logged out", nil
+	}
+	session, err := accounts.FindSession(req.SessionToken)
+	if err != nil {
+		return "Logged out", nil
+	}
+	if err := session.Delete(); err != nil {
+		return "", fmt.Errorf("failed to end session: %v", err)
+	}
+	// other tabs authenticated with this session would stay logged in
+	email := ""
+	if account, err := database.FindUserByToken(session.AccountToken); err == nil {
+		email = account.Email
+	}
+	go logoutSession(session.ID, email)
+	return "Logged out", nil
+}
@@ -0,0 +1,68 @@
+package socketHandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestConn connects a websocket client to a test server and returns
+// both ends, the server end registered like SetupWebsocket does.
+func dialTestConn(t *testing.T) (server *websocket.Conn, client *websocket.Conn) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	serverConns := make(chan *websocket.Conn, 1)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(httpServer.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server = <-serverConns
+	ActiveWebsocketsMutex.Lock()
+	ActiveWebsockets[server] = WebsocketData{Mutex: &sync.Mutex{}, SubscribedCollections: make(map[string]bool)}
+	ActiveWebsocketsMutex.Unlock()
+	t.Cleanup(func() {
+		ActiveWebsocketsMutex.Lock()
+		delete(ActiveWebsockets, server)
+		ActiveWebsocketsMutex.Unlock()
+		server.Close()
+	})
+	return server, client
+}
+
+func TestLogoutLogsOutConnections(t *testing.T) {
+	account, session := setupAuth(t)
+	server, client := dialTestConn(t)
+	updateConnAuth(server, AuthInfo{Token: session})
+
+	if _, err := Logout(LogoutRequest{SessionToken: session}); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var message map[string]any
+	if err := client.ReadJSON(&message); err != nil {
+		t.Fatalf("no message after logging out: %v", err)
+	}
+	if message["type"] != "force_logout" || message["data"] != account.Email {
+		t.Errorf("got %v, want force_logout for %s", message, account.Email)
+	}
+	ActiveWebsocketsMutex.RLock()
+	info := ActiveWebsockets[server].UserInfo
+	ActiveWebsocketsMutex.RUnlock()
+	if info != (UserInfo{}) {
+		t.Errorf("connection is still authenticated as %+v", info)
+	}
+}
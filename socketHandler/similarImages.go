@@ -0,0 +1,90 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+	"angadrive/database"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+)
+
+// hashes this many bits apart are usually the same picture re-encoded or resized
+const defaultSimilarityDistance = 10
+
+// past this, unrelated images start matching by chance
+const maxSimilarityDistance = 24
+
+// FindSimilarImages groups the user's images whose perceptual hashes are
+// within req.MaxDistance bits of each other. Matches are transitive, an
+// image similar to any member of a group joins that group.
+func FindSimilarImages(req FindSimilarImagesRequest) (SimilarImages, error) {
+	result := SimilarImages{Groups: [][]database.FileData{}}
+	token, err := req.Auth.GetTokenFor(accounts.ScopeReadFiles)
+	if err != nil {
+		return result, fmt.Errorf("authentication failed: %v", err)
+	}
+	maxDistance := defaultSimilarityDistance
+	if req.MaxDistance != nil {
+		maxDistance = *req.MaxDistance
+	}
+	if maxDistance < 0 || maxDistance > maxSimilarityDistance {
+		return result, fmt.Errorf("max_distance must be between 0 and %d", maxSimilarityDistance)
+	}
+	files, err := database.GetUserFiles(token)
+	if err != nil {
+		return result, fmt.Errorf("failed to get files: %v", err)
+	}
+
+	var hashed []database.FileData
+	var hashes []uint64
+	for _, file := range files {
+		hash, err := strconv.ParseUint(file.PerceptualHash, 16, 64)
+		if err != nil {
+			continue
+		}
+		hashed = append(hashed, file)
+		hashes = append(hashes, hash)
+	}
+
+	// union-find over every pair, a few thousand images compare in milliseconds
+	parent := make([]int, len(hashed))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if bits.OnesCount64(hashes[i]^hashes[j]) <= maxDistance {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	groups := make(map[int][]database.FileData)
+	for i, file := range hashed {
+		root := find(i)
+		groups[root] = append(groups[root], file)
+	}
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		// oldest first, that's usually the original
+		sort.Slice(group, func(a, b int) bool { return group[a].Timestamp < group[b].Timestamp })
+		result.Groups = append(result.Groups, group)
+	}
+	sort.Slice(result.Groups, func(a, b int) bool {
+		if len(result.Groups[a]) != len(result.Groups[b]) {
+			return len(result.Groups[a]) > len(result.Groups[b])
+		}
+		return result.Groups[a][0].Timestamp < result.Groups[b][0].Timestamp
+	})
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package socketHandler
+
+import (
+	"angadrive/accounts"
+	"angadrive/database"
+	"fmt"
+)
+
+// requestAccount returns the account auth belongs to, guests have none.
+func requestAccount(auth AuthInfo) (database.Account, error) {
+	token, err := auth.GetToken()
+	if err != nil {
+		return database.Account{}, fmt.Errorf("authentication failed: %v", err)
+	}
+	account, err := database.FindUserByToken(token)
+	if err != nil {
+		return database.Account{}, fmt.Errorf("log in to an account first")
+	}
+	return account, nil
+}
+
+func BeginTOTPEnrollment(req TwoFactorRequest) (accounts.TOTPEnrollment, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return accounts.TOTPEnrollment{}, err
+	}
+	return accounts.BeginTOTPEnrollment(account)
+}
+
+func ConfirmTOTPEnrollment(req TwoFactorRequest) ([]string, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return accounts.ConfirmTOTPEnrollment(account, req.Code)
+}
+
+func DisableTOTP(req TwoFactorRequest) (string, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return "", err
+	}
+	if err := accounts.DisableTOTP(account, req.Code, req.Auth.Source); err != nil {
+		return "", err
+	}
+	return "Two-factor authentication disabled", nil
+}
+
+func RegenerateRecoveryCodes(req TwoFactorRequest) ([]string, error) {
+	account, err := requestAccount(req.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return accounts.RegenerateRecoveryCodes(account, req.Code, req.Auth.Source)
+}
@@ -48,13 +48,24 @@ func genericUserPulse(token string, message map[string]interface{}) {
 	}
 }
 
+// notifyLockout warns the account's open tabs that someone is guessing its password.
+func notifyLockout(account database.Account, until time.Time) {
+	genericUserPulse(account.Token, map[string]interface{}{
+		"type": "notification",
+		"data": fmt.Sprintf("Too many failed logins to your account, logging in is paused until %s", until.Format("03:04 PM")),
+	})
+}
+
 func SetupWebsocket(r *gin.Engine, upload_dir string) {
 	UPLOAD_DIR = upload_dir
+	accounts.OnLockout = notifyLockout
 	info.InitializeSysInfo()
 	initializeUserCount()
 	initFileCount()
+	initExports()
 	go initSpaceUsedPulser()
 	go sysinfoPulse()
+	go initAccountPurger()
 	r.GET("/ws", func(c *gin.Context) {
 		if c.Request.Host != vars.WebURL {
 			// if gin.Mode() != gin.ReleaseMode {
@@ -74,8 +85,9 @@ func SetupWebsocket(r *gin.Engine, upload_dir string) {
 		ActiveWebsocketsMutex.Lock()
 		ActiveWebsockets[conn] = WebsocketData{
 			Mutex:                 &sync.Mutex{},
+			RemoteIP:              c.ClientIP(),
 			HomePageUpdates:       false,
-			UserInfo:              UserInfo{"", "", ""},
+			UserInfo:              UserInfo{},
 			SubscribedCollections: make(map[string]bool),
 		}
 		ActiveWebsocketsMutex.Unlock()
@@ -141,15 +153,23 @@ func updateConnAuth(conn *websocket.Conn, req AuthInfo) {
 	}
 	data.Mutex.Lock()
 	defer data.Mutex.Unlock()
-	if req.Email != "" && req.Password != "" && accounts.Authenticate(req.Email, req.Password) {
+	if req.Email != "" && req.Password != "" && accounts.AuthenticateFrom(req.Email, req.Password, connRemoteIP(conn)) == nil {
 		accountInfo, _ := database.FindUserByEmail(req.Email)
-		data.UserInfo.Token = ""
-		data.UserInfo.Email = accountInfo.Email
-		data.UserInfo.HashedPassword = accountInfo.HashedPassword
+		data.UserInfo = UserInfo{Email: accountInfo.Email, HashedPassword: accountInfo.HashedPassword}
+	} else if accounts.IsSessionToken(req.Token) {
+		// pulses are matched against the account token, the session is kept so revoking it can log this connection out
+		session, err := accounts.FindSession(req.Token)
+		if err != nil {
+			return
+		}
+		data.UserInfo = UserInfo{Token: session.AccountToken, SessionID: session.ID}
 	} else {
-		data.UserInfo.Token = req.Token
-		data.UserInfo.Email = ""
-		data.UserInfo.HashedPassword = ""
+		// anonymous tokens only, account tokens and API keys are refused the same way GetToken refuses them
+		token, err := accounts.ResolveToken(req.Token)
+		if err != nil {
+			return
+		}
+		data.UserInfo = UserInfo{Token: token}
 	}
 	ActiveWebsocketsMutex.Lock()
 	// Double-check still present before writing back
@@ -1,12 +1,64 @@
 package vars
 
 import (
+	"crypto/rand"
+	"fmt"
+	"math"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var WebURL string
 var AssetsURL string
 
+// PreviewCacheBytes is the disk budget shared by all generated previews
+var PreviewCacheBytes int64
+
+// Argon2id cost of newly hashed passwords, existing hashes are upgraded on login
+var Argon2MemoryKB uint32
+var Argon2Iterations uint32
+var Argon2Parallelism uint8
+
+// Outgoing mail, for email verification and password resets. Mail is
+// disabled while SMTPHost is empty.
+var SMTPHost string
+var SMTPPort int
+var SMTPUsername string
+var SMTPPassword string
+var SMTPFrom string
+
+// TokenSigningKey signs the links sent by mail
+var TokenSigningKey []byte
+
+// OIDCProvider is an identity provider people can log in with instead of a password
+type OIDCProvider struct {
+	ID            string // used in the callback URL, from OIDC_PROVIDERS
+	Name          string // shown on the login button
+	Issuer        string
+	ClientID      string
+	ClientSecret  string // empty for public clients, PKCE is used either way
+	AutoProvision bool   // create an account on first login instead of refusing unknown emails
+}
+
+var OIDCProviders []OIDCProvider
+
+// AdminEmails are made admins on startup, admins can't appoint each other
+var AdminEmails []string
+
+// TrustedProxies are the addresses whose X-Forwarded-For is believed when
+// working out the client's IP for lockouts, none by default
+var TrustedProxies []string
+
+// AccountDeletionGrace is how long deleted accounts can still be restored
+// by logging in, their content is hidden until they're purged
+var AccountDeletionGrace time.Duration
+
+// DefaultStorageQuota is how many bytes of files an account or guest can
+// own unless an admin set a different quota for them, 0 for no limit
+var DefaultStorageQuota int64
+
 func init() {
 	WebURL = os.Getenv("WEB_URL")
 	AssetsURL = os.Getenv("ASSETS_URL")
@@ -18,4 +70,107 @@ func init() {
 	if AssetsURL == "" {
 		AssetsURL = "localhost:8080"
 	}
+
+	previewCacheMB, err := strconv.ParseInt(os.Getenv("PREVIEW_CACHE_MB"), 10, 64)
+	if err != nil || previewCacheMB <= 0 {
+		previewCacheMB = 2048
+	}
+	PreviewCacheBytes = previewCacheMB * 1024 * 1024
+
+	Argon2MemoryKB = uint32(positiveIntEnv("ARGON2_MEMORY_KB", 64*1024, 1<<32-1))
+	Argon2Iterations = uint32(positiveIntEnv("ARGON2_ITERATIONS", 3, 1<<32-1))
+	Argon2Parallelism = uint8(positiveIntEnv("ARGON2_PARALLELISM", 4, 255))
+
+	SMTPHost = os.Getenv("SMTP_HOST")
+	SMTPPort = int(positiveIntEnv("SMTP_PORT", 587, 65535))
+	SMTPUsername = os.Getenv("SMTP_USERNAME")
+	SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	SMTPFrom = os.Getenv("SMTP_FROM")
+	if SMTPFrom == "" {
+		SMTPFrom = SMTPUsername
+	}
+
+	OIDCProviders = loadOIDCProviders()
+
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			AdminEmails = append(AdminEmails, email)
+		}
+	}
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			TrustedProxies = append(TrustedProxies, proxy)
+		}
+	}
+	// the cap is the most MB whose byte count still fits in an int64
+	DefaultStorageQuota = positiveIntEnv("DEFAULT_STORAGE_QUOTA_MB", 0, math.MaxInt64/(1024*1024)) * 1024 * 1024
+	AccountDeletionGrace = time.Duration(positiveIntEnv("ACCOUNT_DELETION_GRACE_DAYS", 30, 3650)) * 24 * time.Hour
+
+	TokenSigningKey = []byte(os.Getenv("TOKEN_SIGNING_KEY"))
+	if len(TokenSigningKey) == 0 {
+		// links sent before a restart stop working, fine for dev
+		TokenSigningKey = make([]byte, 32)
+		if _, err := rand.Read(TokenSigningKey); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func positiveIntEnv(name string, fallback int64, max int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(name), 10, 64)
+	if err != nil || value <= 0 || value > max {
+		return fallback
+	}
+	return value
+}
+
+// loadOIDCProviders reads OIDC_<ID>_* for every ID listed in OIDC_PROVIDERS.
+func loadOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	for _, id := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(id) + "_"
+		provider := OIDCProvider{
+			ID:            id,
+			Name:          os.Getenv(prefix + "NAME"),
+			Issuer:        os.Getenv(prefix + "ISSUER"),
+			ClientID:      os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:  os.Getenv(prefix + "CLIENT_SECRET"),
+			AutoProvision: os.Getenv(prefix+"AUTO_PROVISION") == "true",
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			fmt.Printf("Warning: Skipping OIDC provider %s, %sISSUER and %sCLIENT_ID are required\n", id, prefix, prefix)
+			continue
+		}
+		if provider.Name == "" {
+			provider.Name = id
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// WebLink turns a path of the web app into an absolute URL, for links that
+// leave the browser like mails and OIDC redirects.
+func WebLink(path string) string {
+	return absoluteLink(WebURL, path)
+}
+
+// AssetsLink is WebLink for paths served from the assets host, like files.
+func AssetsLink(path string) string {
+	return absoluteLink(AssetsURL, path)
+}
+
+func absoluteLink(base string, path string) string {
+	if !strings.Contains(base, "://") {
+		if strings.HasPrefix(base, "localhost") || strings.HasPrefix(base, "127.") {
+			base = "http://" + base
+		} else {
+			base = "https://" + base
+		}
+	}
+	return strings.TrimRight(base, "/") + path
 }
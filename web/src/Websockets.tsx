@@ -51,7 +51,10 @@ const WebSocketProvider: ParentComponent = (props) => {
       const userEmail = localStorage.getItem("email") || "";
       const userPassword = localStorage.getItem("password") || "";
       if (userEmail || userPassword) {
-        if (!(userEmail && userPassword)) {
+        if (userEmail && localStorage.getItem("session")) {
+          // already logged in on this device, a reconnect shouldn't start another session
+          fetchFilesAndCollections(ws);
+        } else if (!(userEmail && userPassword)) {
           localStorage.removeItem("email");
           localStorage.removeItem("password");
           localStorage.removeItem("display_name")
@@ -61,13 +64,17 @@ const WebSocketProvider: ParentComponent = (props) => {
             const message = JSON.parse(event.data);
             if (message.type === "login_response"){
               if (message.data === "invalid credentials") {
-                console.error("Login failed:", message.data.error);
+                console.error("Login failed:", message.data);
                 localStorage.removeItem("email");
                 localStorage.removeItem("password");
                 localStorage.removeItem("display_name");
                 localStorage.setItem("token", generateClientToken());
-              } else {
+              } else if (message.data.session_token) {
+                localStorage.setItem("session", message.data.session_token);
                 localStorage.removeItem("token");
+              } else {
+                // e.g. locked out for now, the saved login is still good
+                console.error("Login failed:", message.data);
               }
               fetchFilesAndCollections(ws);
               ws.onmessage = () => {} // Clear the message handler after login to prevent further processing
@@ -77,7 +84,8 @@ const WebSocketProvider: ParentComponent = (props) => {
             type: "login",
             data: {
               email: userEmail,
-              password: userPassword
+              password: userPassword,
+              device: navigator.userAgent
             }
           }))
         }
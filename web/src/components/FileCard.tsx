@@ -1,16 +1,18 @@
 import type { FileData } from "../library/types"
 import { BinSVG, CopySVG, CrossSVG, DownloadSVG, EyeSVG, FileTextSVG, RefreshSVG } from "../assets/SvgFiles";
-import { formatFileSize, getFileType } from "../library/functions";
+import { blurHashToDataURL, formatFileSize, getFileType } from "../library/functions";
 import toast from "solid-toast";
 import { useWebSocket } from "../Websockets";
 import { useLocation } from "@solidjs/router";
 import { AppContext } from "../Context";
-import { createSignal, onCleanup, Component, Show, useContext } from "solid-js";
+import { createSignal, onCleanup, Component, JSX, Show, useContext } from "solid-js";
 import { assetsUrl } from "@/assets/ApiUrl";
+import FileDetails from "./FileDetails";
 
 const FilePreview: Component<{ file: FileData }> = (props) => {
     const ctx = useContext(AppContext)!;
     const [isVisible, setIsVisible] = createSignal<boolean>(ctx.loadedFiles?.()?.has(props.file.file_directory) || false);
+    const [previewLoaded, setPreviewLoaded] = createSignal<boolean>(false);
     let containerRef: HTMLDivElement | undefined;
     let observer: IntersectionObserver | undefined;
 
@@ -109,32 +111,49 @@ const FilePreview: Component<{ file: FileData }> = (props) => {
         if (!ext) {
             return <p class="text-white">Unsupported file type</p>;
         }
-        if (["jpg", "jpeg", "png", "gif", "bmp", "webp", "tiff", "heic", "heif"].includes(ext)) {
+        if (["jpg", "jpeg", "png", "gif", "bmp", "webp", "tiff", "heic", "heif", "svg"].includes(ext)) {
             link = assetsUrl(`/preview-image/${props.file.file_directory}`);
-            return <img src={link} loading="lazy" class="max-h-full max-w-full p-2" />;
-        }
-        if (ext === "svg") {
-            if (props.file.file_size > 200 * 1024) {
-                return <FileTextSVG class="max-h-full p-4 opacity-50" />;
-            }
-            link = assetsUrl(`/preview-image/${props.file.file_directory}`);
-            return <img src={link} loading="lazy" class="max-h-full max-w-full p-2" />;
+            return <img src={link} loading="lazy" class="max-h-full max-w-full p-2" onLoad={() => setPreviewLoaded(true)} />;
         }
         if (["mp4", "mkv", "avi", "mov", "wmv", "flv", "webm"].includes(ext)) {
-            return <video src={link} controls class="max-h-full max-w-full" preload="metadata" />;
+            return <video src={link} controls class="max-h-full max-w-full" preload="metadata" onLoadedData={() => setPreviewLoaded(true)} />;
         }
-        if (["mp3", "wav", "aac", "flac", "ogg", "wma", "m4a"].includes(ext)) {
-            return <audio src={link} controls class="w-full" />;
+        if (["mp3", "wav", "aac", "flac", "ogg", "opus", "wma", "m4a"].includes(ext)) {
+            const label = [props.file.artist, props.file.title].filter(Boolean).join(" - ");
+            return (
+                <div class="flex flex-col justify-center items-center w-full h-full gap-1">
+                    <Show when={props.file.has_cover}>
+                        <img src={assetsUrl(`/preview-image/${props.file.file_directory}`)} loading="lazy" class="min-h-0 max-w-full flex-1 object-contain p-2" onLoad={() => setPreviewLoaded(true)} />
+                    </Show>
+                    <Show when={label}>
+                        <p class="text-white text-sm truncate max-w-full px-2">{label}</p>
+                    </Show>
+                    <audio src={link} controls class="w-full" />
+                </div>
+            );
         }
-        if (["pdf"].includes(ext)) {
+        if (["pdf", "epub", "mobi", "xps", "oxps", "cbz", "cbr", "fb2"].includes(ext)) {
             link = assetsUrl(`/preview/${props.file.file_directory}.png`);
-            return <img src={link} loading="lazy" class="max-h-full max-w-full p-2" />;
+            return <img src={link} loading="lazy" class="max-h-full max-w-full p-2" onLoad={() => setPreviewLoaded(true)} />;
         }
         return <FileTextSVG class="max-h-full p-4 opacity-50" />;
     };
 
+    // BlurHash/dominant colour painted behind the preview until it has loaded
+    const placeholderStyle = (): JSX.CSSProperties | undefined => {
+        if (previewLoaded()) return undefined;
+        const blur = props.file.blur_hash ? blurHashToDataURL(props.file.blur_hash) : undefined;
+        if (!blur && !props.file.dominant_color) return undefined;
+        return {
+            "background-color": props.file.dominant_color,
+            "background-image": blur ? `url(${blur})` : undefined,
+            "background-size": "cover",
+            "background-position": "center",
+        };
+    };
+
     return (
-        <div ref={setRef} class="flex justify-center items-center w-full h-full opacity-70">
+        <div ref={setRef} class="flex justify-center items-center w-full h-full opacity-70" style={placeholderStyle()}>
             <Show when={isVisible()} fallback={<FileTextSVG class="max-h-full p-4 opacity-50" />}>
                 <PreviewContent />
             </Show>
@@ -150,7 +169,7 @@ const ConvertButton: Component<{ file: FileData }> = (props) => {
             data: {
                 file_directory: props.file.file_directory,
                 auth: {
-                    token: localStorage.getItem("token") || "",
+                    token: localStorage.getItem("session") || localStorage.getItem("token") || "",
                     email: localStorage.getItem("email") || "",
                     password: localStorage.getItem("password") || ""
                 }
@@ -185,7 +204,7 @@ const DeleteButton: Component<{ file: FileData }> = (props) => {
             data: {
                 file_directory: props.file.file_directory,
                 auth: {
-                    token: localStorage.getItem("token") || "",
+                    token: localStorage.getItem("session") || localStorage.getItem("token") || "",
                     email: localStorage.getItem("email") || "",
                     password: localStorage.getItem("password") || ""
                 }
@@ -218,7 +237,7 @@ const RemoveFromCollectionButton: Component<{ file: FileData }> = (props) => {
                 file_directory: props.file.file_directory,
                 collection_id: collectionId,
                 auth: {
-                    token: localStorage.getItem("token") || "",
+                    token: localStorage.getItem("session") || localStorage.getItem("token") || "",
                     email: localStorage.getItem("email") || "",
                     password: localStorage.getItem("password") || ""
                 }
@@ -320,6 +339,12 @@ const FileCard: Component<{ File: FileData }> = (props) => {
                 >
                     <DownloadSVG />
                 </button>
+                {location.pathname === "/my_drive" && ["jpg", "jpeg", "png", "webp", "tiff", "heic", "heif"].includes(props.File.original_file_name.split('.').pop()?.toLowerCase() || '') ?
+                    <>
+                        <div />
+                        <FileDetails file={props.File} />
+                    </>
+                    : null}
                 {location.pathname === "/my_drive" ? <ConvertButton file={props.File} /> : <div />}
                 {location.pathname === "/my_drive" ? <DeleteButton file={props.File} /> : <RemoveFromCollectionButton file={props.File} />}
                 <div />
@@ -0,0 +1,123 @@
+import { Component, For, Show, createSignal, onCleanup } from "solid-js";
+import Dialog from "@corvu/dialog";
+import toast from "solid-toast";
+import type { FileData } from "../library/types";
+import { InfoSVG } from "../assets/SvgFiles";
+import { useWebSocket } from "../Websockets";
+
+type ImageMetadata = {
+    has_exif: boolean;
+    camera_make?: string;
+    camera_model?: string;
+    lens_model?: string;
+    taken_at?: number;
+    exposure_time?: string;
+    f_number?: number;
+    iso?: number;
+    focal_length?: number;
+    width?: number;
+    height?: number;
+    latitude?: number;
+    longitude?: number;
+    strip_metadata: boolean;
+};
+
+const buildAuth = () => ({
+    token: localStorage.getItem("session") || localStorage.getItem("token") || "",
+    email: localStorage.getItem("email") || "",
+    password: localStorage.getItem("password") || "",
+});
+
+// the EXIF details of one of the user's images, and whether it is served without them
+const FileDetails: Component<{ file: FileData }> = (props) => {
+    const [metadata, setMetadata] = createSignal<ImageMetadata | null>(null);
+    const { socket: getSocket, status: socketStatus } = useWebSocket();
+
+    const messageHandler = (event: MessageEvent) => {
+        const response = JSON.parse(event.data);
+        if (response.type === "get_file_metadata_response") {
+            setMetadata(response.data);
+        } else if (response.type === "set_file_metadata_stripping_response" && response.data.file_directory === props.file.file_directory) {
+            setMetadata(current => current && { ...current, strip_metadata: response.data.strip_metadata || localStorage.getItem("strip_metadata") === "true" });
+            toast.success(response.data.strip_metadata ? "Metadata will be removed when this image is shared" : "This image is shared as uploaded");
+        }
+    };
+
+    const send = (type: string, data: object) => {
+        if (socketStatus() !== "connected") {
+            toast.error("WebSocket is not available");
+            return;
+        }
+        getSocket()?.send(JSON.stringify({ type, data: { ...data, file_directory: props.file.file_directory, auth: buildAuth() } }));
+    };
+
+    const onOpenChange = (open: boolean) => {
+        if (open) {
+            setMetadata(null);
+            getSocket()?.addEventListener("message", messageHandler);
+            send("get_file_metadata", {});
+        } else {
+            getSocket()?.removeEventListener("message", messageHandler);
+        }
+    };
+
+    onCleanup(() => getSocket()?.removeEventListener("message", messageHandler));
+
+    const rows = (m: ImageMetadata): [string, string][] => [
+        ["Camera", [m.camera_make, m.camera_model].filter(Boolean).join(" ")],
+        ["Lens", m.lens_model || ""],
+        ["Taken", m.taken_at ? new Date(m.taken_at * 1000).toLocaleString() : ""],
+        ["Exposure", [m.exposure_time && `${m.exposure_time}s`, m.f_number && `f/${m.f_number.toFixed(1)}`, m.iso && `ISO ${m.iso}`, m.focal_length && `${m.focal_length}mm`].filter(Boolean).join(" · ")],
+        ["Size", m.width && m.height ? `${m.width} × ${m.height}` : ""],
+        ["Location", m.latitude !== undefined && m.longitude !== undefined ? `${m.latitude.toFixed(5)}, ${m.longitude.toFixed(5)}` : ""],
+    ].filter(([, value]) => value) as [string, string][];
+
+    return (
+        <Dialog onOpenChange={onOpenChange}>
+            <Dialog.Trigger class="flex items-center justify-center p-2 bg-purple-700/30 hover:bg-purple-700/20 rounded-xl text-purple-400">
+                <InfoSVG />
+            </Dialog.Trigger>
+            <Dialog.Portal>
+                <Dialog.Overlay class="fixed inset-0 z-50 bg-black/50" />
+                <Dialog.Content class="fixed z-50 top-[50%] left-[50%] translate-x-[-50%] translate-y-[-50%] w-[90vw] max-w-md bg-neutral-800 rounded-lg p-6 space-y-4 text-white">
+                    <Dialog.Label class="text-lg font-bold text-center truncate">{props.file.original_file_name}</Dialog.Label>
+                    <Show when={metadata()} fallback={<p class="text-neutral-400 text-center">Loading...</p>}>
+                        {m => (
+                            <>
+                                <Show when={m().has_exif} fallback={<p class="text-neutral-400 text-center">No camera metadata in this file</p>}>
+                                    <div class="grid grid-cols-[auto_1fr] gap-x-4 gap-y-1 text-sm">
+                                        <For each={rows(m())}>
+                                            {([label, value]) => (
+                                                <>
+                                                    <p class="text-neutral-400">{label}:</p>
+                                                    <p class="truncate">{value}</p>
+                                                </>
+                                            )}
+                                        </For>
+                                    </div>
+                                </Show>
+                                <label class="flex items-center space-x-2 text-sm cursor-pointer">
+                                    <input
+                                        type="checkbox"
+                                        checked={m().strip_metadata}
+                                        disabled={localStorage.getItem("strip_metadata") === "true"}
+                                        onChange={e => send("set_file_metadata_stripping", { strip: e.currentTarget.checked })}
+                                    />
+                                    <span>Remove location and camera details when shared</span>
+                                </label>
+                                <Show when={localStorage.getItem("strip_metadata") === "true"}>
+                                    <p class="text-neutral-400 text-xs">On for all ur images, change it in ur account settings</p>
+                                </Show>
+                            </>
+                        )}
+                    </Show>
+                    <div class="flex justify-end">
+                        <Dialog.Close class="bg-neutral-600 hover:bg-neutral-700 text-white font-semibold py-2 px-4 rounded">Close</Dialog.Close>
+                    </div>
+                </Dialog.Content>
+            </Dialog.Portal>
+        </Dialog>
+    );
+};
+
+export default FileDetails;
@@ -163,7 +163,7 @@ const fetchFilesAndCollections = (ws: WebSocket) => {
   ws.send(JSON.stringify({
     type: "get_user_files",
     data: {
-      token: localStorage.getItem("token") || "",
+      token: localStorage.getItem("session") || localStorage.getItem("token") || "",
       email: localStorage.getItem("email") || "",
       password: localStorage.getItem("password") || ""
     }
@@ -171,7 +171,7 @@ const fetchFilesAndCollections = (ws: WebSocket) => {
   ws.send(JSON.stringify({
     type: "get_user_collections",
     data: {
-      token: localStorage.getItem("token") || "",
+      token: localStorage.getItem("session") || localStorage.getItem("token") || "",
       email: localStorage.getItem("email") || "",
       password: localStorage.getItem("password") || ""
     }
@@ -188,7 +188,7 @@ const getCollection = (id: string, status: Accessor<SocketStatus>, socket: Acces
             data: {
                 id: id,
                 auth: {
-                    token: localStorage.getItem("token") || "",
+                    token: localStorage.getItem("session") || localStorage.getItem("token") || "",
                     email: localStorage.getItem("email") || "",
                     password: localStorage.getItem("password") || ""
                 }
@@ -197,7 +197,16 @@ const getCollection = (id: string, status: Accessor<SocketStatus>, socket: Acces
     }
 }
 
-const handleLogout = (setIsLoggedIn: (value: boolean) => void, ctx: AppContextType) => {
+const handleLogout = (setIsLoggedIn: (value: boolean) => void, ctx: AppContextType, socket?: WebSocket) => {
+    const session = localStorage.getItem("session");
+    if (session && socket) {
+        socket.send(JSON.stringify({ type: "logout", data: { session_token: session } }));
+    }
+    localStorage.removeItem("session");
+    localStorage.removeItem("totp_enabled");
+    localStorage.removeItem("email_verified");
+    localStorage.removeItem("admin");
+    localStorage.removeItem("strip_metadata");
     localStorage.removeItem("email");
     localStorage.removeItem("password");
     localStorage.removeItem("display_name");
@@ -210,6 +219,82 @@ const handleLogout = (setIsLoggedIn: (value: boolean) => void, ctx: AppContextTy
     })
 };
 
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~";
+const blurHashCache = new Map<string, string>();
+
+const decode83 = (str: string) => {
+    let value = 0;
+    for (const char of str) value = value * 83 + base83Chars.indexOf(char);
+    return value;
+};
+
+const sRGBToLinear = (value: number) => {
+    const v = value / 255;
+    return v <= 0.04045 ? v / 12.92 : Math.pow((v + 0.055) / 1.055, 2.4);
+};
+
+const linearToSRGB = (value: number) => {
+    const v = Math.max(0, Math.min(1, value));
+    return v <= 0.0031308 ? Math.round(v * 12.92 * 255) : Math.round((1.055 * Math.pow(v, 1 / 2.4) - 0.055) * 255);
+};
+
+// blurHashToDataURL renders a BlurHash into a tiny PNG data URL, used as a placeholder while previews load
+const blurHashToDataURL = (hash: string, size = 32): string | undefined => {
+    if (blurHashCache.has(hash)) return blurHashCache.get(hash);
+    if (hash.length < 6) return undefined;
+    const sizeFlag = decode83(hash[0]);
+    const numX = (sizeFlag % 9) + 1;
+    const numY = Math.floor(sizeFlag / 9) + 1;
+    if (hash.length !== 4 + 2 * numX * numY) return undefined;
+    const maxValue = (decode83(hash[1]) + 1) / 166;
+
+    const colors: number[][] = [];
+    for (let i = 0; i < numX * numY; i++) {
+        if (i === 0) {
+            const dc = decode83(hash.substring(2, 6));
+            colors.push([sRGBToLinear(dc >> 16), sRGBToLinear((dc >> 8) & 255), sRGBToLinear(dc & 255)]);
+            continue;
+        }
+        const ac = decode83(hash.substring(4 + i * 2, 6 + i * 2));
+        const signPow = (v: number) => Math.sign(v) * v * v;
+        colors.push([
+            signPow((Math.floor(ac / (19 * 19)) - 9) / 9) * maxValue,
+            signPow(((Math.floor(ac / 19) % 19) - 9) / 9) * maxValue,
+            signPow(((ac % 19) - 9) / 9) * maxValue,
+        ]);
+    }
+
+    const canvas = document.createElement("canvas");
+    canvas.width = size;
+    canvas.height = size;
+    const context = canvas.getContext("2d");
+    if (!context) return undefined;
+    const pixels = context.createImageData(size, size);
+    for (let y = 0; y < size; y++) {
+        for (let x = 0; x < size; x++) {
+            let r = 0, g = 0, b = 0;
+            for (let j = 0; j < numY; j++) {
+                for (let i = 0; i < numX; i++) {
+                    const basis = Math.cos((Math.PI * x * i) / size) * Math.cos((Math.PI * y * j) / size);
+                    const color = colors[i + j * numX];
+                    r += color[0] * basis;
+                    g += color[1] * basis;
+                    b += color[2] * basis;
+                }
+            }
+            const offset = 4 * (x + y * size);
+            pixels.data[offset] = linearToSRGB(r);
+            pixels.data[offset + 1] = linearToSRGB(g);
+            pixels.data[offset + 2] = linearToSRGB(b);
+            pixels.data[offset + 3] = 255;
+        }
+    }
+    context.putImageData(pixels, 0, 0);
+    const url = canvas.toDataURL();
+    blurHashCache.set(hash, url);
+    return url;
+};
+
 function generateUUID() {
   if (typeof crypto !== 'undefined' && crypto.randomUUID) {
     return crypto.randomUUID();
@@ -222,4 +307,4 @@ function generateUUID() {
   });
 }
   
-export {generateUUID, formatFileSize, truncateFileName, getFileType, UniversalMessageHandler, generateClientToken, fetchFilesAndCollections, getCollection, handleLogout};
\ No newline at end of file
+export {generateUUID, blurHashToDataURL, formatFileSize, truncateFileName, getFileType, UniversalMessageHandler, generateClientToken, fetchFilesAndCollections, getCollection, handleLogout};
\ No newline at end of file
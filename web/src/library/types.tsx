@@ -36,6 +36,13 @@ interface FileData {
     file_directory: string;
     file_size: number;
     timestamp: number;
+    blur_hash?: string;
+    dominant_color?: string;
+    title?: string;
+    artist?: string;
+    album?: string;
+    duration?: number;
+    has_cover?: boolean;
 }
 
 interface CollectionCardData {
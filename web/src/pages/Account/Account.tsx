@@ -1,5 +1,5 @@
 import { Component, createSignal, onMount, onCleanup, useContext } from "solid-js";
-import { Toaster } from "solid-toast";
+import { Toaster, toast } from "solid-toast";
 import { useWebSocket } from "@/Websockets";
 import { AppContext } from "@/Context";
 import { fetchFilesAndCollections, handleLogout } from "@/library/functions";
@@ -23,10 +23,69 @@ const Account: Component = () => {
         setIsMobile(window.innerWidth <= 768);
     };
 
+    // trades the ticket from an OIDC login for a session, like logging in with a password
+    const completeOIDCLogin = (ticket: string, totpCode = "") => {
+        const ws = currentSocket.socket();
+        if (!ws) return;
+        const messageHandler = (event: MessageEvent) => {
+            const response = JSON.parse(event.data);
+            if (response.type !== "login_response") return;
+            ws.removeEventListener("message", messageHandler);
+            if (response.data.session_token) {
+                toast.success("Login successful!");
+                localStorage.setItem("email", response.data.email);
+                localStorage.setItem("display_name", response.data.display_name);
+                localStorage.setItem("session", response.data.session_token);
+                localStorage.setItem("totp_enabled", String(response.data.totp_enabled));
+                localStorage.setItem("email_verified", String(response.data.email_verified));
+                localStorage.setItem("admin", String(response.data.admin));
+                localStorage.setItem("strip_metadata", String(response.data.strip_metadata));
+                if (response.data.restored) toast.success("Welcome back, ur account is no longer scheduled for deletion");
+                localStorage.removeItem("token");
+                handleLoginSuccess();
+            } else if (response.data === "two-factor code required") {
+                const code = window.prompt("Enter the code from your authenticator app, or a recovery code:");
+                if (code) completeOIDCLogin(ticket, code);
+            } else {
+                toast.error(typeof response.data === "string" ? response.data : "Login failed. Please try again.");
+            }
+        };
+        ws.addEventListener("message", messageHandler);
+        ws.send(JSON.stringify({ type: "oidc_login", data: { ticket, totp_code: totpCode, device: navigator.userAgent } }));
+    };
+
+    // links from mails and OIDC logins land here
+    const handleLinkParams = () => {
+        const params = new URLSearchParams(window.location.search);
+        const verifyToken = params.get("verify_email");
+        const resetToken = params.get("reset_password");
+        const oidcTicket = params.get("oidc_ticket");
+        const oidcError = params.get("oidc_error");
+        if (!verifyToken && !resetToken && !oidcTicket && !oidcError) return;
+        if (currentSocket.status() !== "connected") {
+            setTimeout(handleLinkParams, 100);
+            return;
+        }
+        if (verifyToken) {
+            currentSocket.socket()?.send(JSON.stringify({ type: "verify_email", data: { token: verifyToken } }));
+        } else if (resetToken) {
+            const newPassword = window.prompt("Choose a new password:");
+            if (!newPassword) return;
+            currentSocket.socket()?.send(JSON.stringify({ type: "reset_password", data: { token: resetToken, new_password: newPassword } }));
+        } else if (oidcTicket) {
+            completeOIDCLogin(oidcTicket);
+        } else if (oidcError) {
+            toast.error(oidcError);
+        }
+        window.history.replaceState(null, "", window.location.pathname);
+    };
+
     onMount(() => {
+        handleLinkParams();
         const storedEmail = localStorage.getItem("email");
         const storedPassword = localStorage.getItem("password");
-        setIsLoggedIn(!!(storedEmail && storedPassword));
+        // OIDC logins have a session but no password
+        setIsLoggedIn(!!(storedEmail && (storedPassword || localStorage.getItem("session"))));
         window.addEventListener('resize', handleResize);
     });
 
@@ -37,14 +96,15 @@ const Account: Component = () => {
     window.addEventListener('storage', () => {
         const storedEmail = localStorage.getItem("email");
         const storedPassword = localStorage.getItem("password");
-        setIsLoggedIn(!!(storedEmail && storedPassword));
+        // OIDC logins have a session but no password
+        setIsLoggedIn(!!(storedEmail && (storedPassword || localStorage.getItem("session"))));
     });
 
     return (
         <>
             <title>Account | DriveV3</title>
             {isLoggedIn() ?
-                (isMobile() ? <MobileAccountManager logout={() => handleLogout(setIsLoggedIn, ctx)} /> : <AccountManager logout={() => handleLogout(setIsLoggedIn, ctx)} />)
+                (isMobile() ? <MobileAccountManager logout={() => handleLogout(setIsLoggedIn, ctx, currentSocket.socket())} /> : <AccountManager logout={() => handleLogout(setIsLoggedIn, ctx, currentSocket.socket())} />)
                 : <LoginScreen onLoginSuccess={handleLoginSuccess} isMobile={isMobile()} />
             }
             <Toaster
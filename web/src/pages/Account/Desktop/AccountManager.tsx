@@ -1,8 +1,11 @@
-import { Component, createSignal, useContext } from "solid-js";
+import { Component, Show, createSignal, useContext } from "solid-js";
 import { DesktopTemplate } from "@/components/Template";
 import { AppContext } from "@/Context";
 import { formatFileSize } from "@/library/functions";
 import AccountDetails from "../shared/components/AccountDetails";
+import APIKeys from "../shared/components/APIKeys";
+import DataExport from "../shared/components/DataExport";
+import AdminPanel from "../shared/components/AdminPanel";
 import { DangerZone, UserStat } from "../shared/components/DangerZone";
 
 const AccountManager: Component<{logout: () => void}> = (props) => {
@@ -16,6 +19,11 @@ const AccountManager: Component<{logout: () => void}> = (props) => {
             <div class="w-full h-full flex justify-center items-center space-x-[1vh]">
                 <div class="flex flex-col min-w-[20%] space-y-[2vh]">
                     <AccountDetails email={email} setEmail={setEmail} displayName={displayName} setDisplayName={setDisplayName}/>
+                    <APIKeys/>
+                    <DataExport/>
+                    <Show when={localStorage.getItem("admin") === "true"}>
+                        <AdminPanel/>
+                    </Show>
                 </div>
                 <div class="min-w-[20%] grid grid-cols-2 grid-rows-2 gap-[1vh]">
                     <UserStat title="Space&nbsp;Used" value={formatFileSize(ctx.files().reduce((sum, file) => sum + file.file_size, 0))} class="col-span-2"/>
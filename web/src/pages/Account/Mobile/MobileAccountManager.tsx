@@ -1,8 +1,11 @@
-import { Component, createSignal, useContext } from "solid-js";
+import { Component, Show, createSignal, useContext } from "solid-js";
 import Navbar from "@/components/Navbar";
 import { AppContext } from "@/Context";
 import { formatFileSize } from "@/library/functions";
 import AccountDetails from "../shared/components/AccountDetails";
+import APIKeys from "../shared/components/APIKeys";
+import DataExport from "../shared/components/DataExport";
+import AdminPanel from "../shared/components/AdminPanel";
 import { DangerZone, UserStat } from "../shared/components/DangerZone";
 
 const MobileAccountManager: Component<{logout: () => void}> = (props) => {
@@ -21,6 +24,11 @@ const MobileAccountManager: Component<{logout: () => void}> = (props) => {
                     <UserStat title="Files Hosted" value={ctx.files().length.toString()} />
                     <UserStat title="Collections" value={ctx.userCollections().size.toString()}/>
                 </div>
+                <APIKeys />
+                <DataExport />
+                <Show when={localStorage.getItem("admin") === "true"}>
+                    <AdminPanel />
+                </Show>
                 <DangerZone logout={props.logout} />
             </div>
         </div>
@@ -0,0 +1,197 @@
+import { Component, For, Show, createSignal, onCleanup, onMount } from "solid-js";
+import Dialog from '@corvu/dialog';
+import { toast } from "solid-toast";
+import { useWebSocket } from "@/Websockets";
+
+type APIKey = {
+    id: string;
+    name: string;
+    scopes: string[];
+    collections: string[];
+    created_at: number;
+    last_used: number;
+    expires_at: number;
+};
+
+const scopeLabels: Record<string, string> = {
+    "files:read": "Read files",
+    "files:upload": "Upload",
+    "collections:manage": "Manage collections",
+    "files:delete": "Delete files",
+};
+
+const buildAuth = () => ({
+    token: localStorage.getItem("session") || localStorage.getItem("token") || "",
+    email: localStorage.getItem("email") || "",
+    password: localStorage.getItem("password") || "",
+});
+
+const APIKeys: Component<{class?: string}> = (props) => {
+    const [keys, setKeys] = createSignal<APIKey[]>([]);
+    const [open, setOpen] = createSignal(false);
+    const [name, setName] = createSignal("");
+    const [scopes, setScopes] = createSignal<string[]>(["files:read", "files:upload"]);
+    const [collections, setCollections] = createSignal("");
+    const [expiryDays, setExpiryDays] = createSignal("");
+    const [createdKey, setCreatedKey] = createSignal("");
+    const { socket: getSocket, status: socketStatus } = useWebSocket();
+
+    const send = (type: string, data: object) => {
+        if (socketStatus() !== "connected") {
+            setTimeout(() => send(type, data), 100);
+            return;
+        }
+        getSocket()?.send(JSON.stringify({ type, data }));
+    };
+
+    const refresh = () => send("list_api_keys", { auth: buildAuth() });
+
+    const messageHandler = (event: MessageEvent) => {
+        const response = JSON.parse(event.data);
+        if (response.type === "list_api_keys_response") {
+            setKeys(response.data || []);
+        } else if (response.type === "create_api_key_response") {
+            setCreatedKey(response.data.key);
+            refresh();
+        }
+    };
+
+    onMount(() => {
+        getSocket()?.addEventListener("message", messageHandler);
+        refresh();
+    });
+
+    onCleanup(() => {
+        getSocket()?.removeEventListener("message", messageHandler);
+    });
+
+    const toggleScope = (scope: string) => {
+        setScopes(scopes().includes(scope) ? scopes().filter(s => s !== scope) : [...scopes(), scope]);
+    };
+
+    const handleCreate = () => {
+        if (!name().trim()) {
+            toast.error("Give the key a name.");
+            return;
+        }
+        if (scopes().length === 0) {
+            toast.error("Pick at least one scope.");
+            return;
+        }
+        const days = parseInt(expiryDays());
+        send("create_api_key", {
+            name: name(),
+            scopes: scopes(),
+            collections: collections().split(",").map(id => id.trim()).filter(id => id),
+            expires_at: days > 0 ? Math.round(Date.now() / 1000) + days * 24 * 60 * 60 : 0,
+            auth: buildAuth(),
+        });
+    };
+
+    const handleRevoke = (id: string) => {
+        send("revoke_api_key", { id, auth: buildAuth() });
+        setKeys(keys().filter(key => key.id !== id));
+    };
+
+    return (
+        <div class={`bg-neutral-900 border border-neutral-700 rounded-md p-[2vh] text-white flex flex-col shadow-md w-full ${props.class}`}>
+            <p class="font-semibold text-[2vh] mb-[1vh] text-center">API Keys</p>
+            <For each={keys()} fallback={<p class="text-neutral-500 text-[1.5vh] text-center mb-[1vh]">No keys yet</p>}>
+                {key => (
+                    <div class="flex justify-between items-center mb-[1vh] text-[1.5vh]">
+                        <div class="truncate">
+                            <p class="font-semibold truncate">{key.name}</p>
+                            <p class="text-neutral-400 truncate">
+                                {key.scopes.map(scope => scopeLabels[scope] || scope).join(", ")}
+                                {key.collections.length > 0 ? ` · ${key.collections.length} collection(s)` : ""}
+                                {key.expires_at ? ` · expires ${new Date(key.expires_at * 1000).toLocaleDateString()}` : ""}
+                            </p>
+                        </div>
+                        <button
+                            class="bg-red-600 hover:bg-red-700 text-white font-semibold py-1 px-2 rounded ml-2"
+                            onClick={() => handleRevoke(key.id)}
+                        >
+                            Revoke
+                        </button>
+                    </div>
+                )}
+            </For>
+            <Dialog open={open()} onOpenChange={(newOpen) => {
+                setOpen(newOpen);
+                setName("");
+                setCollections("");
+                setExpiryDays("");
+                setCreatedKey("");
+            }}>
+                <Dialog.Trigger class="bg-blue-600 w-full hover:bg-blue-700 text-white font-semibold py-[1vh] px-[1vw] rounded mt-auto transition-colors duration-200 text-[1.5vh]">
+                    New&nbsp;API&nbsp;Key
+                </Dialog.Trigger>
+                <Dialog.Portal>
+                    <Dialog.Overlay class="fixed inset-0 bg-black/50 z-40" />
+                    <Dialog.Content class="flex z-50 justify-center flex-col fixed top-1/2 left-1/2 -translate-x-1/2 -translate-y-1/2 bg-neutral-800 p-6 rounded-md shadow-lg text-white w-[clamp(300px,50vw,500px)]">
+                        <Dialog.Label class="text-xl font-semibold mb-4 text-center">New API Key</Dialog.Label>
+                        <Show when={!createdKey()} fallback={
+                            <>
+                                <p class="mb-2 text-sm text-neutral-400">Copy the key now, it won't be shown again:</p>
+                                <input
+                                    readOnly
+                                    class="w-full p-3 rounded bg-neutral-700 text-[1.5vh] font-mono"
+                                    value={createdKey()}
+                                    onFocus={e => e.currentTarget.select()}
+                                />
+                            </>
+                        }>
+                            <label class="text-sm text-neutral-300 mb-1">Name:</label>
+                            <input
+                                class="w-full p-3 rounded bg-neutral-700 text-[1.5vh] placeholder-neutral-500 focus:outline-none focus:ring-2 focus:ring-blue-400"
+                                placeholder="Backup script"
+                                value={name()}
+                                onInput={e => setName(e.currentTarget.value)}
+                            />
+                            <p class="text-sm text-neutral-300 mb-1 mt-3">Scopes:</p>
+                            <For each={Object.keys(scopeLabels)}>
+                                {scope => (
+                                    <label class="flex items-center space-x-2 text-sm">
+                                        <input type="checkbox" checked={scopes().includes(scope)} onChange={() => toggleScope(scope)} />
+                                        <span>{scopeLabels[scope]}</span>
+                                    </label>
+                                )}
+                            </For>
+                            <label class="text-sm text-neutral-300 mb-1 mt-3">Limit to collections (comma separated IDs, empty for all):</label>
+                            <input
+                                class="w-full p-3 rounded bg-neutral-700 text-[1.5vh] placeholder-neutral-500 focus:outline-none focus:ring-2 focus:ring-blue-400"
+                                placeholder="All collections"
+                                value={collections()}
+                                onInput={e => setCollections(e.currentTarget.value)}
+                            />
+                            <label class="text-sm text-neutral-300 mb-1 mt-3">Expires after (days, empty for never):</label>
+                            <input
+                                type="number"
+                                min="1"
+                                class="w-full p-3 rounded bg-neutral-700 text-[1.5vh] placeholder-neutral-500 focus:outline-none focus:ring-2 focus:ring-blue-400"
+                                placeholder="Never"
+                                value={expiryDays()}
+                                onInput={e => setExpiryDays(e.currentTarget.value)}
+                            />
+                        </Show>
+                        <div class="flex justify-end space-x-3 mt-6">
+                            <Dialog.Close class="bg-neutral-600 hover:bg-neutral-700 text-white font-semibold py-2 px-4 rounded transition-colors duration-200">
+                                {createdKey() ? "Done" : "Cancel"}
+                            </Dialog.Close>
+                            <Show when={!createdKey()}>
+                                <button
+                                    class="bg-blue-600 hover:bg-blue-700 text-white font-semibold py-2 px-4 rounded transition-colors duration-200"
+                                    onClick={handleCreate}
+                                >
+                                    Create
+                                </button>
+                            </Show>
+                        </div>
+                    </Dialog.Content>
+                </Dialog.Portal>
+            </Dialog>
+        </div>
+    );
+}
+
+export default APIKeys;
@@ -2,7 +2,6 @@ import { Accessor, Component, createEffect, createSignal } from "solid-js";
 import Dialog from '@corvu/dialog';
 import { toast } from "solid-toast";
 import { useWebSocket } from "@/Websockets";
-import bcrypt from "bcryptjs";
 import { isEmailValid, isPasswordValid } from "../validators";
 
 const AccountDetails: Component<{email: Accessor<string>; setEmail: (email: string) => void; displayName: Accessor<string>; setDisplayName: (name: string) => void; class?: string}> = (props) => {
@@ -11,10 +10,61 @@ const AccountDetails: Component<{email: Accessor<string>; setEmail: (email: stri
     const [tempEmail, setTempEmail] = createSignal(props.email());
     const [tempNewPassword, setTempNewPassword] = createSignal("");
     const [currentAuthPassword, setCurrentAuthPassword] = createSignal("");
+    const [emailVerified, setEmailVerified] = createSignal(localStorage.getItem("email_verified") !== "false");
     const [hasPendingChanges, setHasPendingChanges] = createSignal(false);
+    const [stripMetadata, setStripMetadata] = createSignal(localStorage.getItem("strip_metadata") === "true");
 
     const { socket: getSocket, status: socketStatus } = useWebSocket();
 
+    const requestEmailVerification = () => {
+        const currentSocket = getSocket();
+        if (socketStatus() !== "connected" || !currentSocket) {
+            toast.error("WebSocket is not connected. Please try again later.");
+            return;
+        }
+        currentSocket.send(JSON.stringify({
+            type: "request_email_verification",
+            data: {
+                auth: {
+                    token: localStorage.getItem("session") || localStorage.getItem("token") || "",
+                    email: localStorage.getItem("email") || "",
+                    password: localStorage.getItem("password") || "",
+                },
+            },
+        }));
+    };
+
+    const toggleStripMetadata = (strip: boolean) => {
+        const currentSocket = getSocket();
+        if (socketStatus() !== "connected" || !currentSocket) {
+            toast.error("WebSocket is not connected. Please try again later.");
+            return;
+        }
+        const messageHandler = (event: MessageEvent) => {
+            const response = JSON.parse(event.data);
+            if (response.type === "set_account_metadata_stripping_response") {
+                currentSocket.removeEventListener("message", messageHandler);
+                localStorage.setItem("strip_metadata", String(response.data.strip_metadata));
+                setStripMetadata(response.data.strip_metadata);
+                toast.success(response.data.strip_metadata ? "Metadata will be removed from all ur shared images" : "Images are shared as uploaded unless set per image");
+            } else if (response.type === "error") {
+                currentSocket.removeEventListener("message", messageHandler);
+            }
+        };
+        currentSocket.addEventListener("message", messageHandler);
+        currentSocket.send(JSON.stringify({
+            type: "set_account_metadata_stripping",
+            data: {
+                strip,
+                auth: {
+                    token: localStorage.getItem("session") || localStorage.getItem("token") || "",
+                    email: localStorage.getItem("email") || "",
+                    password: localStorage.getItem("password") || "",
+                },
+            },
+        }));
+    };
+
     createEffect(() => {
         const dnChanged = tempDisplayName() !== props.displayName();
         const emailChanged = tempEmail() !== props.email();
@@ -133,6 +183,10 @@ const AccountDetails: Component<{email: Accessor<string>; setEmail: (email: stri
                 currentSocket.addEventListener('error', errorHandler);
                 currentSocket.addEventListener('close', closeHandler);
 
+                if (localStorage.getItem("totp_enabled") === "true") {
+                    // every change uses up a code, so each one asks for its own
+                    payload.totp_code = window.prompt(`Enter a two-factor code to confirm the ${requestType.replace("_", " ")}:`) || "";
+                }
                 currentSocket.send(JSON.stringify({ type: requestType, data: payload }));
             });
         };
@@ -176,6 +230,8 @@ const AccountDetails: Component<{email: Accessor<string>; setEmail: (email: stri
                     "Email updated!",
                     () => {
                         localStorage.setItem("email", tempEmail());
+                        localStorage.setItem("email_verified", "false");
+                        setEmailVerified(false);
                         props.setEmail(tempEmail());
                     }
                 );
@@ -189,14 +245,12 @@ const AccountDetails: Component<{email: Accessor<string>; setEmail: (email: stri
                 toast.error("New password must be between 3 and 64 characters.");
                 allOperationsAttemptedAndSuccessful = false;
             } else {
-                const salt = bcrypt.genSaltSync(10);
-                const hashedPassword = bcrypt.hashSync(tempNewPassword(), salt);
                 const success = await sendUpdateRequest(
                     "change_password",
                     {
                         email: localStorage.getItem("email") || initialEmailForAuth, // Use potentially updated email
                         old_password: authPasswordForRequests,
-                        new_password_hashed: hashedPassword,
+                        new_password: tempNewPassword(),
                     },
                     "Password updated!",
                     () => localStorage.setItem("password", tempNewPassword())
@@ -243,11 +297,30 @@ const AccountDetails: Component<{email: Accessor<string>; setEmail: (email: stri
                 <div class="mb-[1vh]">
                     <p class="text-gray-500 text-[1.5vh] uppercase tracking-wider">Email:</p>
                     <p class="text-[2vh] truncate">{props.email()}</p>
+                    {emailVerified() ? null : (
+                        <a
+                            href="#"
+                            class="text-yellow-400 text-[1.5vh] hover:underline"
+                            onClick={e => {
+                                e.preventDefault();
+                                requestEmailVerification();
+                            }}
+                        >
+                            Not verified, send verification mail
+                        </a>
+                    )}
                 </div>
-                <div class="mb-[2vh]">
+                <div class="mb-[1vh]">
                     <p class="text-gray-500 text-[1.5vh] uppercase tracking-wider">Password:</p>
                     <p class="text-[2vh]">************</p>
                 </div>
+                <div class="mb-[2vh]">
+                    <p class="text-gray-500 text-[1.5vh] uppercase tracking-wider">Image Metadata:</p>
+                    <label class="flex items-center space-x-2 text-[1.5vh] cursor-pointer">
+                        <input type="checkbox" checked={stripMetadata()} onChange={e => toggleStripMetadata(e.currentTarget.checked)} />
+                        <span>Remove location and camera details from all shared images</span>
+                    </label>
+                </div>
                 <Dialog.Trigger class="bg-blue-600 hover:bg-blue-700 text-white font-semibold py-[1vh] rounded mt-auto transition-colors duration-200 text-[1.5vh]">
                     Edit Account
                 </Dialog.Trigger>
@@ -0,0 +1,201 @@
+import { Component, For, Show, createSignal, onCleanup, onMount } from "solid-js";
+import { toast } from "solid-toast";
+import { useWebSocket } from "@/Websockets";
+import { formatFileSize } from "@/library/functions";
+
+type AdminUser = {
+    email: string;
+    display_name: string;
+    email_verified: boolean;
+    totp_enabled: boolean;
+    admin: boolean;
+    disabled: boolean;
+    delete_at: number;
+    storage_quota: number;
+    quota_bytes: number;
+    files: number;
+    storage_used: number;
+    collections: number;
+};
+
+type AdminStats = {
+    accounts: number;
+    disabled_accounts: number;
+    pending_deletion: number;
+    admins: number;
+    owners: number;
+    files: number;
+    storage_used: number;
+    collections: number;
+    sessions: number;
+    api_keys: number;
+    connections: number;
+    default_storage_quota: number;
+};
+
+const buildAuth = () => ({
+    token: localStorage.getItem("session") || "",
+    email: localStorage.getItem("email") || "",
+    password: localStorage.getItem("password") || "",
+});
+
+const AdminPanel: Component<{class?: string}> = (props) => {
+    const [stats, setStats] = createSignal<AdminStats | null>(null);
+    const [users, setUsers] = createSignal<AdminUser[]>([]);
+    const [total, setTotal] = createSignal(0);
+    const [query, setQuery] = createSignal("");
+    const [fileDirectory, setFileDirectory] = createSignal("");
+    const [collectionID, setCollectionID] = createSignal("");
+    const { socket: getSocket, status: socketStatus } = useWebSocket();
+
+    const send = (type: string, data: object) => {
+        if (socketStatus() !== "connected") {
+            setTimeout(() => send(type, data), 100);
+            return;
+        }
+        getSocket()?.send(JSON.stringify({ type, data }));
+    };
+
+    const refresh = () => {
+        send("admin_stats", { auth: buildAuth() });
+        send("admin_list_users", { query: query(), offset: 0, limit: 50, auth: buildAuth() });
+    };
+
+    const messageHandler = (event: MessageEvent) => {
+        const response = JSON.parse(event.data);
+        if (response.type === "admin_stats_response") {
+            setStats(response.data);
+        } else if (response.type === "admin_list_users_response") {
+            setUsers(response.data.users || []);
+            setTotal(response.data.total || 0);
+        }
+    };
+
+    onMount(() => {
+        getSocket()?.addEventListener("message", messageHandler);
+        refresh();
+    });
+
+    onCleanup(() => {
+        getSocket()?.removeEventListener("message", messageHandler);
+    });
+
+    const toggleDisabled = (user: AdminUser) => {
+        if (!user.disabled && !window.confirm(`Disable ${user.email}? They will be logged out everywhere.`)) {
+            return;
+        }
+        send("admin_set_disabled", { email: user.email, disabled: !user.disabled, auth: buildAuth() });
+        setTimeout(refresh, 500);
+    };
+
+    const changeQuota = (user: AdminUser) => {
+        const input = window.prompt(`Storage quota of ${user.email} in MB (0 for the default, -1 for no limit):`, String(Math.round(user.storage_quota / 1024 / 1024)));
+        if (input === null) {
+            return;
+        }
+        const megabytes = parseInt(input);
+        if (isNaN(megabytes)) {
+            toast.error("Enter a number.");
+            return;
+        }
+        send("admin_set_quota", { email: user.email, quota: megabytes < 0 ? -1 : megabytes * 1024 * 1024, auth: buildAuth() });
+        setTimeout(refresh, 500);
+    };
+
+    const deleteFile = () => {
+        if (!fileDirectory().trim() || !window.confirm(`Delete file ${fileDirectory()}?`)) {
+            return;
+        }
+        send("admin_delete_file", { file_directory: fileDirectory().trim(), auth: buildAuth() });
+        setFileDirectory("");
+    };
+
+    const deleteCollection = () => {
+        if (!collectionID().trim() || !window.confirm(`Delete collection ${collectionID()}?`)) {
+            return;
+        }
+        send("admin_delete_collection", { collection_id: collectionID().trim(), auth: buildAuth() });
+        setCollectionID("");
+    };
+
+    const quotaLabel = (user: AdminUser) => user.quota_bytes ? formatFileSize(user.quota_bytes) : "no limit";
+
+    return (
+        <div class={`bg-neutral-900 border border-neutral-700 rounded-md p-[2vh] text-white flex flex-col shadow-md w-full ${props.class}`}>
+            <p class="font-semibold text-[2vh] mb-[1vh] text-center">Admin</p>
+            <Show when={stats()}>
+                {s => (
+                    <p class="text-neutral-400 text-[1.5vh] text-center mb-[1vh]">
+                        {s().accounts} accounts ({s().disabled_accounts} disabled, {s().pending_deletion} deleted, {s().admins} admins) · {s().owners - s().accounts} guests ·
+                        {" "}{s().files} files · {formatFileSize(s().storage_used)} · {s().collections} collections ·
+                        {" "}{s().sessions} sessions · {s().api_keys} API keys · {s().connections} connections
+                    </p>
+                )}
+            </Show>
+            <input
+                class="w-full p-2 mb-[1vh] rounded bg-neutral-700 text-[1.5vh] placeholder-neutral-500 focus:outline-none focus:ring-2 focus:ring-blue-400"
+                placeholder="Search by email or name"
+                value={query()}
+                onInput={e => setQuery(e.currentTarget.value)}
+                onKeyDown={e => e.key === "Enter" && refresh()}
+            />
+            <div class="max-h-[40vh] overflow-y-auto">
+                <For each={users()} fallback={<p class="text-neutral-500 text-[1.5vh] text-center mb-[1vh]">No users found</p>}>
+                    {user => (
+                        <div class="flex justify-between items-center mb-[1vh] text-[1.5vh]">
+                            <div class="truncate">
+                                <p class="font-semibold truncate">
+                                    {user.email}{user.admin ? " · admin" : ""}{user.disabled ? " · disabled" : ""}{user.delete_at ? ` · deleted, purged ${new Date(user.delete_at * 1000).toLocaleDateString()}` : ""}
+                                </p>
+                                <p class="text-neutral-400 truncate">
+                                    {user.files} files · {formatFileSize(user.storage_used)} of {quotaLabel(user)} · {user.collections} collections
+                                </p>
+                            </div>
+                            <div class="flex ml-2 space-x-1">
+                                <button
+                                    class="bg-neutral-600 hover:bg-neutral-700 text-white font-semibold py-1 px-2 rounded"
+                                    onClick={() => changeQuota(user)}
+                                >
+                                    Quota
+                                </button>
+                                <button
+                                    class={`${user.disabled ? "bg-green-600 hover:bg-green-700" : "bg-red-600 hover:bg-red-700"} text-white font-semibold py-1 px-2 rounded`}
+                                    onClick={() => toggleDisabled(user)}
+                                >
+                                    {user.disabled ? "Enable" : "Disable"}
+                                </button>
+                            </div>
+                        </div>
+                    )}
+                </For>
+            </div>
+            <Show when={total() > users().length}>
+                <p class="text-neutral-500 text-[1.3vh] text-center mb-[1vh]">Showing {users().length} of {total()}, search to narrow it down</p>
+            </Show>
+            <div class="flex space-x-[1vh] mt-[1vh]">
+                <input
+                    class="w-full p-2 rounded bg-neutral-700 text-[1.5vh] placeholder-neutral-500 focus:outline-none focus:ring-2 focus:ring-red-400"
+                    placeholder="File name (e.g. abc123.png)"
+                    value={fileDirectory()}
+                    onInput={e => setFileDirectory(e.currentTarget.value)}
+                />
+                <button class="bg-red-600 hover:bg-red-700 text-white font-semibold py-1 px-2 rounded text-[1.5vh]" onClick={deleteFile}>
+                    Delete
+                </button>
+            </div>
+            <div class="flex space-x-[1vh] mt-[1vh]">
+                <input
+                    class="w-full p-2 rounded bg-neutral-700 text-[1.5vh] placeholder-neutral-500 focus:outline-none focus:ring-2 focus:ring-red-400"
+                    placeholder="Collection ID"
+                    value={collectionID()}
+                    onInput={e => setCollectionID(e.currentTarget.value)}
+                />
+                <button class="bg-red-600 hover:bg-red-700 text-white font-semibold py-1 px-2 rounded text-[1.5vh]" onClick={deleteCollection}>
+                    Delete
+                </button>
+            </div>
+        </div>
+    );
+}
+
+export default AdminPanel;
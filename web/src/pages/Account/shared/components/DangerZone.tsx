@@ -25,6 +25,9 @@ const DeleteAccountDialog: Component = () => {
                 data: {
                     email: localStorage.getItem("email"),
                     password: deletePassword(),
+                    totp_code: localStorage.getItem("totp_enabled") === "true"
+                        ? window.prompt("Enter a two-factor code to confirm:") || ""
+                        : "",
                 },
             })
         )
@@ -42,7 +45,7 @@ const DeleteAccountDialog: Component = () => {
                 <Dialog.Content class="flex z-50 justify-center flex-col fixed top-1/2 left-1/2 -translate-x-1/2 -translate-y-1/2 bg-neutral-800 p-6 rounded-md shadow-lg text-white w-[clamp(300px,50vw,500px)]">
                     <Dialog.Label class="text-xl font-semibold mb-2 text-center">Confirm Account Deletion</Dialog.Label>
                     <p class="mb-4 text-sm text-neutral-400">
-                        P.S. if u delete ur account then i cant recover it even if you ask me to, all ur files, collections, and data will be instantly deleted automatically
+                        ur files and collections get hidden right away and everything is deleted for good after a grace period. Changed ur mind? Just log in again before then to restore ur account
                     </p>
                     <label for="deletePasswordInput" class="text-sm text-red-400 mb-1 font-semibold">
                         Enter ur password to confirm:
@@ -72,12 +75,45 @@ const DeleteAccountDialog: Component = () => {
     )
 }
 
+const RotateTokenButton: Component = () => {
+    const { socket: getSocket, status: socketStatus } = useWebSocket();
+    const sendRotateToken = () => {
+        if (socketStatus() !== "connected") {
+            setTimeout(sendRotateToken, 100);
+            return;
+        }
+        getSocket()?.send(JSON.stringify({
+            type: "rotate_token",
+            data: {
+                auth: {
+                    token: localStorage.getItem("session") || "",
+                    email: localStorage.getItem("email") || "",
+                    password: localStorage.getItem("password") || "",
+                },
+            },
+        }));
+    };
+    const handleRotateToken = () => {
+        if (window.confirm("Give your account a new token? Every other device will be logged out.")) {
+            sendRotateToken();
+        }
+    };
+    return (
+        <button class="bg-orange-600 w-full hover:bg-orange-700 text-white font-semibold py-[1vh] px-[1vw] rounded mt-auto transition-colors duration-200 text-[1.5vh]"
+        onClick={handleRotateToken}
+        >
+            Rotate&nbsp;Token
+        </button>
+    )
+}
+
 const DangerZone: Component<{logout: () => void; class?: string}> = (props) => {
     return (
         <div class={`bg-red-950 border border-red-700 rounded-md p-[2vh] text-white flex flex-col shadow-md w-full ${props.class}`}>
             <p class="font-semibold text-[2vh] mb-[2vh] text-center">Danger Zone</p>
             <div class="w-full flex space-x-[1vh]">
                 <DeleteAccountDialog/>
+                <RotateTokenButton/>
                 <button class="bg-yellow-600 w-full hover:bg-yellow-700 text-white font-semibold py-[1vh] px-[1vw] rounded mt-auto transition-colors duration-200 text-[1.5vh]"
                 onClick={() => {
                     props.logout();
@@ -0,0 +1,94 @@
+import { Component, Match, Switch, createSignal, onCleanup, onMount } from "solid-js";
+import { useWebSocket } from "@/Websockets";
+
+type ExportStatus = {
+    status: "" | "running" | "ready" | "failed";
+    done: number;
+    total: number;
+    download_url?: string;
+    expires_at?: number;
+    error?: string;
+};
+
+const buildAuth = () => ({
+    token: localStorage.getItem("session") || "",
+    email: localStorage.getItem("email") || "",
+    password: localStorage.getItem("password") || "",
+});
+
+const DataExport: Component<{class?: string}> = (props) => {
+    const [status, setStatus] = createSignal<ExportStatus>({ status: "", done: 0, total: 0 });
+    const { socket: getSocket, status: socketStatus } = useWebSocket();
+
+    const send = (type: string) => {
+        if (socketStatus() !== "connected") {
+            setTimeout(() => send(type), 100);
+            return;
+        }
+        getSocket()?.send(JSON.stringify({ type, data: { auth: buildAuth() } }));
+    };
+
+    const messageHandler = (event: MessageEvent) => {
+        const response = JSON.parse(event.data);
+        if (response.type === "export_progress") {
+            setStatus(response.data);
+            // pushed progress leaves the link out, only export_status hands it out
+            if (response.data.status === "ready" && !response.data.download_url) {
+                send("export_status");
+            }
+        }
+    };
+
+    onMount(() => {
+        getSocket()?.addEventListener("message", messageHandler);
+        send("export_status");
+    });
+
+    onCleanup(() => {
+        getSocket()?.removeEventListener("message", messageHandler);
+    });
+
+    const startExport = () => {
+        setStatus({ status: "running", done: 0, total: 0 });
+        send("request_export");
+    };
+
+    return (
+        <div class={`bg-neutral-900 border border-neutral-700 rounded-md p-[2vh] text-white flex flex-col shadow-md w-full ${props.class}`}>
+            <p class="font-semibold text-[2vh] mb-[1vh] text-center">Export Data</p>
+            <p class="text-neutral-400 text-[1.5vh] text-center mb-[1vh]">
+                <Switch fallback="Download all ur files and collections as a zip">
+                    <Match when={status().status === "running"}>
+                        Packaging... {status().total ? `${status().done} of ${status().total} files` : ""}
+                    </Match>
+                    <Match when={status().status === "ready"}>
+                        Ready, the link works until {new Date((status().expires_at || 0) * 1000).toLocaleString()}
+                    </Match>
+                    <Match when={status().status === "failed"}>
+                        Export failed: {status().error}
+                    </Match>
+                </Switch>
+            </p>
+            <Switch>
+                <Match when={status().status === "ready"}>
+                    <a
+                        class="bg-green-600 w-full hover:bg-green-700 text-white text-center font-semibold py-[1vh] px-[1vw] rounded mt-auto transition-colors duration-200 text-[1.5vh]"
+                        href={status().download_url}
+                    >
+                        Download
+                    </a>
+                </Match>
+                <Match when={status().status !== "running"}>
+                    <button
+                        class="bg-blue-600 w-full hover:bg-blue-700 text-white font-semibold py-[1vh] px-[1vw] rounded mt-auto transition-colors duration-200 text-[1.5vh]"
+                        onClick={startExport}
+                    >
+                        Export&nbsp;My&nbsp;Data
+                    </button>
+                </Match>
+            </Switch>
+        </div>
+    );
+}
+
+export default DataExport;
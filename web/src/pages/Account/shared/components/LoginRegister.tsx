@@ -1,18 +1,39 @@
-import { Component, createSignal } from "solid-js";
+import { Component, For, createSignal, onMount } from "solid-js";
 import { toast } from "solid-toast";
 import { useWebSocket } from "@/Websockets";
-import bcrypt from "bcryptjs";
 import { DesktopTemplate } from "@/components/Template";
 import Navbar from "@/components/Navbar";
 import { isEmailValid, isPasswordValid } from "../validators";
+import { apiUrl } from "@/assets/ApiUrl";
 
 const LoginCard: Component<{ onSignUpClick: () => void; onLoginSuccess: () => void }> = (props) => {
     const [email, setEmail] = createSignal("");
     const [password, setPassword] = createSignal("");
     const { socket: getSocket, status } = useWebSocket();
+    const [oidcProviders, setOidcProviders] = createSignal<{ id: string; name: string }[]>([]);
+
+    onMount(() => {
+        fetch(apiUrl("/auth/oidc/providers"))
+            .then(response => response.ok ? response.json() : [])
+            .then(setOidcProviders)
+            .catch(() => setOidcProviders([]));
+    });
 
     const isFormValid = () => isEmailValid(email()) && isPasswordValid(password());
 
+    const handleForgotPassword = () => {
+        if (!isEmailValid(email())) {
+            toast.error("Enter the email of your account first.");
+            return;
+        }
+        const currentSocket = getSocket();
+        if (!currentSocket || currentSocket.readyState !== WebSocket.OPEN) {
+            toast.error("WebSocket is not connected. Please try again later.");
+            return;
+        }
+        currentSocket.send(JSON.stringify({ type: "request_password_reset", data: { email: email() } }));
+    };
+
     const handleLogin = (e: Event) => {
         e.preventDefault();
         if (!email() || !password()) {
@@ -63,16 +84,31 @@ const LoginCard: Component<{ onSignUpClick: () => void; onLoginSuccess: () => vo
                         localStorage.setItem("email", email());
                         localStorage.setItem("password", password());
                         localStorage.setItem("display_name", response.data.display_name);
+                        localStorage.setItem("session", response.data.session_token);
+                        localStorage.setItem("totp_enabled", String(response.data.totp_enabled));
+                        localStorage.setItem("email_verified", String(response.data.email_verified));
+                        localStorage.setItem("admin", String(response.data.admin));
+                        localStorage.setItem("strip_metadata", String(response.data.strip_metadata));
+                        if (response.data.restored) toast.success("Welcome back, ur account is no longer scheduled for deletion");
                         localStorage.removeItem("token");
                         props.onLoginSuccess(); // Call the callback on successful login
                         // TODO: Setup user migration
                         // for now, just remove the previous token
                     } else {
+                        // failed logins come back as a bare error string
+                        const error: string | undefined = typeof response.data === "string" ? response.data : response.data.error;
+                        if (error === "two-factor code required") {
+                            const code = window.prompt("Enter the code from your authenticator app, or a recovery code:");
+                            if (code) {
+                                sendLogin(code); // keep listening for the retried login
+                                return;
+                            }
+                        }
                         toast.error(
-                            response.data.error === "record not found"
+                            error === "record not found"
                                 ? "Account not found"
-                                : response.data.error
-                                    ? response.data.error.charAt(0).toUpperCase() + response.data.error.slice(1)
+                                : error
+                                    ? error.charAt(0).toUpperCase() + error.slice(1)
                                     : "Login failed. Please try again."
                         );
                     }
@@ -101,15 +137,18 @@ const LoginCard: Component<{ onSignUpClick: () => void; onLoginSuccess: () => vo
         currentSocket.addEventListener('error', errorHandler);
         currentSocket.addEventListener('close', closeHandler);
 
-        currentSocket.send(
+        const sendLogin = (totpCode = "") => currentSocket.send(
             JSON.stringify({
                 type: "login",
                 data: {
                     email: email(),
                     password: password(),
+                    device: navigator.userAgent,
+                    totp_code: totpCode,
                 },
             })
         );
+        sendLogin();
     };
 
     return (
@@ -142,6 +181,28 @@ const LoginCard: Component<{ onSignUpClick: () => void; onLoginSuccess: () => vo
             >
                 Login
             </button>
+            <div class="w-full text-center mb-2">
+                <a
+                    href="#"
+                    class="text-gray-400 text-[1.5vh] hover:underline"
+                    onClick={e => {
+                        e.preventDefault();
+                        handleForgotPassword();
+                    }}
+                >
+                    Forgot your password?
+                </a>
+            </div>
+            <For each={oidcProviders()}>
+                {provider => (
+                    <a
+                        href={apiUrl(`/auth/oidc/${provider.id}/login`)}
+                        class="w-full py-3 mb-4 bg-gray-700 text-white text-center rounded-lg hover:bg-gray-600"
+                    >
+                        Log in with {provider.name}
+                    </a>
+                )}
+            </For>
             <div class="w-full text-center">
                 <span class="text-gray-400 text-[1.5vh]">
                     New to AngaDrive?{" "}
@@ -239,6 +300,8 @@ const RegisterCard: Component<{ onLoginClick: () => void; onRegisterSuccess: ()
                         localStorage.setItem("email", email());
                         localStorage.setItem("password", password());
                         localStorage.setItem("display_name", displayName());
+                        localStorage.setItem("session", response.data.session_token);
+                        localStorage.setItem("email_verified", "false");
                         localStorage.removeItem("token");
                         props.onRegisterSuccess(); // Call the callback on successful registration
                     } else {
@@ -273,16 +336,14 @@ const RegisterCard: Component<{ onLoginClick: () => void; onRegisterSuccess: ()
         currentSocket.addEventListener('error', errorHandler);
         currentSocket.addEventListener('close', closeHandler);
 
-        const salt = bcrypt.genSaltSync(10);
-        const hashedPassword = bcrypt.hashSync(password(), salt);
-
         currentSocket.send(
             JSON.stringify({
                 type: "register",
                 data: {
                     display_name: displayName(),
                     email: email(),
-                    hashed_password: hashedPassword,
+                    password: password(),
+                    device: navigator.userAgent,
                 },
             })
         );
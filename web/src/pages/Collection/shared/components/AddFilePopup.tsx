@@ -52,12 +52,16 @@ const AddFilePopup: Component<{collectionId: string, isMobile?: boolean}> = (pro
     };
 
     const buildAuthDetails = () => {
+        const session = localStorage.getItem("session");
+        if (session) {
+            return { token: session };
+        }
         const storedEmail = localStorage.getItem("email");
         const storedPassword = localStorage.getItem("password");
         if (storedEmail && storedPassword) {
             return { email: storedEmail, password: storedPassword };
         }
-        return { token: localStorage.getItem("token") || "" };
+        return { token: localStorage.getItem("session") || localStorage.getItem("token") || "" };
     };
 
     const startSingleUpload = async (sf: SelectableFile) => {
@@ -309,7 +313,7 @@ const AddFilePopup: Component<{collectionId: string, isMobile?: boolean}> = (pro
                         collection_id: props.collectionId,
                         file_directory: fileDirectory,
                         auth: {
-                            token: localStorage.getItem("token") || "",
+                            token: localStorage.getItem("session") || localStorage.getItem("token") || "",
                             email: localStorage.getItem("email") || "",
                             password: localStorage.getItem("password") || ""
                         }
@@ -32,7 +32,7 @@ const AddFolderPopup: Component<{collectionId: string, isMobile?: boolean}> = (p
                             collection_id: props.collectionId,
                             folder_id: folderId,
                             auth: {
-                                token: localStorage.getItem("token") || "",
+                                token: localStorage.getItem("session") || localStorage.getItem("token") || "",
                                 email: localStorage.getItem("email") || "",
                                 password: localStorage.getItem("password") || ""
                             }
@@ -46,7 +46,7 @@ const AddFolderPopup: Component<{collectionId: string, isMobile?: boolean}> = (p
                         collection_id: props.collectionId,
                         folder_name: newFolderName().trim(),
                         auth: {
-                            token: localStorage.getItem("token") || "",
+                            token: localStorage.getItem("session") || localStorage.getItem("token") || "",
                             email: localStorage.getItem("email") || "",
                             password: localStorage.getItem("password") || ""
                         }
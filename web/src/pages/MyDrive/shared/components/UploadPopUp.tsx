@@ -138,6 +138,9 @@ async function uploadFileInChunks(
             localStorage.removeItem("email");
             localStorage.removeItem("password");
             localStorage.removeItem("display_name");
+            localStorage.removeItem("session");
+            localStorage.removeItem("totp_enabled");
+            localStorage.removeItem("email_verified");
             if (!localStorage.getItem("token")) {
                 localStorage.setItem("token", generateClientToken());
             }
@@ -322,6 +325,11 @@ const UploadPopup: Component = () => {
     };
 
     const buildAuthDetails = (): AuthDetails | null => {
+        // the session works for accounts with 2FA too, email and password don't
+        const session = localStorage.getItem("session");
+        if (session) {
+            return { token: session };
+        }
         const storedEmail = localStorage.getItem("email");
         const storedPassword = localStorage.getItem("password");
         if (storedEmail && storedPassword) {